@@ -0,0 +1,33 @@
+package main
+
+import (
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// With -acme.domains set, the HTTPS listener gets its certificates from an
+// ACME CA, Let's Encrypt unless -acme.directory says otherwise, instead of
+// from -tls.cert and -tls.key, and renews them before they expire. They're
+// kept in -acme.cache, a directory, so a restart doesn't ask for them again.
+// The CA checks the service is at the domains with HTTP-01 challenges, which
+// are answered on -acme.http, port 80 by default; anything else asked of it
+// there is redirected to HTTPS. Only the domains listed are given
+// certificates, so the service has to be reachable at them directly.
+
+// newACMEManager returns an autocert.Manager for the domains, keeping its
+// certificates and account key in cacheDir. A directory URL of "" is Let's
+// Encrypt's.
+func newACMEManager(domains []string, cacheDir, email, directory string) *autocert.Manager {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Email:      email,
+	}
+	if cacheDir != "" {
+		m.Cache = autocert.DirCache(cacheDir)
+	}
+	if directory != "" {
+		m.Client = &acme.Client{DirectoryURL: directory}
+	}
+	return m
+}
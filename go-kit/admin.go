@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"flag"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"strings"
+)
+
+// With -admin.addr set, the service runs a second HTTP server there, on a
+// listener of its own that needn't be reachable from outside, for what's
+// there to operate it rather than to call it: /healthz, /readyz and /livez,
+// /metrics, /version, /admin/loglevel, GET /config with the flags it was
+// started with, the net/http/pprof profiles under /debug/pprof/, including
+// /debug/pprof/trace?seconds=5 for a runtime trace, and expvar's /debug/vars,
+// see expvar.go. The public listeners then serve the service's API and
+// nothing else. Without -admin.addr, the public listeners serve the probes,
+// /metrics, /version and /admin/loglevel, as they always have, but not the
+// rest. With -admin.token set, everything on the admin listener but the
+// probes, which orchestrators call without one, wants it as a Bearer token.
+// Importing net/http/pprof and expvar puts them on http.DefaultServeMux as
+// well, which the public listeners serve, so everything under /debug/ is a 404
+// there.
+//
+//	go tool pprof http://localhost:6060/debug/pprof/profile?seconds=30
+
+// debugPrefix is where the debugging handlers are.
+const debugPrefix = "/debug/"
+
+// probePaths are the admin listener's paths that don't want -admin.token.
+var probePaths = map[string]bool{"/healthz": true, "/readyz": true, "/livez": true}
+
+// newAdminMux returns the handler of the admin listener, which serves the
+// debugging handlers itself and everything else from ops, wanting token, if
+// it's set.
+func newAdminMux(token string, ops http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", ops)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	if token == "" {
+		return mux
+	}
+	return adminAuthHandler{token, mux}
+}
+
+// adminAuthHandler lets requests with the Bearer token through to next.
+type adminAuthHandler struct {
+	token string
+	next  http.Handler
+}
+
+// ServeHTTP implements http.Handler.
+func (h adminAuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if probePaths[r.URL.Path] {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(h.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// hideDebugHandler keeps what's under debugPrefix off the public listeners.
+type hideDebugHandler struct {
+	next http.Handler
+}
+
+// ServeHTTP implements http.Handler.
+func (h hideDebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, debugPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// secretFlags are the flags configHandler doesn't show the values of.
+var secretFlags = map[string]bool{
+	"admin.token":        true,
+	"chaos.token":        true,
+	"webhook.secret":     true,
+	"oidc.client.secret": true,
+	"apikeys":            true,
+}
+
+// redactedFlags returns the value of each of fs's flags, with the
+// secretFlags, and the passwords of any URLs, redacted.
+func redactedFlags(fs *flag.FlagSet) map[string]string {
+	flags := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		switch {
+		case value == "":
+		case secretFlags[f.Name]:
+			value = "REDACTED"
+		case strings.Contains(value, "://"):
+			if u, err := url.Parse(value); err == nil && u.User != nil {
+				if _, ok := u.User.Password(); ok {
+					u.User = url.UserPassword(u.User.Username(), "REDACTED")
+					value = u.String()
+				}
+			}
+		}
+		flags[f.Name] = value
+	})
+	return flags
+}
+
+// configHandler serves GET /config, the flags the service was started with.
+type configHandler struct {
+	flags map[string]string
+}
+
+// ServeHTTP implements http.Handler.
+func (h configHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	json.NewEncoder(w).Encode(struct {
+		Flags map[string]string `json:"flags"`
+	}{h.flags})
+}
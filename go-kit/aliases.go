@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// Names can have aliases, so that Robert is greeted as Bob. Aliases are
+// managed under /aliases, and looked up without regard to case. A request can
+// ask to be greeted by the name it gave with no_alias.
+
+// alias is the name to greet Name by.
+type alias struct {
+	Name  string `json:"name"`
+	Alias string `json:"alias"`
+}
+
+var errAliasNotFound = errors.New("alias not found")
+
+// AliasStore keeps aliases by name.
+type AliasStore interface {
+	// Get returns the alias for name, or errAliasNotFound.
+	Get(name string) (alias, error)
+
+	// List returns every alias, sorted by name.
+	List() ([]alias, error)
+
+	// Put stores a, replacing any alias its name had before.
+	Put(a alias) error
+
+	// Delete removes the alias for name, or fails with errAliasNotFound.
+	Delete(name string) error
+}
+
+// memAliasStore is an AliasStore that keeps everything in memory.
+type memAliasStore struct {
+	mu      sync.RWMutex
+	aliases map[string]alias
+}
+
+func newMemAliasStore() *memAliasStore {
+	return &memAliasStore{aliases: map[string]alias{}}
+}
+
+func (s *memAliasStore) Get(name string) (alias, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.aliases[strings.ToLower(name)]
+	if !ok {
+		return alias{}, errAliasNotFound
+	}
+	return a, nil
+}
+
+func (s *memAliasStore) List() ([]alias, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []alias{}
+	for _, a := range s.aliases {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name) })
+	return list, nil
+}
+
+func (s *memAliasStore) Put(a alias) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.aliases[strings.ToLower(a.Name)] = a
+	return nil
+}
+
+func (s *memAliasStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.ToLower(name)
+	if _, ok := s.aliases[key]; !ok {
+		return errAliasNotFound
+	}
+	delete(s.aliases, key)
+	return nil
+}
+
+// checkAlias returns a with both names canonicalized, or a validationError if
+// either is one we wouldn't greet.
+func checkAlias(a alias, maxLen int) (alias, error) {
+	name, err := canonicalName(a.Name, maxLen)
+	if err != nil {
+		return a, err
+	}
+	if name == "" {
+		return a, validationError{"name", "required", "name is required"}
+	}
+	to, err := canonicalName(a.Alias, maxLen)
+	if err != nil {
+		return a, withField(err, "alias")
+	}
+	if to == "" {
+		return a, validationError{"alias", "required", "alias is required"}
+	}
+	return alias{name, to}, nil
+}
+
+// aliasMiddleware greets names by their aliases, unless the request says not
+// to. It expects names to have been canonicalized already, so it goes inside
+// validatingMiddleware.
+type aliasMiddleware struct {
+	aliases AliasStore
+	next    GreetService
+}
+
+func (mw aliasMiddleware) Hello(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.resolve(ctx, s, opts, mw.next.Hello)
+}
+
+func (mw aliasMiddleware) Goodbye(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.resolve(ctx, s, opts, mw.next.Goodbye)
+}
+
+func (mw aliasMiddleware) resolve(ctx context.Context, s string, opts GreetOptions, call greetMethod) (Greeting, error) {
+	if opts.NoAlias || s == "" {
+		return call(ctx, s, opts)
+	}
+	a, err := mw.aliases.Get(s)
+	switch {
+	case err == errAliasNotFound:
+		return call(ctx, s, opts)
+	case err != nil:
+		return Greeting{}, err
+	}
+	return call(ctx, a.Alias, opts)
+}
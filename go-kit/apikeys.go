@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Clients can authenticate with an API key in an X-API-Key header, or gRPC
+// clients in x-api-key metadata. Keys are
+// looked up in a KeyStore, which says who each one belongs to: an ID for the
+// greeting history, optionally a tenant whose requests it makes, and the
+// scopes it has. -apikeys gives keys on the command line, as comma separated
+// id=key pairs, and -apikeys.file a JSON file of them that's read again when
+// it changes:
+//
+//	[{"id": "ci", "key": "3f9a...", "tenant": "acme", "scopes": ["greet"]}]
+//
+// Tenants' own API keys (see tenants.go) are keys too. A database would be
+// another KeyStore.
+//
+// A request with a key that isn't known is answered 401, and with
+// -apikeys.required so is one without a key.
+
+// apiKey is what a key is known to be. Key is only set in files.
+type apiKey struct {
+	ID     string   `json:"id"`
+	Key    string   `json:"key,omitempty"`
+	Tenant string   `json:"tenant,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+var errKeyNotFound = errors.New("unknown API key")
+
+// KeyStore looks up API keys.
+type KeyStore interface {
+	// Lookup returns what the key is known as, or errKeyNotFound.
+	Lookup(key string) (apiKey, error)
+}
+
+type apiKeyContextKey int
+
+const (
+	// apiKeyKey is the context key for the apiKey a request authenticated
+	// with.
+	apiKeyKey apiKeyContextKey = iota
+
+	// apiKeyErrKey is the context key for why a request's API key couldn't
+	// be looked up.
+	apiKeyErrKey
+)
+
+// staticKeyStore is a KeyStore of a fixed set of keys.
+type staticKeyStore map[string]apiKey
+
+// parseStaticKeys parses -apikeys' id=key pairs.
+func parseStaticKeys(s string) (staticKeyStore, error) {
+	keys := staticKeyStore{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i <= 0 || i == len(pair)-1 {
+			return nil, errors.New("API keys have to be id=key pairs")
+		}
+		keys[pair[i+1:]] = apiKey{ID: pair[:i]}
+	}
+	return keys, nil
+}
+
+func (s staticKeyStore) Lookup(key string) (apiKey, error) {
+	k, ok := s[key]
+	if !ok {
+		return apiKey{}, errKeyNotFound
+	}
+	return k, nil
+}
+
+// fileKeyStoreCheck is how often a fileKeyStore looks for changes to its file.
+const fileKeyStoreCheck = time.Second
+
+// fileKeyStore is a KeyStore of the keys in a JSON file, which it reads again
+// whenever it's been modified.
+type fileKeyStore struct {
+	path string
+
+	mu      sync.Mutex
+	keys    staticKeyStore
+	modTime time.Time
+	checked time.Time
+}
+
+func openFileKeyStore(path string) (*fileKeyStore, error) {
+	s := &fileKeyStore{path: path}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileKeyStore) Lookup(key string) (apiKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.checked) > fileKeyStoreCheck {
+		// A file that's gone bad keeps the keys it had.
+		s.reload()
+	}
+	return s.keys.Lookup(key)
+}
+
+// reload reads the file if it's changed since it was last read.
+func (s *fileKeyStore) reload() error {
+	s.checked = time.Now()
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(s.modTime) {
+		return nil
+	}
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var list []apiKey
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	keys := staticKeyStore{}
+	for _, k := range list {
+		if k.Key == "" {
+			return errors.New(s.path + ": API key " + k.ID + " has no key")
+		}
+		keys[k.Key] = apiKey{ID: k.ID, Tenant: k.Tenant, Scopes: k.Scopes}
+	}
+	s.keys, s.modTime = keys, fi.ModTime()
+	return nil
+}
+
+// tenantKeyStore is a KeyStore of the tenants' API keys.
+type tenantKeyStore struct {
+	tenants TenantStore
+}
+
+func (s tenantKeyStore) Lookup(key string) (apiKey, error) {
+	t, err := s.tenants.ByAPIKey(key)
+	if err == errTenantNotFound {
+		return apiKey{}, errKeyNotFound
+	}
+	if err != nil {
+		return apiKey{}, err
+	}
+	return apiKey{ID: t.ID, Tenant: t.ID}, nil
+}
+
+// multiKeyStore is a KeyStore that looks up keys in each of its stores in
+// turn.
+type multiKeyStore []KeyStore
+
+func (s multiKeyStore) Lookup(key string) (apiKey, error) {
+	for _, store := range s {
+		k, err := store.Lookup(key)
+		if err != errKeyNotFound {
+			return k, err
+		}
+	}
+	return apiKey{}, errKeyNotFound
+}
+
+// keyToContextFunc puts what a call's API key is known as in its context.
+type keyToContextFunc func(ctx context.Context, key string) context.Context
+
+// fromHTTP is a kithttp.RequestFunc for the request's X-API-Key.
+func (f keyToContextFunc) fromHTTP(ctx context.Context, r *http.Request) context.Context {
+	return f(ctx, r.Header.Get("X-API-Key"))
+}
+
+// fromGRPC is a grpctransport.ServerRequestFunc for the call's x-api-key.
+func (f keyToContextFunc) fromGRPC(ctx context.Context, md metadata.MD) context.Context {
+	if keys := md.Get("x-api-key"); len(keys) > 0 {
+		return f(ctx, keys[0])
+	}
+	return ctx
+}
+
+// makeAPIKeyToContext returns a keyToContextFunc that looks up the call's
+// API key, if it has one, in keys, and puts what it's known as, and its
+// tenant, in the context, or why it isn't known for authenticateAPIKey. It
+// has to come after callerToContext, which it overrides.
+func makeAPIKeyToContext(keys KeyStore, tenants TenantStore) keyToContextFunc {
+	return func(ctx context.Context, key string) context.Context {
+		if key == "" {
+			return ctx
+		}
+		k, err := keys.Lookup(key)
+		if err == errKeyNotFound {
+			err = errUnauthorized{err: err}
+		}
+		if err != nil {
+			return context.WithValue(ctx, apiKeyErrKey, err)
+		}
+		if k.Tenant != "" {
+			t, err := tenants.Get(k.Tenant)
+			if err == errTenantNotFound {
+				err = errUnauthorized{err: errors.New("API key's tenant doesn't exist")}
+			}
+			if err != nil {
+				return context.WithValue(ctx, apiKeyErrKey, err)
+			}
+			ctx = context.WithValue(ctx, tenantKey, t)
+		}
+		return context.WithValue(withCallerSubject(ctx, k.ID), apiKeyKey, k)
+	}
+}
+
+// authenticateAPIKey returns an endpoint.Middleware that fails calls whose
+// API key makeAPIKeyToContext couldn't look up, with errUnauthorized if it
+// isn't known, and calls without a key at all if required.
+func authenticateAPIKey(required bool) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if err, ok := ctx.Value(apiKeyErrKey).(error); ok {
+				return nil, err
+			}
+			if _, ok := ctx.Value(apiKeyKey).(apiKey); !ok && required {
+				return nil, errUnauthorized{err: errors.New("missing API key")}
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// newAPIKeyAuthenticator returns the keyToContextFunc and
+// endpoint.Middleware that authenticate calls with the keys from -apikeys
+// and -apikeys.file and the tenants' keys. The tenants' keys are looked up
+// even without either flag, so a tenant's requests are always its own.
+func newAPIKeyAuthenticator(static, path string, required bool, tenants TenantStore) (keyToContextFunc, endpoint.Middleware, error) {
+	var stores multiKeyStore
+	if static != "" {
+		keys, err := parseStaticKeys(static)
+		if err != nil {
+			return nil, nil, err
+		}
+		stores = append(stores, keys)
+	}
+	if path != "" {
+		keys, err := openFileKeyStore(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		stores = append(stores, keys)
+	}
+	stores = append(stores, tenantKeyStore{tenants})
+	return makeAPIKeyToContext(stores, tenants), authenticateAPIKey(required), nil
+}
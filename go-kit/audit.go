@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log/syslog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	log "github.com/go-kit/kit/log"
+)
+
+// Every HTTP request that could change something, anything but a GET, HEAD
+// or OPTIONS, leaves an audit record: when it was, who made it, what it was,
+// how it turned out and its request ID. Records go to an AuditSink rather
+// than the service's log, as a line of JSON each: to the end of -audit.file,
+// and to the syslog daemon at -audit.syslog, "local" for this machine's.
+//
+//	{"time": "...", "request_id": "...", "subject": "ci", "addr": "10.0.0.7:51234",
+//	 "method": "PUT", "path": "/tenants/acme", "status": 200, "outcome": "success"}
+//
+// Who made a request is the subject it authenticated as, if it did, and the
+// address it came from. The outcome is success, denied for a 401 or 403, or
+// failure. A record that can't be written is logged instead.
+
+// auditRecord is one audited request.
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Addr      string    `json:"addr"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	Outcome   string    `json:"outcome"`
+}
+
+// AuditSink keeps audit records. What it's been given it never gives up.
+type AuditSink interface {
+	Write(r auditRecord) error
+}
+
+// fileAuditSink appends records to a file.
+type fileAuditSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func openFileAuditSink(path string) (*fileAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileAuditSink{f: f}, nil
+}
+
+func (s *fileAuditSink) Write(r auditRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(b, '\n'))
+	return err
+}
+
+// syslogAuditSink sends records to a syslog daemon, as notices from the
+// authpriv facility.
+type syslogAuditSink struct {
+	w *syslog.Writer
+}
+
+// dialSyslogAuditSink connects to the daemon at addr, a URL like
+// udp://host:514, or local.
+func dialSyslogAuditSink(addr string) (syslogAuditSink, error) {
+	var network, raddr string
+	if addr != "local" {
+		u, err := url.Parse(addr)
+		if err != nil || u.Host == "" {
+			return syslogAuditSink{}, errors.New("syslog address has to be like udp://host:514, or local")
+		}
+		network, raddr = u.Scheme, u.Host
+	}
+	w, err := syslog.Dial(network, raddr, syslog.LOG_NOTICE|syslog.LOG_AUTHPRIV, "greet-audit")
+	if err != nil {
+		return syslogAuditSink{}, err
+	}
+	return syslogAuditSink{w}, nil
+}
+
+func (s syslogAuditSink) Write(r auditRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.w.Notice(string(b))
+}
+
+// multiAuditSink writes records to each of its sinks.
+type multiAuditSink []AuditSink
+
+func (s multiAuditSink) Write(r auditRecord) error {
+	var first error
+	for _, sink := range s {
+		if err := sink.Write(r); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+type auditContextKey int
+
+// auditKey is the context key for the *pendingAudit of a request being
+// audited.
+const auditKey auditContextKey = 0
+
+// pendingAudit is the record of a request that's still being served. The
+// subject is filled in by withCallerSubject, when the request authenticates.
+type pendingAudit struct {
+	mu      sync.Mutex
+	subject string
+}
+
+func (a *pendingAudit) setSubject(sub string) {
+	a.mu.Lock()
+	a.subject = sub
+	a.mu.Unlock()
+}
+
+// auditHandler audits the requests to next that could change something.
+type auditHandler struct {
+	sink   AuditSink
+	logger log.Logger
+	next   http.Handler
+}
+
+func (h auditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS":
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	pending := &pendingAudit{}
+	rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+	start := time.Now()
+	defer func() {
+		pending.mu.Lock()
+		subject := pending.subject
+		pending.mu.Unlock()
+		record := auditRecord{
+			Time:      start.UTC(),
+			RequestID: w.Header().Get(requestIDHeader),
+			Subject:   subject,
+			Addr:      r.RemoteAddr,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Status:    rec.code,
+			Outcome:   auditOutcome(rec.code),
+		}
+		if err := h.sink.Write(record); err != nil {
+			h.logger.Log("audit", "lost", "record", record.Method+" "+record.Path, "request_id", record.RequestID, "err", err)
+		}
+	}()
+	h.next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), auditKey, pending)))
+}
+
+func auditOutcome(code int) string {
+	switch {
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return "denied"
+	case code >= 400:
+		return "failure"
+	}
+	return "success"
+}
+
+// auditToContext is a kithttp.RequestFunc that carries the request's audit
+// over into the context endpoints get, so the subject they authenticate can
+// be recorded.
+func auditToContext(ctx context.Context, r *http.Request) context.Context {
+	if a, ok := r.Context().Value(auditKey).(*pendingAudit); ok {
+		return context.WithValue(ctx, auditKey, a)
+	}
+	return ctx
+}
+
+// statusRecorder notes the status of the response it passes through.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Flush lets streaming responses through as they're written.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSockets take over the connection.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection can't be hijacked")
+	}
+	r.code = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the connection underneath.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// An HTTP request's body can be at most -http.body.max bytes, and one that's
+// longer is answered 413 Request Entity Too Large, once the service has read
+// that far into it. POST /hello/import and POST /hello/many, which are made
+// for bodies too long to hold in memory, and read them a piece at a time,
+// aren't limited. Nor is the WebSocket at /hello/ws, whose messages are each
+// limited to -http.body.max instead.
+//
+// JSON bodies are decoded strictly: a field the request doesn't have, or
+// anything after the JSON value, is a 400, rather than being ignored.
+
+// unlimitedBodyPaths are the paths whose bodies aren't limited.
+var unlimitedBodyPaths = []string{"/hello/import", "/hello/many"}
+
+// errTrailingData is the error of a JSON body with more after its value.
+var errTrailingData = errors.New("unexpected data after the JSON value")
+
+// bodyLimitHandler limits the bodies of the requests to next to max bytes.
+type bodyLimitHandler struct {
+	max  int64
+	next http.Handler
+}
+
+// ServeHTTP implements http.Handler.
+func (h bodyLimitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Body != nil && r.Body != http.NoBody && !coversPath(unlimitedBodyPaths, r.URL.Path) {
+		if r.ContentLength > h.max {
+			writeError(w, http.StatusRequestEntityTooLarge, &http.MaxBytesError{Limit: h.max})
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, h.max)
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// decodeJSON decodes the single JSON value in r into v, refusing fields v
+// doesn't have.
+func decodeJSON(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if err != nil {
+			return err
+		}
+		return errTrailingData
+	}
+	return nil
+}
+
+// tooLarge says whether err is from reading more of a body than it's
+// allowed.
+func tooLarge(err error) bool {
+	var e *http.MaxBytesError
+	return errors.As(err, &e)
+}
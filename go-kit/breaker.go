@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sony/gobreaker"
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+)
+
+// With -breaker.failures set, the HTTP greeting endpoints are behind circuit
+// breakers, one for hellos and one for goodbyes. A breaker opens after that
+// many failures in a row, or, with -breaker.ratio, once that share of the
+// calls in an -breaker.interval have failed, and while it's open calls are
+// answered 503 straight away. After -breaker.timeout it's half-open, and lets
+// -breaker.probes calls through to see whether the service has recovered,
+// closing again if they all succeed. Each breaker's state is served at
+// /metrics as greet_breaker_state: 0 closed, 1 half-open and 2 open.
+//
+// Only failures that are the service's fault count, like a store that can't
+// be read. Names that don't validate, and requests turned away by a rate
+// limit, are the caller's, and don't trip anything.
+
+// errBreakerOpen is the error of a call the breaker didn't let through.
+var errBreakerOpen = errors.New("service unavailable, circuit breaker open")
+
+// breakerConfig is how circuit breakers trip and recover. A zero Failures
+// means no breaker.
+type breakerConfig struct {
+	Failures uint32
+	Ratio    float64
+	Interval time.Duration
+	Timeout  time.Duration
+	Probes   uint32
+}
+
+// newBreaker returns a breaker called name, which reports its state to
+// state, or nil if c has no Failures.
+func (c breakerConfig) newBreaker(name string, state metrics.Gauge) *gobreaker.CircuitBreaker {
+	if c.Failures == 0 {
+		return nil
+	}
+	state = state.With("name", name)
+	state.Set(float64(gobreaker.StateClosed))
+	return gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:        name,
+		MaxRequests: c.Probes,
+		Interval:    c.Interval,
+		Timeout:     c.Timeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			if counts.ConsecutiveFailures >= c.Failures {
+				return true
+			}
+			return c.Ratio > 0 && counts.Requests >= c.Failures &&
+				float64(counts.TotalFailures)/float64(counts.Requests) >= c.Ratio
+		},
+		OnStateChange: func(_ string, _, to gobreaker.State) {
+			state.Set(float64(to))
+		},
+	})
+}
+
+// breakerEndpoint returns an endpoint.Middleware that calls through cb,
+// counting errors in the response that are the service's fault as failures.
+// A nil cb lets everything through.
+func breakerEndpoint(cb *gobreaker.CircuitBreaker) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		if cb == nil {
+			return next
+		}
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			var response interface{}
+			_, err := cb.Execute(func() (interface{}, error) {
+				var err error
+				if response, err = next(ctx, request); err != nil {
+					return nil, err
+				}
+				return nil, serviceFault(response)
+			})
+			switch {
+			case err == gobreaker.ErrOpenState, err == gobreaker.ErrTooManyRequests:
+				return nil, errBreakerOpen
+			case response != nil:
+				// The fault, if there was one, is already in the response.
+				return response, nil
+			}
+			return nil, err
+		}
+	}
+}
+
+// serviceFault returns the error in a greeting endpoint's response, if it's
+// one the service is to blame for.
+func serviceFault(response interface{}) error {
+	var err error
+	switch r := response.(type) {
+	case helloResponse:
+		err = r.Err
+	case goodbyeResponse:
+		err = r.err
+	case helloBatchResponse:
+		for _, result := range r.Results {
+			if err := serviceFault(result); err != nil {
+				return err
+			}
+		}
+	}
+	if _, ok := err.(validationError); ok || err == errNoName || err == errTenantRateLimited {
+		return nil
+	}
+	return err
+}
+
+// breakerChecker is a Checker that fails while its breaker is open, for
+// /healthz.
+type breakerChecker struct {
+	cb *gobreaker.CircuitBreaker
+}
+
+// Check implements Checker.
+func (c breakerChecker) Check(context.Context) error {
+	if c.cb.State() == gobreaker.StateOpen {
+		return errBreakerOpen
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+)
+
+// With -bulkhead.max set, each of the HTTP greeting endpoints (hello,
+// goodbye, card and batch) serves at most that many calls at once, so one
+// that's gone slow can't tie up everything the others need. Up to
+// -bulkhead.queue more calls wait their turn, for as long as -bulkhead.wait,
+// and the rest are answered 503 straight away. How many calls each endpoint is
+// serving is at /metrics as greet_bulkhead_inflight.
+
+// errBulkheadFull is the error of a call there wasn't room for.
+var errBulkheadFull = errors.New("service unavailable, too many requests in progress")
+
+// bulkheadConfig is how many calls an endpoint serves at once, and waits to.
+// A zero Max means no limit.
+type bulkheadConfig struct {
+	Max   int
+	Queue int
+	Wait  time.Duration
+}
+
+// bulkhead is the room an endpoint has for calls.
+type bulkhead struct {
+	slots    chan struct{}
+	queue    chan struct{}
+	wait     time.Duration
+	inflight metrics.Gauge
+}
+
+// endpoint returns the bulkheadEndpoint middleware for the endpoint called
+// name, which reports how many calls it's serving to inflight.
+func (c bulkheadConfig) endpoint(name string, inflight metrics.Gauge) endpoint.Middleware {
+	if c.Max == 0 {
+		return func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	}
+	inflight = inflight.With("name", name)
+	inflight.Set(0)
+	return bulkheadEndpoint(&bulkhead{
+		slots:    make(chan struct{}, c.Max),
+		queue:    make(chan struct{}, c.Queue),
+		wait:     c.Wait,
+		inflight: inflight,
+	})
+}
+
+// bulkheadEndpoint returns an endpoint.Middleware that only lets as many
+// calls through at once as b has room for, failing the rest with
+// errBulkheadFull.
+func bulkheadEndpoint(b *bulkhead) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if err := b.enter(ctx); err != nil {
+				return nil, err
+			}
+			defer b.leave()
+			return next(ctx, request)
+		}
+	}
+}
+
+// enter takes a slot, waiting in the queue for one if there's room in it.
+func (b *bulkhead) enter(ctx context.Context) error {
+	select {
+	case b.slots <- struct{}{}:
+		b.inflight.Set(float64(len(b.slots)))
+		return nil
+	default:
+	}
+	select {
+	case b.queue <- struct{}{}:
+		defer func() { <-b.queue }()
+	default:
+		return errBulkheadFull
+	}
+	timer := time.NewTimer(b.wait)
+	defer timer.Stop()
+	select {
+	case b.slots <- struct{}{}:
+		b.inflight.Set(float64(len(b.slots)))
+		return nil
+	case <-timer.C:
+		return errBulkheadFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *bulkhead) leave() {
+	<-b.slots
+	b.inflight.Set(float64(len(b.slots)))
+}
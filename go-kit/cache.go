@@ -0,0 +1,99 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Most greetings are ones that have been given before, so with -cache.ttl set
+// they're kept, up to -cache.size of them, and given again rather than
+// phrased afresh. A greeting is kept under everything that went into it: the
+// name as it's greeted, language, method, time of day and tenant, and the
+// version of the templates, so changing a template under /admin/templates or
+// a tenant's under /tenants stops the old greetings being given. The least
+// recently given greetings make way for new ones when the cache is full.
+//
+// Only greetings are kept, not errors. A template with variants is only
+// picked from again once its greeting has left the cache.
+
+// templateVersioner is something greetings are phrased from, whose version
+// changes whenever what they'd be phrased as might.
+type templateVersioner interface {
+	TemplateVersion() uint64
+}
+
+// phraseKey is what a greeting is cached under.
+type phraseKey struct {
+	method, format, name, timeOfDay, lang, tenant string
+	version                                       uint64
+}
+
+type phraseEntry struct {
+	key      phraseKey
+	greeting Greeting
+	expires  time.Time
+}
+
+// cachingProvider is a GreetingProvider that gives the greetings next phrased
+// again for ttl, keeping up to size of them.
+type cachingProvider struct {
+	ttl      time.Duration
+	size     int
+	versions []templateVersioner
+	next     GreetingProvider
+
+	mu      sync.Mutex
+	lru     *list.List // of *phraseEntry, most recently used first
+	entries map[phraseKey]*list.Element
+}
+
+func newCachingProvider(ttl time.Duration, size int, versions []templateVersioner, next GreetingProvider) *cachingProvider {
+	return &cachingProvider{
+		ttl:      ttl,
+		size:     size,
+		versions: versions,
+		next:     next,
+		lru:      list.New(),
+		entries:  map[phraseKey]*list.Element{},
+	}
+}
+
+func (p *cachingProvider) Phrase(r PhraseRequest) (Greeting, error) {
+	key := phraseKey{r.Method, r.Format, r.Name, r.TimeOfDay, r.Language.String(), r.Tenant, 0}
+	// Versions only go up, so neither does their sum unless one has changed.
+	for _, v := range p.versions {
+		key.version += v.TemplateVersion()
+	}
+	now := time.Now()
+	p.mu.Lock()
+	if el, ok := p.entries[key]; ok {
+		e := el.Value.(*phraseEntry)
+		if now.Before(e.expires) {
+			p.lru.MoveToFront(el)
+			p.mu.Unlock()
+			return e.greeting, nil
+		}
+		p.lru.Remove(el)
+		delete(p.entries, key)
+	}
+	p.mu.Unlock()
+
+	g, err := p.next.Phrase(r)
+	if err != nil {
+		return g, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if el, ok := p.entries[key]; ok {
+		// Someone else phrased it meanwhile.
+		p.lru.Remove(el)
+	}
+	p.entries[key] = p.lru.PushFront(&phraseEntry{key, g, now.Add(p.ttl)})
+	for p.lru.Len() > p.size {
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		delete(p.entries, oldest.Value.(*phraseEntry).key)
+	}
+	return g, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// With -canary.provider set, the HTTP greeting endpoints have a second
+// version, a canary, whose greetings that provider phrases. It's the same
+// service otherwise, with the same stores, limits and middlewares. The canary
+// gets -canary.percent of the calls, and every call with the header in
+// -canary.header, like X-Canary=1, so a rollout can start with whoever asks
+// for it and grow from there. Each version's calls are counted and timed, by
+// endpoint and variant, primary or canary, in greet_canary_requests_total and
+// greet_canary_latency_seconds.
+
+// canaryConfig is which calls go to the canary, and where it is.
+type canaryConfig struct {
+	Percent float64
+	Header  string
+	Value   string
+
+	// endpoints are the canary's endpoints, by name, or nil if there's no
+	// canary.
+	endpoints map[string]endpoint.Endpoint
+	requests  metrics.Counter
+	latency   metrics.Histogram
+}
+
+// parseCanaryHeader splits a -canary.header of name=value. A header with no
+// value picks calls whatever they have in it.
+func parseCanaryHeader(s string) (name, value string) {
+	if i := strings.Index(s, "="); i >= 0 {
+		return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+	}
+	return strings.TrimSpace(s), ""
+}
+
+type canaryContextKey int
+
+// canaryKey is the context key that marks a call as asking for the canary.
+const canaryKey canaryContextKey = 0
+
+// toContext returns a kithttp.RequestFunc that marks the requests with the
+// canary header as asking for the canary.
+func (c canaryConfig) toContext() kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if c.Header == "" {
+			return ctx
+		}
+		v, ok := r.Header[http.CanonicalHeaderKey(c.Header)]
+		if !ok || c.Value != "" && v[0] != c.Value {
+			return ctx
+		}
+		return context.WithValue(ctx, canaryKey, true)
+	}
+}
+
+// endpoint returns an endpoint.Middleware that sends calls for the canary to
+// its version of the endpoint called name, rather than next. Without a
+// canary, every call goes to next.
+func (c canaryConfig) endpoint(name string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		canary, ok := c.endpoints[name]
+		if !ok {
+			return next
+		}
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			variant, e := "primary", next
+			if asked, _ := ctx.Value(canaryKey).(bool); asked || rand.Float64()*100 < c.Percent {
+				variant, e = "canary", canary
+			}
+			defer func(begin time.Time) {
+				outcome := "success"
+				if err != nil {
+					outcome = "error"
+				}
+				c.requests.With("endpoint", name, "variant", variant, "outcome", outcome).Add(1)
+				c.latency.With("endpoint", name, "variant", variant).Observe(time.Since(begin).Seconds())
+			}(time.Now())
+			return e(ctx, request)
+		}
+	}
+}
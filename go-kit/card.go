@@ -0,0 +1,123 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg" // card backgrounds can be JPEGs too
+	"os"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// GET /hello/card renders the greeting onto a PNG, for embedding in emails.
+// How the card looks is up to a CardRenderer. The built in one writes the
+// greeting across the middle of a plain card, or of a picture given with
+// -card.background, wrapping it onto more lines if it's too wide.
+
+// A CardRenderer draws a greeting onto a card.
+type CardRenderer interface {
+	Render(greeting string) (image.Image, error)
+}
+
+// cardTemplate is what textCardRenderer draws on and with. Background, if
+// set, replaces the plain card and decides its size.
+type cardTemplate struct {
+	Width, Height int
+	Margin        int
+	Background    image.Image
+	Paper, Ink    color.Color
+	Font          *opentype.Font
+	Size          float64
+}
+
+// goRegular is the Go font, which comes with the package and always parses.
+var goRegular, _ = opentype.Parse(goregular.TTF)
+
+// defaultCardTemplate is dark text on a plain white card.
+var defaultCardTemplate = cardTemplate{
+	Width:  600,
+	Height: 300,
+	Margin: 40,
+	Paper:  color.White,
+	Ink:    color.RGBA{0x33, 0x33, 0x33, 0xff},
+	Font:   goRegular,
+	Size:   36,
+}
+
+// loadCardBackground returns defaultCardTemplate with the PNG or JPEG at path
+// as its background.
+func loadCardBackground(path string) (cardTemplate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return cardTemplate{}, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return cardTemplate{}, err
+	}
+	t := defaultCardTemplate
+	t.Background = img
+	t.Width, t.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	return t, nil
+}
+
+// textCardRenderer is a CardRenderer that centres the greeting on its
+// template.
+type textCardRenderer struct {
+	template cardTemplate
+}
+
+func (r textCardRenderer) Render(greeting string) (image.Image, error) {
+	t := r.template
+	card := image.NewRGBA(image.Rect(0, 0, t.Width, t.Height))
+	if t.Background != nil {
+		draw.Draw(card, card.Bounds(), t.Background, t.Background.Bounds().Min, draw.Src)
+	} else {
+		draw.Draw(card, card.Bounds(), image.NewUniform(t.Paper), image.Point{}, draw.Src)
+	}
+
+	// Faces aren't safe to share, so each card gets its own.
+	face, err := opentype.NewFace(t.Font, &opentype.FaceOptions{Size: t.Size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	d := &font.Drawer{Dst: card, Src: image.NewUniform(t.Ink), Face: face}
+	lines := wrapText(d, greeting, fixed.I(t.Width-2*t.Margin))
+	metrics := face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	y := (t.Height-lineHeight*len(lines))/2 + metrics.Ascent.Ceil()
+	for _, line := range lines {
+		d.Dot = fixed.P((t.Width-d.MeasureString(line).Ceil())/2, y)
+		d.DrawString(line)
+		y += lineHeight
+	}
+	return card, nil
+}
+
+// wrapText breaks text into lines no wider than width, between words. A word
+// that's wider than width on its own gets a line to itself.
+func wrapText(d *font.Drawer, text string, width fixed.Int26_6) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(text) {
+		if line == "" {
+			line = word
+			continue
+		}
+		if d.MeasureString(line+" "+word) > width {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		line += " " + word
+	}
+	return append(lines, line)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Which middlewares the service and the HTTP greeting endpoints are wrapped
+// in, and in what order, is configuration: -middleware.service and
+// -middleware.endpoint are comma separated names, in the order a call passes
+// through them, outermost first. Leaving a name out leaves that middleware
+// out, so metrics, say, can be turned off without touching main:
+//
+//	-middleware.service metrics,tenants,validate,filter,logging
+//
+// The defaults below have every middleware there is, in the order the service
+// has always had them. A name that isn't one of them, or that's there twice,
+// is an error when the service starts.
+
+const (
+	defaultServiceChain  = "metrics,tenants,profiles,stats,validate,aliases,transliterate,filter,webhooks,history,events,logging"
+	defaultEndpointChain = "trace,latency,slow,jwt,apikey,cert,tenant,authorize,ratelimit,validate,singleflight,bulkhead,breaker,timeout,chaos,canary"
+)
+
+// ServiceMiddleware wraps a GreetService in another.
+type ServiceMiddleware func(GreetService) GreetService
+
+// serviceChain is the service middlewares there are, by name.
+type serviceChain map[string]ServiceMiddleware
+
+// build wraps svc in the middlewares named, the first of them outermost.
+func (c serviceChain) build(names []string, svc GreetService) (GreetService, error) {
+	known := make([]string, 0, len(c))
+	for name := range c {
+		known = append(known, name)
+	}
+	if err := checkChain("service", names, known); err != nil {
+		return nil, err
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		svc = c[names[i]](svc)
+	}
+	return svc, nil
+}
+
+// endpointChain is the endpoint middlewares there are, by name. Each makes
+// the middleware for an endpoint, one of timeoutEndpoints, so that endpoints
+// can have their own breakers, bulkheads and spans.
+type endpointChain map[string]func(endpointName string) endpoint.Middleware
+
+// build returns the middleware of the endpoint called endpointName, the
+// middlewares named one inside another, the first of them outermost.
+func (c endpointChain) build(names []string, endpointName string) (endpoint.Middleware, error) {
+	known := make([]string, 0, len(c))
+	for name := range c {
+		known = append(known, name)
+	}
+	if err := checkChain("endpoint", names, known); err != nil {
+		return nil, err
+	}
+	mws := make([]endpoint.Middleware, len(names))
+	for i, name := range names {
+		mws[i] = c[name](endpointName)
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](next)
+		}
+		return next
+	}, nil
+}
+
+// checkChain fails if names has any that aren't known, or any twice.
+func checkChain(kind string, names, known []string) error {
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			return fmt.Errorf("%s middleware %q is in the chain twice", kind, name)
+		}
+		seen[name] = true
+		found := false
+		for _, k := range known {
+			found = found || k == name
+		}
+		if !found {
+			sort.Strings(known)
+			return fmt.Errorf("unknown %s middleware %q, want some of %s", kind, name, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// For resilience drills, the HTTP greeting endpoints can be made to misbehave
+// on purpose. It's off unless -chaos.token is set, and even then only
+// requests with that token in X-Chaos-Token are touched, so a drill against
+// staging doesn't disturb anyone else. Of those, -chaos.latency.rate are held
+// up for -chaos.latency first, -chaos.error.rate fail, and -chaos.drop.rate
+// have their connection dropped without an answer. Rates are fractions, from
+// 0 to 1.
+//
+// The faults are injected innermost, under the timeouts and circuit breakers,
+// so that those see them as they would real ones.
+
+// chaosHeader is the header a request carries the chaos token in.
+const chaosHeader = "X-Chaos-Token"
+
+// errChaos is the error of a call made to fail on purpose.
+var errChaos = errors.New("injected fault")
+
+// chaosConfig is the faults to inject, and how often.
+type chaosConfig struct {
+	Token       string
+	Latency     time.Duration
+	LatencyRate float64
+	ErrorRate   float64
+	DropRate    float64
+}
+
+type chaosContextKey int
+
+// chaosKey is the context key that marks a request as part of a drill.
+const chaosKey chaosContextKey = 0
+
+// toContext returns a kithttp.RequestFunc that marks requests with the right
+// token in X-Chaos-Token as part of a drill.
+func (c chaosConfig) toContext() kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		token := r.Header.Get(chaosHeader)
+		if c.Token == "" || token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(c.Token)) != 1 {
+			return ctx
+		}
+		return context.WithValue(ctx, chaosKey, true)
+	}
+}
+
+// endpoint returns the chaosEndpoint middleware, or one that does nothing if
+// there's no token. The name is unused, as every endpoint gets the same
+// faults.
+func (c chaosConfig) endpoint(string) endpoint.Middleware {
+	if c.Token == "" {
+		return func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	}
+	return chaosEndpoint(c)
+}
+
+// chaosEndpoint returns an endpoint.Middleware that injects c's faults into
+// the calls toContext marked.
+func chaosEndpoint(c chaosConfig) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if drill, _ := ctx.Value(chaosKey).(bool); !drill {
+				return next(ctx, request)
+			}
+			if rand.Float64() < c.LatencyRate {
+				select {
+				case <-time.After(c.Latency):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+			if rand.Float64() < c.DropRate {
+				// net/http closes the connection without answering.
+				panic(http.ErrAbortHandler)
+			}
+			if rand.Float64() < c.ErrorRate {
+				return nil, errChaos
+			}
+			return next(ctx, request)
+		}
+	}
+}
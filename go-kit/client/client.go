@@ -0,0 +1,138 @@
+// Package client provides a Go client for the greeting service, speaking to
+// its HTTP transport. It's what cmd/greetctl uses, and other Go programs can
+// use it too instead of hand-rolling JSON requests.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// Service mirrors the GreetService interface implemented by the server.
+type Service interface {
+	Hello(string) (string, error)
+}
+
+// Endpoints collects the client-side endpoints for each method, and
+// implements Service by calling them.
+type Endpoints struct {
+	HelloEndpoint endpoint.Endpoint
+}
+
+// An Option changes how New's Service calls the server.
+type Option func(*options)
+
+type options struct {
+	retry *RetryPolicy
+}
+
+// WithRetry has calls that fail retried following p. Hellos are sent with an
+// Idempotency-Key, so a retry never greets anyone twice.
+func WithRetry(p RetryPolicy) Option {
+	return func(o *options) { o.retry = &p }
+}
+
+// New returns a Service backed by the HTTP server living at instance, which
+// is usually of the form "host:port".
+func New(instance string, opts ...Option) (Service, error) {
+	if !strings.HasPrefix(instance, "http") {
+		instance = "http://" + instance
+	}
+	u, err := url.Parse(instance)
+	if err != nil {
+		return nil, err
+	}
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	hello := kithttp.NewClient(
+		"POST",
+		copyURL(u, "/hello"),
+		encodeJSONRequest,
+		decodeHelloResponse,
+		kithttp.ClientBefore(setIdempotencyKey),
+	).Endpoint()
+	if o.retry != nil {
+		hello = newIdempotencyKey(Retry(*o.retry, false)(hello))
+	}
+	return Endpoints{
+		HelloEndpoint: hello,
+	}, nil
+}
+
+// Hello implements Service.
+func (e Endpoints) Hello(name string) (string, error) {
+	response, err := e.HelloEndpoint(context.Background(), helloRequest{Name: name})
+	if err != nil {
+		return "", err
+	}
+	resp := response.(helloResponse)
+	if resp.Err != "" {
+		return "", errors.New(resp.Err)
+	}
+	return resp.Greeting, nil
+}
+
+// These mirror the request and response structs on the server.
+
+type helloRequest struct {
+	Name string `json:"name,omitempty"`
+}
+
+type helloResponse struct {
+	Greeting string
+	Err      string
+}
+
+func encodeJSONRequest(_ context.Context, r *http.Request, request interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(request); err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Body = ioutil.NopCloser(&buf)
+	return nil
+}
+
+func decodeHelloResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	if err := checkStatus(r); err != nil {
+		return nil, err
+	}
+	var body struct {
+		Greeting string          `json:"greeting"`
+		Err      json.RawMessage `json:"err"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	// The server doesn't yet send a useful description of its errors, so
+	// all we can tell is whether there was one.
+	resp := helloResponse{Greeting: body.Greeting}
+	if len(body.Err) > 0 && string(body.Err) != "null" {
+		var msg string
+		if err := json.Unmarshal(body.Err, &msg); err != nil || msg == "" {
+			msg = "greeting failed"
+		}
+		resp.Err = msg
+	}
+	return resp, nil
+}
+
+func copyURL(base *url.URL, path string) *url.URL {
+	next := *base
+	next.Path = path
+	return &next
+}
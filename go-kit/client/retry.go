@@ -0,0 +1,162 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// RetryPolicy says how calls that fail are retried. Each retry waits twice as
+// long as the one before, starting at BaseDelay and going no higher than
+// MaxDelay, less a random part of up to Jitter of it, so clients that failed
+// together don't all come back at once. A server that says how long to wait,
+// with a Retry-After, is waited for at least that long.
+type RetryPolicy struct {
+	// MaxAttempts is the most times a call is made, counting the first.
+	// Less than 2 means calls aren't retried.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Jitter is between 0, for no randomness, and 1.
+	Jitter float64
+}
+
+// DefaultRetryPolicy makes a call up to 4 times over about a second.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+	Jitter:      0.2,
+}
+
+// delay is how long to wait before the retry after attempt.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d - time.Duration(p.Jitter*mathrand.Float64()*float64(d))
+}
+
+// Retry returns an endpoint.Middleware that retries calls following p, when
+// they fail in a way that's worth trying again: the server couldn't be
+// reached, or answered 429, 502, 503 or 504.
+//
+// Only calls that are safe to make twice are retried. idempotent says
+// whether every call to the endpoint is; otherwise a call has to carry an
+// Idempotency-Key, from WithIdempotencyKey, for the server to know a retry
+// for what it is.
+func Retry(p RetryPolicy, idempotent bool) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			safe := idempotent || idempotencyKey(ctx) != ""
+			for attempt := 1; ; attempt++ {
+				response, err := next(ctx, request)
+				if err == nil || !safe || attempt >= p.MaxAttempts {
+					return response, err
+				}
+				wait, ok := retryable(err)
+				if !ok {
+					return response, err
+				}
+				if d := p.delay(attempt); d > wait {
+					wait = d
+				}
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+		}
+	}
+}
+
+// retryable says whether a call that failed with err is worth retrying, and
+// how long the server asked to be left alone for, if it did.
+func retryable(err error) (time.Duration, bool) {
+	switch e := err.(type) {
+	case *url.Error:
+		// The server couldn't be reached, or didn't answer.
+		return 0, true
+	case statusError:
+		return e.retryAfter, true
+	}
+	return 0, false
+}
+
+// statusError is a response with a status that's worth retrying.
+type statusError struct {
+	status     string
+	retryAfter time.Duration
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("greeting service answered %s", e.status)
+}
+
+// checkStatus returns a statusError for responses with a status that's worth
+// retrying.
+func checkStatus(r *http.Response) error {
+	switch r.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		err := statusError{status: r.Status}
+		if secs, perr := strconv.Atoi(r.Header.Get("Retry-After")); perr == nil && secs > 0 {
+			err.retryAfter = time.Duration(secs) * time.Second
+		}
+		return err
+	}
+	return nil
+}
+
+type contextKey int
+
+const idempotencyKeyKey contextKey = iota
+
+// WithIdempotencyKey returns a context that makes calls with the
+// Idempotency-Key key, so the server answers a retried call with the
+// response it gave the first time, rather than greeting twice.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey, key)
+}
+
+func idempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyKey).(string)
+	return key
+}
+
+// setIdempotencyKey is a kithttp.RequestFunc that sends the context's
+// Idempotency-Key, if it has one.
+func setIdempotencyKey(ctx context.Context, r *http.Request) context.Context {
+	if key := idempotencyKey(ctx); key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+	return ctx
+}
+
+// newIdempotencyKey is an endpoint.Middleware that gives calls without an
+// Idempotency-Key a random one, so their retries can be recognised.
+func newIdempotencyKey(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if idempotencyKey(ctx) == "" {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				return nil, err
+			}
+			ctx = WithIdempotencyKey(ctx, hex.EncodeToString(b))
+		}
+		return next(ctx, request)
+	}
+}
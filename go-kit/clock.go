@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Clock tells the time. greetService asks one instead of calling time.Now,
+// so that tests can pick the time of day.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock on the wall.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// timeOfDay names the part of the day t falls in.
+func timeOfDay(t time.Time) string {
+	switch h := t.Hour(); {
+	case h < 12:
+		return "morning"
+	case h < 18:
+		return "afternoon"
+	default:
+		return "evening"
+	}
+}
+
+// parseLocation accepts either an IANA time zone name, like Europe/Paris, or
+// an offset from UTC, like +02:00, -0530 or +9.
+func parseLocation(s string) (*time.Location, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if s[0] != '+' && s[0] != '-' {
+		return time.LoadLocation(s)
+	}
+
+	hours, minutes := s[1:], "0"
+	if i := strings.Index(hours, ":"); i >= 0 {
+		hours, minutes = hours[:i], hours[i+1:]
+	} else if len(hours) == 4 {
+		hours, minutes = hours[:2], hours[2:]
+	}
+	h, err := strconv.Atoi(hours)
+	if err != nil || h < 0 || h > 14 {
+		return nil, fmt.Errorf("invalid UTC offset %q", s)
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil || m < 0 || m > 59 {
+		return nil, fmt.Errorf("invalid UTC offset %q", s)
+	}
+	offset := h*60*60 + m*60
+	if s[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone("UTC"+s, offset), nil
+}
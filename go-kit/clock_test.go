@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// fakeClock is a Clock stopped at a time.
+type fakeClock time.Time
+
+func (c fakeClock) Now() time.Time { return time.Time(c) }
+
+func TestTimeOfDay(t *testing.T) {
+	for _, tc := range []struct {
+		hour, minute int
+		want         string
+	}{
+		{0, 0, "morning"},
+		{11, 59, "morning"},
+		{12, 0, "afternoon"},
+		{17, 59, "afternoon"},
+		{18, 0, "evening"},
+		{23, 59, "evening"},
+	} {
+		at := time.Date(2017, 3, 1, tc.hour, tc.minute, 0, 0, time.UTC)
+		if got := timeOfDay(at); got != tc.want {
+			t.Errorf("timeOfDay(%02d:%02d) = %q, want %q", tc.hour, tc.minute, got, tc.want)
+		}
+	}
+}
+
+func TestHelloByTimeOfDay(t *testing.T) {
+	for _, tc := range []struct {
+		utc      string
+		location string
+		want     string
+	}{
+		{"11:59", "", "Good morning, Ada"},
+		{"12:00", "", "Good afternoon, Ada"},
+		{"17:59", "", "Good afternoon, Ada"},
+		{"18:00", "", "Good evening, Ada"},
+		{"10:00", "+02:00", "Good afternoon, Ada"},
+		{"09:59", "+02:00", "Good morning, Ada"},
+		{"20:00", "-0530", "Good afternoon, Ada"},
+		{"23:30", "-0530", "Good evening, Ada"},
+		{"03:00", "+9", "Good afternoon, Ada"},
+		{"20:00", "-14", "Good morning, Ada"},
+		{"12:00", "Asia/Tokyo", "Good evening, Ada"},
+	} {
+		at, err := time.Parse("2006-01-02 15:04", "2017-03-01 "+tc.utc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loc, err := parseLocation(tc.location)
+		if err != nil {
+			t.Fatalf("parseLocation(%q): %v", tc.location, err)
+		}
+		svc := greetService{clock: fakeClock(at), byTimeOfDay: true}
+		g, err := svc.Hello(context.Background(), "ada", GreetOptions{Location: loc})
+		if err != nil {
+			t.Fatalf("%s UTC in %q: %v", tc.utc, tc.location, err)
+		}
+		if g.Text != tc.want {
+			t.Errorf("%s UTC in %q: got %q, want %q", tc.utc, tc.location, g.Text, tc.want)
+		}
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	for _, tc := range []struct {
+		s      string
+		offset int
+		err    bool
+	}{
+		{"+02:00", 2 * 60 * 60, false},
+		{"-0530", -(5*60 + 30) * 60, false},
+		{"+9", 9 * 60 * 60, false},
+		{"+14", 14 * 60 * 60, false},
+		{"+15", 0, true},
+		{"+02:60", 0, true},
+		{"-ab", 0, true},
+	} {
+		loc, err := parseLocation(tc.s)
+		if tc.err {
+			if err == nil {
+				t.Errorf("parseLocation(%q): want an error", tc.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseLocation(%q): %v", tc.s, err)
+			continue
+		}
+		if _, offset := time.Date(2017, 3, 1, 0, 0, 0, 0, loc).Zone(); offset != tc.offset {
+			t.Errorf("parseLocation(%q) is %ds from UTC, want %ds", tc.s, offset, tc.offset)
+		}
+	}
+}
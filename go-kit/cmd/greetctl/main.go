@@ -0,0 +1,117 @@
+package main
+
+// greetctl is a small command line client for the greeting service, handy for
+// smoke checks and scripts:
+//
+//	greetctl hello --name alice --addr localhost:8080
+//	greetctl hello --name alice --name bob --output json
+//	greetctl hello --name alice --retries 3
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/naunga/monolith/go-kit/client"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "hello":
+		os.Exit(hello(os.Args[2:]))
+	case "help", "-h", "--help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "greetctl: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: greetctl <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "commands:")
+	fmt.Fprintln(os.Stderr, "  hello    greet one or more names")
+}
+
+// names collects every --name flag, so several people can be greeted at once.
+type names []string
+
+func (n *names) String() string     { return strings.Join(*n, ",") }
+func (n *names) Set(v string) error { *n = append(*n, v); return nil }
+
+// result is one line of output: a name and either its greeting or an error.
+type result struct {
+	Name     string `json:"name"`
+	Greeting string `json:"greeting,omitempty"`
+	Err      string `json:"err,omitempty"`
+}
+
+func hello(args []string) int {
+	fs := flag.NewFlagSet("hello", flag.ExitOnError)
+	var (
+		addr    = fs.String("addr", "localhost:8080", "address of the greeting service")
+		output  = fs.String("output", "table", "output format: table or json")
+		retries = fs.Int("retries", 0, "times to retry a greeting the service couldn't give")
+		who     names
+	)
+	fs.Var(&who, "name", "name to greet; may be repeated")
+	fs.Parse(args)
+
+	if len(who) == 0 {
+		fmt.Fprintln(os.Stderr, "greetctl hello: at least one --name is required")
+		return 2
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "greetctl hello: unknown output format %q\n", *output)
+		return 2
+	}
+
+	var opts []client.Option
+	if *retries > 0 {
+		p := client.DefaultRetryPolicy
+		p.MaxAttempts = *retries + 1
+		opts = append(opts, client.WithRetry(p))
+	}
+	svc, err := client.New(*addr, opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "greetctl hello: %v\n", err)
+		return 1
+	}
+
+	status := 0
+	results := make([]result, 0, len(who))
+	for _, name := range who {
+		r := result{Name: name}
+		if r.Greeting, err = svc.Hello(name); err != nil {
+			r.Err = err.Error()
+			status = 1
+		}
+		results = append(results, r)
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range results {
+			enc.Encode(r)
+		}
+		return status
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tGREETING\tERROR")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Name, r.Greeting, r.Err)
+	}
+	tw.Flush()
+	return status
+}
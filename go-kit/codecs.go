@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/ugorji/go/codec"
+
+	"github.com/naunga/monolith/go-kit/pb"
+)
+
+// The /hello HTTP transport speaks several encodings besides JSON. Each one is
+// an httpCodec registered under the media types it answers to, so supporting
+// another encoding only means registering it here.
+
+// An httpCodec decodes hello requests from, and encodes hello responses to, a
+// single media type.
+type httpCodec struct {
+	mediaType string
+	decode    func(io.Reader) (interface{}, error)
+	encode    func(io.Writer, helloResponse) error
+
+	// binary is set for encodings that aren't text, which transports such as
+	// API Gateway have to base64 encode.
+	binary bool
+}
+
+// A codecRegistry maps media types to the codecs that handle them.
+type codecRegistry map[string]*httpCodec
+
+// register adds c under its own media type and any aliases. Replies always use
+// c.mediaType, whichever alias the client sent.
+func (reg codecRegistry) register(c *httpCodec, aliases ...string) {
+	reg[c.mediaType] = c
+	for _, alias := range aliases {
+		reg[alias] = c
+	}
+}
+
+// lookup returns the codec for a Content-Type or Accept value, if any.
+func (reg codecRegistry) lookup(header string) (*httpCodec, bool) {
+	c, ok := reg[mediaType(header)]
+	return c, ok
+}
+
+const (
+	mediaTypeJSON     = "application/json"
+	mediaTypeProtobuf = "application/x-protobuf"
+	mediaTypeMsgpack  = "application/msgpack"
+	mediaTypeXML      = "application/xml"
+	mediaTypeCBOR     = "application/cbor"
+)
+
+// jsonCodec is the default, used whenever the client doesn't ask for anything
+// we know.
+var jsonCodec = &httpCodec{
+	mediaType: mediaTypeJSON,
+	decode:    decodeHelloJSON,
+	encode: func(w io.Writer, resp helloResponse) error {
+		return json.NewEncoder(w).Encode(resp)
+	},
+}
+
+var httpCodecs = codecRegistry{}
+
+func init() {
+	httpCodecs.register(jsonCodec)
+	httpCodecs.register(&httpCodec{
+		mediaType: mediaTypeProtobuf,
+		decode:    decodeHelloProtobuf,
+		encode: func(w io.Writer, resp helloResponse) error {
+			b, err := proto.Marshal(&pb.HelloReply{Greeting: resp.Greeting, Err: err2str(resp.Err)})
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(b)
+			return err
+		},
+		binary: true,
+	})
+	httpCodecs.register(&httpCodec{
+		mediaType: mediaTypeXML,
+		decode:    decodeHelloXML,
+		encode: func(w io.Writer, resp helloResponse) error {
+			start := xml.StartElement{Name: xml.Name{Local: "helloResponse"}}
+			return xml.NewEncoder(w).EncodeElement(newHelloReply(resp), start)
+		},
+	}, "text/xml")
+	httpCodecs.register(ugorjiCodec(mediaTypeMsgpack, &codec.MsgpackHandle{}))
+	httpCodecs.register(ugorjiCodec(mediaTypeCBOR, &codec.CborHandle{}))
+}
+
+// helloReply is a helloResponse with its error flattened to a string, for
+// encodings that can't carry a Go error value.
+type helloReply struct {
+	Greeting       string `json:"greeting,omitempty" xml:"greeting,omitempty"`
+	Transliterated string `json:"transliterated,omitempty" xml:"transliterated,omitempty"`
+	Err            string `json:"err,omitempty" xml:"err,omitempty"`
+}
+
+func newHelloReply(resp helloResponse) helloReply {
+	return helloReply{Greeting: resp.Greeting, Transliterated: resp.Transliterated, Err: err2str(resp.Err)}
+}
+
+// MarshalJSON marshals resp as a helloReply, for the transports that send it
+// as it is, since its error, an interface, would be marshalled as {}.
+func (resp helloResponse) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newHelloReply(resp))
+}
+
+// decodeHelloJSON reads a JSON hello request from any reader, so transports
+// that aren't plain HTTP requests can share it.
+func decodeHelloJSON(r io.Reader) (interface{}, error) {
+	var request helloRequest
+	if err := decodeJSON(r, &request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeHelloProtobuf(r io.Reader) (interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var req pb.HelloRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return nil, err
+	}
+	return newHelloRequest(&req), nil
+}
+
+// newHelloRequest returns req, a protobuf hello request, as a helloRequest.
+func newHelloRequest(req *pb.HelloRequest) helloRequest {
+	return helloRequest{
+		Name:          req.Name,
+		Lang:          req.Lang,
+		TZ:            req.Tz,
+		PreserveCase:  req.PreserveCase,
+		UserID:        req.UserId,
+		Formality:     req.Formality,
+		Title:         req.Title,
+		NoAlias:       req.NoAlias,
+		Transliterate: req.Transliterate,
+	}
+}
+
+// decodeHelloXML ignores the name of the root element, so callers may send
+// <hello> or <helloRequest> as they prefer.
+func decodeHelloXML(r io.Reader) (interface{}, error) {
+	var request helloRequest
+	if err := xml.NewDecoder(r).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// ugorjiCodec builds a codec from one of the ugorji/go handles, such as
+// MessagePack or CBOR. They read the same json struct tags as encoding/json.
+func ugorjiCodec(mt string, h codec.Handle) *httpCodec {
+	return &httpCodec{
+		mediaType: mt,
+		decode: func(r io.Reader) (interface{}, error) {
+			var request helloRequest
+			if err := codec.NewDecoder(r, h).Decode(&request); err != nil {
+				return nil, err
+			}
+			return request, nil
+		},
+		encode: func(w io.Writer, resp helloResponse) error {
+			return codec.NewEncoder(w, h).Encode(newHelloReply(resp))
+		},
+		binary: true,
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/ugorji/go/codec"
+
+	"github.com/naunga/monolith/go-kit/pb"
+)
+
+func TestCodecs(t *testing.T) {
+	ugorji := func(h codec.Handle) (func() []byte, func([]byte) (helloReply, error)) {
+		return func() []byte {
+				var b []byte
+				codec.NewEncoderBytes(&b, h).Encode(helloRequest{Name: "Ada"})
+				return b
+			}, func(b []byte) (helloReply, error) {
+				var reply helloReply
+				err := codec.NewDecoderBytes(b, h).Decode(&reply)
+				return reply, err
+			}
+	}
+	msgpackRequest, msgpackReply := ugorji(&codec.MsgpackHandle{})
+	cborRequest, cborReply := ugorji(&codec.CborHandle{})
+
+	for _, tc := range []struct {
+		contentType string
+		mediaType   string
+		request     func() []byte
+		reply       func([]byte) (helloReply, error)
+	}{
+		{
+			"application/json; charset=utf-8", mediaTypeJSON,
+			func() []byte { return []byte(`{"name": "Ada"}`) },
+			func(b []byte) (helloReply, error) {
+				var reply helloReply
+				err := json.Unmarshal(b, &reply)
+				return reply, err
+			},
+		},
+		{
+			"application/x-protobuf", mediaTypeProtobuf,
+			func() []byte {
+				b, _ := proto.Marshal(&pb.HelloRequest{Name: "Ada"})
+				return b
+			},
+			func(b []byte) (helloReply, error) {
+				var reply pb.HelloReply
+				err := proto.Unmarshal(b, &reply)
+				return helloReply{Greeting: reply.Greeting, Err: reply.Err}, err
+			},
+		},
+		{
+			"text/xml", mediaTypeXML,
+			func() []byte { return []byte(`<hello><name>Ada</name></hello>`) },
+			func(b []byte) (helloReply, error) {
+				var reply helloReply
+				err := xml.Unmarshal(b, &reply)
+				return reply, err
+			},
+		},
+		{"application/msgpack", mediaTypeMsgpack, msgpackRequest, msgpackReply},
+		{"Application/CBOR", mediaTypeCBOR, cborRequest, cborReply},
+	} {
+		c, ok := httpCodecs.lookup(tc.contentType)
+		if !ok {
+			t.Errorf("%s: no codec", tc.contentType)
+			continue
+		}
+		if c.mediaType != tc.mediaType {
+			t.Errorf("%s: codec for %s, want %s", tc.contentType, c.mediaType, tc.mediaType)
+		}
+
+		request, err := c.decode(bytes.NewReader(tc.request()))
+		if err != nil {
+			t.Errorf("%s: decoding: %v", tc.contentType, err)
+		} else if request.(helloRequest).Name != "Ada" {
+			t.Errorf("%s: decoded %+v", tc.contentType, request)
+		}
+
+		for _, resp := range []helloResponse{
+			{Greeting: "Hello, Ada"},
+			{Err: errors.New("no name provided")},
+		} {
+			var buf bytes.Buffer
+			if err := c.encode(&buf, resp); err != nil {
+				t.Errorf("%s: encoding: %v", tc.contentType, err)
+				continue
+			}
+			reply, err := tc.reply(buf.Bytes())
+			if err != nil {
+				t.Errorf("%s: decoding the reply: %v", tc.contentType, err)
+				continue
+			}
+			if want := newHelloReply(resp); reply != want {
+				t.Errorf("%s: replied %+v, want %+v", tc.contentType, reply, want)
+			}
+		}
+	}
+}
+
+func TestCodecLookupUnknown(t *testing.T) {
+	for _, header := range []string{"", "text/plain", "application/yaml"} {
+		if c, ok := httpCodecs.lookup(header); ok {
+			t.Errorf("lookup(%q) = %s, want none", header, c.mediaType)
+		}
+	}
+}
+
+func TestDecodeHelloProtobufOptions(t *testing.T) {
+	want := helloRequest{
+		Name:          "Ada",
+		Lang:          "de",
+		TZ:            "Europe/Berlin",
+		PreserveCase:  true,
+		UserID:        "ada",
+		Formality:     "formal",
+		Title:         "Dr",
+		NoAlias:       true,
+		Transliterate: true,
+	}
+	b, _ := proto.Marshal(&pb.HelloRequest{
+		Name:          "Ada",
+		Lang:          "de",
+		Tz:            "Europe/Berlin",
+		PreserveCase:  true,
+		UserId:        "ada",
+		Formality:     "formal",
+		Title:         "Dr",
+		NoAlias:       true,
+		Transliterate: true,
+	})
+	got, err := decodeHelloProtobuf(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("decoded %+v, want %+v", got, want)
+	}
+}
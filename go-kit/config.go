@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Every flag can be set in the environment instead, as GREET_ followed by
+// its name in upper case with dots and dashes as underscores: -http.addr is
+// GREET_HTTP_ADDR, and -ratelimit.rps GREET_RATELIMIT_RPS. A flag on the
+// command line wins over the environment.
+//
+// The flags are checked before anything starts, and every one that's wrong
+// is reported at once, rather than just the first.
+
+const envPrefix = "GREET_"
+
+// flagEnv returns the environment variable the flag called name can be set
+// in.
+func flagEnv(name string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(name))
+}
+
+// setFlagsFromEnv sets each of fs's flags that wasn't set on the command
+// line from its environment variable, if there is one. fs must have been
+// parsed.
+func setFlagsFromEnv(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var errs configErrors
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] {
+			return
+		}
+		env := flagEnv(f.Name)
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			errs.add("invalid value %q for %s (-%s): %v", value, env, f.Name, err)
+		}
+	})
+	return errs.err()
+}
+
+// configErrors collects what's wrong with the configuration, to report it
+// all at once.
+type configErrors []string
+
+// add records a problem.
+func (e *configErrors) add(format string, args ...interface{}) {
+	*e = append(*e, fmt.Sprintf(format, args...))
+}
+
+// check records a problem if ok is false.
+func (e *configErrors) check(ok bool, format string, args ...interface{}) {
+	if !ok {
+		e.add(format, args...)
+	}
+}
+
+// err returns the problems as one error, or nil if there are none.
+func (e configErrors) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("invalid configuration: %s", e[0])
+	}
+	return fmt.Errorf("invalid configuration:\n\t%s", strings.Join(e, "\n\t"))
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+	"sigs.k8s.io/yaml"
+
+	log "github.com/go-kit/kit/log"
+)
+
+// With -config, the service reads its settings from a YAML file as well,
+// keyed by flag name, along with greeting templates as -greet.templates has
+// them:
+//
+//	http.addr: ":8080"
+//	log.level: debug
+//	ratelimit.rps: 50
+//	templates:
+//	  hello:
+//	    en: "Hello, {{.Name}}!"
+//
+// A flag on the command line, or in the environment, wins over the file.
+//
+// The file is checked for changes every -config.interval, and read again on
+// a SIGHUP, see reload.go, and the settings that don't need a restart,
+// log.level, log.sample, ratelimit.rps, ratelimit.burst and the templates,
+// change as soon as it does. A template that's changed in the file is stored
+// as a new version of it, as though it had been PUT under /admin/templates;
+// one taken out of the file is left as it is. Changes to anything else are
+// logged, and wait for a restart. A file that doesn't parse, or has a
+// setting that's wrong, is logged and changes nothing.
+
+// reloadableFlags are the flags a config file can change while the service
+// runs.
+var reloadableFlags = []string{"log.level", "log.sample", "ratelimit.rps", "ratelimit.burst"}
+
+// configFile is what a config file says.
+type configFile struct {
+	// Flags is the value of each flag the file sets, as it would be given on
+	// the command line.
+	Flags     map[string]string
+	Templates map[string]map[string]rawVariants
+}
+
+// readConfigFile reads the config file at path.
+func readConfigFile(path string) (configFile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return configFile{}, err
+	}
+	j, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return configFile{}, fmt.Errorf("%s: %v", path, err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(j, &raw); err != nil {
+		return configFile{}, fmt.Errorf("%s: %v", path, err)
+	}
+	c := configFile{Flags: map[string]string{}}
+	for name, value := range raw {
+		if name == "templates" {
+			if err := json.Unmarshal(value, &c.Templates); err != nil {
+				return configFile{}, fmt.Errorf("%s: templates: %v", path, err)
+			}
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(value, &v); err != nil {
+			return configFile{}, fmt.Errorf("%s: %s: %v", path, name, err)
+		}
+		switch v := v.(type) {
+		case string:
+			c.Flags[name] = v
+		case float64, bool:
+			c.Flags[name] = string(value)
+		default:
+			return configFile{}, fmt.Errorf("%s: %s must be a string, number or boolean", path, name)
+		}
+	}
+	return c, nil
+}
+
+// setFlagsFromFile sets each of fs's flags that isn't set already from c.
+func setFlagsFromFile(fs *flag.FlagSet, c configFile) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var errs configErrors
+	for name, value := range c.Flags {
+		if fs.Lookup(name) == nil {
+			errs.add("unknown setting %s in the config file", name)
+			continue
+		}
+		if set[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			errs.add("invalid value %q for %s in the config file: %v", value, name, err)
+		}
+	}
+	return errs.err()
+}
+
+// liveConfig is the settings a config file can change while the service
+// runs.
+type liveConfig struct {
+	path      string
+	logs      *logSettings
+	limiter   *rate.Limiter
+	templates *templateStore
+	logger    log.Logger
+
+	// flags is the value each of the reloadableFlags has when the file
+	// doesn't say, and fixed the flags set on the command line or in the
+	// environment, which the file can't change.
+	flags map[string]string
+	fixed map[string]bool
+
+	mu sync.Mutex
+	// applied is the value of each of the reloadableFlags in force.
+	applied map[string]string
+	last    configFile
+}
+
+// newLiveConfig returns a liveConfig for the file at path, taking what
+// the reloadableFlags are without it from fs. It has to be called before
+// the file's flags are set in fs.
+func newLiveConfig(path string, fs *flag.FlagSet) *liveConfig {
+	c := &liveConfig{path: path, flags: map[string]string{}, fixed: map[string]bool{}, applied: map[string]string{}}
+	fs.Visit(func(f *flag.Flag) { c.fixed[f.Name] = true })
+	for _, name := range reloadableFlags {
+		c.flags[name] = fs.Lookup(name).Value.String()
+		c.applied[name] = c.flags[name]
+	}
+	return c
+}
+
+// apply puts file's settings in force. If any of them is wrong, none of them
+// are.
+func (c *liveConfig) apply(file configFile) error {
+	apply, err := c.prepare(file)
+	if err != nil {
+		return err
+	}
+	_, err = apply()
+	return err
+}
+
+// prepare checks file's settings, and returns a func that puts them in force
+// and says which of them changed.
+func (c *liveConfig) prepare(file configFile) (func() ([]string, error), error) {
+	value := func(name string) string {
+		if v, ok := file.Flags[name]; ok && !c.fixed[name] {
+			return v
+		}
+		return c.flags[name]
+	}
+	var errs configErrors
+	level, err := parseLogLevel(value("log.level"))
+	if err != nil {
+		errs.add("log.level: %v", err)
+	}
+	sample, err := strconv.ParseFloat(value("log.sample"), 64)
+	errs.check(err == nil && sample >= 0 && sample <= 1, "log.sample must be between 0 and 1")
+	rps, err := strconv.ParseFloat(value("ratelimit.rps"), 64)
+	errs.check(err == nil && rps >= 0, "ratelimit.rps must be a number, and can't be negative")
+	burst, err := strconv.Atoi(value("ratelimit.burst"))
+	errs.check(err == nil && burst >= 0, "ratelimit.burst must be a whole number, and can't be negative")
+	if err := checkTemplates(file.Templates); err != nil {
+		errs.add("templates: %v", err)
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	return func() ([]string, error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		var changed []string
+		for _, name := range reloadableFlags {
+			if v := value(name); v != c.applied[name] {
+				changed = append(changed, fmt.Sprintf("%s %s -> %s", name, c.applied[name], v))
+				c.applied[name] = v
+			}
+		}
+		c.logs.Store(level, sample)
+		setRateLimit(c.limiter, rps, burst)
+		templates, err := c.templates.putChanged(file.Templates, c.last.Templates)
+		changed = append(changed, templates...)
+		if err != nil {
+			return changed, fmt.Errorf("templates: %v", err)
+		}
+		c.last = file
+		return changed, nil
+	}, nil
+}
+
+// watch checks the file for changes every interval until ctx is done,
+// applying them as it finds them.
+func (c *liveConfig) watch(ctx context.Context, interval time.Duration) {
+	var modTime time.Time
+	if fi, err := os.Stat(c.path); err == nil {
+		modTime = fi.ModTime()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fi, err := os.Stat(c.path)
+		if err != nil {
+			c.logger.Log("msg", "config file", "err", err)
+			continue
+		}
+		if fi.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = fi.ModTime()
+		c.reload()
+	}
+}
+
+// reload reads the file again and applies it.
+func (c *liveConfig) reload() {
+	apply, err := c.prepareReload()
+	if err != nil {
+		c.logger.Log("msg", "config file not reloaded", "err", err)
+		return
+	}
+	changed, err := apply()
+	if err != nil {
+		c.logger.Log("msg", "config file partly reloaded", "changed", describeChanges(changed), "err", err)
+		return
+	}
+	c.logger.Log("msg", "config file reloaded", "path", c.path, "changed", describeChanges(changed))
+}
+
+// prepareReload implements reloadable, reading the file again, and logging
+// the changes to it that need a restart.
+func (c *liveConfig) prepareReload() (func() ([]string, error), error) {
+	file, err := readConfigFile(c.path)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	last := c.last
+	c.mu.Unlock()
+	reloadable := map[string]bool{}
+	for _, name := range reloadableFlags {
+		reloadable[name] = true
+	}
+	for name, value := range file.Flags {
+		if !reloadable[name] && !c.fixed[name] && last.Flags[name] != value {
+			c.logger.Log("msg", "config file setting needs a restart", "setting", name, "value", value)
+		}
+	}
+	for name, value := range last.Flags {
+		if _, ok := file.Flags[name]; !ok && !reloadable[name] && !c.fixed[name] {
+			c.logger.Log("msg", "config file setting needs a restart", "setting", name, "was", value)
+		}
+	}
+	apply, err := c.prepare(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", c.path, err)
+	}
+	return apply, nil
+}
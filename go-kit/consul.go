@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+
+	log "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	consulsd "github.com/go-kit/kit/sd/consul"
+)
+
+// With -consul.addr set, the service registers itself with the Consul agent
+// there, see register.go, which checks its health every
+// -consul.check.interval. An instance that's been failing its check for
+// consulDeregisterAfter, because it died without deregistering, say, is
+// taken out of the catalog by Consul itself.
+
+// consulDeregisterAfter is how long an instance can fail its check before
+// Consul deregisters it.
+const consulDeregisterAfter = time.Minute
+
+// newConsulRegistrar returns an sd.Registrar of instance with the Consul
+// agent at addr, which checks its health every interval.
+func newConsulRegistrar(addr string, instance serviceInstance, interval time.Duration, logger log.Logger) (sd.Registrar, error) {
+	config := consulapi.DefaultConfig()
+	config.Address = addr
+	client, err := consulapi.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(instance.Port)
+	if err != nil {
+		return nil, err
+	}
+	return consulsd.NewRegistrar(consulsd.NewClient(client), &consulapi.AgentServiceRegistration{
+		ID:      instance.ID,
+		Name:    instance.Name,
+		Address: instance.Host,
+		Port:    port,
+		Tags:    instance.Tags,
+		Check: &consulapi.AgentServiceCheck{
+			HTTP:                           instance.Check,
+			Interval:                       interval.String(),
+			Timeout:                        interval.String(),
+			DeregisterCriticalServiceAfter: consulDeregisterAfter.String(),
+		},
+	}, log.With(logger, "registry", "consul")), nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// With -cors.origins set, browsers can call the paths in -cors.paths, the
+// public ones by default, from pages on those origins, or any origin if it's
+// *. Preflight requests are answered with -cors.methods, -cors.headers and
+// -cors.maxage, without going any further. /admin/, /tenants and the rest of
+// what isn't in -cors.paths stay same-origin only.
+//
+// Credentials, like cookies, aren't allowed, so an Authorization or X-API-Key
+// header has to be set by the page itself.
+
+// corsExposed are the response headers pages can read.
+var corsExposed = []string{requestIDHeader, "Retry-After", "Content-Language"}
+
+// corsConfig is who can call which paths cross-origin. No Origins means
+// nobody can.
+type corsConfig struct {
+	Origins []string
+	Methods []string
+	Headers []string
+	MaxAge  time.Duration
+	Paths   []string
+}
+
+// allows says whether a page on origin can call.
+func (c corsConfig) allows(origin string) bool {
+	for _, o := range c.Origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsHandler answers preflight requests, and marks the responses to
+// cross-origin ones, for the paths in config.
+type corsHandler struct {
+	config corsConfig
+	next   http.Handler
+}
+
+// ServeHTTP implements http.Handler.
+func (h corsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" || !coversPath(h.config.Paths, r.URL.Path) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Add("Vary", "Origin")
+	allowed := h.config.allows(origin)
+	preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+	if preflight {
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(h.config.Methods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(h.config.Headers, ", "))
+			if h.config.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(h.config.MaxAge/time.Second)))
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if allowed {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposed, ", "))
+	}
+	h.next.ServeHTTP(w, r)
+}
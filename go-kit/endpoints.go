@@ -0,0 +1,698 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/text/language"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Create a struct to represent requests to the service. Lang is the caller's
+// language preference, either a single tag or an Accept-Language value, and TZ
+// their time zone or UTC offset, for greeting them by the time of day. A
+// UserID greets them by their profile instead of by Name and Lang, and
+// Formality is casual, neutral or formal. Title is an honorific for the name,
+// like Dr. NoAlias greets Name as it is, rather than by its alias, and
+// Transliterate asks for the greeting in ASCII as well.
+type helloRequest struct {
+	Name          string `json:"name,omitempty" xml:"name"`
+	Lang          string `json:"lang,omitempty" xml:"lang,omitempty"`
+	TZ            string `json:"tz,omitempty" xml:"tz,omitempty" validate:"omitempty,tz"`
+	PreserveCase  bool   `json:"preserve_case,omitempty" xml:"preserve_case,omitempty"`
+	UserID        string `json:"user_id,omitempty" xml:"user_id,omitempty" validate:"max=128"`
+	Formality     string `json:"formality,omitempty" xml:"formality,omitempty" validate:"omitempty,oneof=casual neutral formal"`
+	Title         string `json:"title,omitempty" xml:"title,omitempty"`
+	NoAlias       bool   `json:"no_alias,omitempty" xml:"no_alias,omitempty"`
+	Transliterate bool   `json:"transliterate,omitempty" xml:"transliterate,omitempty"`
+}
+
+// options returns the GreetOptions req asks for, or why they can't be had,
+// along with the language, at least.
+func (req helloRequest) options() (GreetOptions, error) {
+	opts := GreetOptions{Language: matchLanguage(req.Lang), PreserveCase: req.PreserveCase, UserID: req.UserID, Title: req.Title, NoAlias: req.NoAlias, Transliterate: req.Transliterate}
+	loc, err := parseLocation(req.TZ)
+	if err != nil {
+		return opts, err
+	}
+	opts.Location = loc
+	if opts.Formality, err = parseFormality(req.Formality); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// Create a struct to represent responses from the service. Transliterated is
+// the greeting in ASCII, if the request asked for it. Lang is the language the
+// greeting ended up in, for transports that can say so.
+type helloResponse struct {
+	Greeting       string       `json:"greeting,omitempty"`
+	Transliterated string       `json:"transliterated,omitempty"`
+	Err            error        `json:"err,omitempty"`
+	Lang           language.Tag `json:"-"`
+}
+
+// A Go Kit Endpoint is a func that takes a Context and a interface{} (empty interface)
+// as parameters and returns an empty interface type and an error.
+func makeHelloEndpoint(svc GreetService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(helloRequest)
+		opts, err := req.options()
+		if err != nil {
+			return helloResponse{"", "", err, opts.Language}, nil
+		}
+		greeting, err := svc.Hello(ctx, req.Name, opts)
+		if err != nil {
+			return helloResponse{"", "", err, opts.Language}, nil
+		}
+		return helloResponse{greeting.Text, greeting.Transliterated, nil, greeting.Language}, nil
+	}
+}
+
+// Goodbye gets its own request and response structs. Its error is kept as a
+// string, so that it survives being encoded as JSON.
+type goodbyeRequest struct {
+	Name          string `json:"name,omitempty"`
+	Lang          string `json:"lang,omitempty"`
+	PreserveCase  bool   `json:"preserve_case,omitempty"`
+	UserID        string `json:"user_id,omitempty" validate:"max=128"`
+	Formality     string `json:"formality,omitempty" validate:"omitempty,oneof=casual neutral formal"`
+	Title         string `json:"title,omitempty"`
+	NoAlias       bool   `json:"no_alias,omitempty"`
+	Transliterate bool   `json:"transliterate,omitempty"`
+}
+
+type goodbyeResponse struct {
+	Farewell       string       `json:"farewell,omitempty"`
+	Transliterated string       `json:"transliterated,omitempty"`
+	Err            string       `json:"err,omitempty"`
+	Lang           language.Tag `json:"-"`
+
+	// err is Err before it became a string, for transports that care what
+	// kind of error it was.
+	err error
+}
+
+func makeGoodbyeEndpoint(svc GreetService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(goodbyeRequest)
+		opts := GreetOptions{Language: matchLanguage(req.Lang), PreserveCase: req.PreserveCase, UserID: req.UserID, Title: req.Title, NoAlias: req.NoAlias, Transliterate: req.Transliterate}
+		formality, err := parseFormality(req.Formality)
+		if err != nil {
+			return goodbyeResponse{"", "", err2str(err), opts.Language, err}, nil
+		}
+		opts.Formality = formality
+		farewell, err := svc.Goodbye(ctx, req.Name, opts)
+		if err != nil {
+			return goodbyeResponse{"", "", err2str(err), opts.Language, err}, nil
+		}
+		return goodbyeResponse{farewell.Text, farewell.Transliterated, "", farewell.Language, nil}, nil
+	}
+}
+
+// A batch request is a list of names, greeted with the options of a hello
+// request, whose Name is left out, and its response holds one result per
+// name, in the same order. A name that fails doesn't fail the whole batch.
+type helloBatchRequest struct {
+	Names   []string
+	Options helloRequest
+}
+
+type helloBatchResponse struct {
+	Results []helloResponse
+	Lang    language.Tag
+}
+
+// makeHelloBatchEndpoint greets every name in a batch, at most concurrency at
+// a time. The names that haven't been greeted when the call is canceled, or
+// times out, fail with the context's error.
+func makeHelloBatchEndpoint(svc GreetService, concurrency int) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(helloBatchRequest)
+		opts, err := req.Options.options()
+		if err != nil {
+			return nil, err
+		}
+		results := make([]helloResponse, len(req.Names))
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for i, name := range req.Names {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i] = helloResponse{"", "", ctx.Err(), opts.Language}
+				continue
+			}
+			wg.Add(1)
+			go func(i int, name string) {
+				defer func() { <-sem; wg.Done() }()
+				if err := ctx.Err(); err != nil {
+					results[i] = helloResponse{"", "", err, opts.Language}
+					return
+				}
+				greeting, err := svc.Hello(ctx, name, opts)
+				if err != nil {
+					results[i] = helloResponse{"", "", err, opts.Language}
+					return
+				}
+				results[i] = helloResponse{greeting.Text, greeting.Transliterated, nil, greeting.Language}
+			}(i, name)
+		}
+		wg.Wait()
+		return helloBatchResponse{results, opts.Language}, nil
+	}
+}
+
+// Listing the greeting history goes straight to the store, since it isn't
+// something the GreetService does.
+type listGreetingsRequest struct {
+	After uint64
+	Limit int
+}
+
+// Next is the cursor for the following page, if there might be one.
+type listGreetingsResponse struct {
+	Greetings []greetingRecord `json:"greetings"`
+	Next      uint64           `json:"next,omitempty"`
+}
+
+func makeListGreetingsEndpoint(store HistoryStore) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listGreetingsRequest)
+		records, err := store.List(req.After, req.Limit)
+		if err != nil {
+			return nil, err
+		}
+		resp := listGreetingsResponse{Greetings: records}
+		if len(records) == req.Limit && len(records) > 0 {
+			resp.Next = records[len(records)-1].ID
+		}
+		return resp, nil
+	}
+}
+
+// Profiles are managed straight through the store, like the history. Every
+// profile endpoint answers with a profileResponse; Err is the reason it
+// couldn't, for the transport to turn into a status code.
+type profileResponse struct {
+	Profile *profile
+	Err     error
+}
+
+type getProfileRequest struct {
+	ID string
+}
+
+type putProfileRequest struct {
+	ID      string
+	Profile profile
+}
+
+type deleteProfileRequest struct {
+	ID string
+}
+
+func makePostProfileEndpoint(store ProfileStore, maxLen int) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p, err := checkProfile(request.(profile), maxLen)
+		if err != nil {
+			return profileResponse{Err: err}, nil
+		}
+		if err := store.Create(p); err != nil {
+			return profileResponse{Err: err}, nil
+		}
+		return profileResponse{Profile: &p}, nil
+	}
+}
+
+func makeGetProfileEndpoint(store ProfileStore) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p, err := store.Get(request.(getProfileRequest).ID)
+		if err != nil {
+			return profileResponse{Err: err}, nil
+		}
+		return profileResponse{Profile: &p}, nil
+	}
+}
+
+// The ID in the path wins over any user_id in a PUT body.
+func makePutProfileEndpoint(store ProfileStore, maxLen int) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(putProfileRequest)
+		req.Profile.UserID = req.ID
+		p, err := checkProfile(req.Profile, maxLen)
+		if err != nil {
+			return profileResponse{Err: err}, nil
+		}
+		if err := store.Put(p); err != nil {
+			return profileResponse{Err: err}, nil
+		}
+		return profileResponse{Profile: &p}, nil
+	}
+}
+
+func makeDeleteProfileEndpoint(store ProfileStore) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return profileResponse{Err: store.Delete(request.(deleteProfileRequest).ID)}, nil
+	}
+}
+
+// Stats come straight from the counts statsMiddleware keeps, and there's
+// nothing to ask for.
+type statsRequest struct{}
+
+func makeStatsEndpoint(stats *greetStats) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return stats.summary(), nil
+	}
+}
+
+// Scheduling a greeting takes a hello request and when to send it, with "at"
+// alongside the hello request's fields in the JSON. The scheduled greeting
+// endpoints all answer with a scheduleResponse.
+type scheduleGreetingRequest struct {
+	helloRequest
+	At time.Time `json:"at"`
+}
+
+type scheduleResponse struct {
+	Scheduled *scheduledGreeting
+	Err       error
+}
+
+type getScheduledGreetingRequest struct {
+	ID string
+}
+
+type cancelScheduledGreetingRequest struct {
+	ID string
+}
+
+func makeScheduleGreetingEndpoint(s *greetScheduler) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(scheduleGreetingRequest)
+		if req.At.IsZero() {
+			return scheduleResponse{Err: validationError{"at", "required", "at is required"}}, nil
+		}
+		g, err := s.Schedule(req.helloRequest, req.At)
+		if err != nil {
+			return scheduleResponse{Err: err}, nil
+		}
+		return scheduleResponse{Scheduled: &g}, nil
+	}
+}
+
+func makeGetScheduledGreetingEndpoint(s *greetScheduler) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		g, err := s.Get(request.(getScheduledGreetingRequest).ID)
+		if err != nil {
+			return scheduleResponse{Err: err}, nil
+		}
+		return scheduleResponse{Scheduled: &g}, nil
+	}
+}
+
+func makeCancelScheduledGreetingEndpoint(s *greetScheduler) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		g, err := s.Cancel(request.(cancelScheduledGreetingRequest).ID)
+		if err != nil {
+			return scheduleResponse{Err: err}, nil
+		}
+		return scheduleResponse{Scheduled: &g}, nil
+	}
+}
+
+// Tenants are managed straight through the store too, and every tenant
+// endpoint answers with a tenantResponse.
+type tenantResponse struct {
+	Tenant *tenant
+	Err    error
+}
+
+type getTenantRequest struct {
+	ID string
+}
+
+type putTenantRequest struct {
+	ID     string
+	Tenant tenant
+}
+
+type deleteTenantRequest struct {
+	ID string
+}
+
+func makePostTenantEndpoint(store TenantStore) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		t, err := checkTenant(request.(tenant))
+		if err != nil {
+			return tenantResponse{Err: err}, nil
+		}
+		if err := store.Create(t); err != nil {
+			return tenantResponse{Err: err}, nil
+		}
+		return tenantResponse{Tenant: &t}, nil
+	}
+}
+
+func makeGetTenantEndpoint(store TenantStore) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		t, err := store.Get(request.(getTenantRequest).ID)
+		if err != nil {
+			return tenantResponse{Err: err}, nil
+		}
+		return tenantResponse{Tenant: &t}, nil
+	}
+}
+
+// The ID in the path wins over any id in a PUT body.
+func makePutTenantEndpoint(store TenantStore) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(putTenantRequest)
+		req.Tenant.ID = req.ID
+		t, err := checkTenant(req.Tenant)
+		if err != nil {
+			return tenantResponse{Err: err}, nil
+		}
+		if err := store.Put(t); err != nil {
+			return tenantResponse{Err: err}, nil
+		}
+		return tenantResponse{Tenant: &t}, nil
+	}
+}
+
+func makeDeleteTenantEndpoint(store TenantStore, limiters *tenantLimiters) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		id := request.(deleteTenantRequest).ID
+		if err := store.Delete(id); err != nil {
+			return tenantResponse{Err: err}, nil
+		}
+		limiters.forget(id)
+		return tenantResponse{}, nil
+	}
+}
+
+// templateResponse is the answer to any of the /admin/templates endpoints.
+// Body is a template, a list of them, a template's versions, or previews.
+type templateResponse struct {
+	Body interface{}
+	Err  error
+}
+
+type listTemplatesRequest struct{}
+
+type templateRequest struct {
+	Method   string      `json:"method"`
+	Lang     string      `json:"lang"`
+	Template rawVariants `json:"template"`
+}
+
+type templateKeyRequest struct {
+	Method string
+	Lang   string
+}
+
+type rollbackTemplateRequest struct {
+	Method  string `json:"-"`
+	Lang    string `json:"-"`
+	Version int    `json:"version"`
+}
+
+// previewTemplateRequest previews Template, or the stored template for
+// Method and Lang if there's no Template.
+type previewTemplateRequest struct {
+	Method    string      `json:"method"`
+	Lang      string      `json:"lang"`
+	Template  rawVariants `json:"template,omitempty"`
+	Name      string      `json:"name"`
+	TimeOfDay string      `json:"time_of_day"`
+}
+
+type templateVersionsResponse struct {
+	Method   string            `json:"method"`
+	Lang     string            `json:"lang"`
+	Versions []templateVersion `json:"versions"`
+}
+
+type previewTemplateResponse struct {
+	Previews []string `json:"previews"`
+}
+
+func makeListTemplatesEndpoint(store *templateStore) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return templateResponse{Body: store.List()}, nil
+	}
+}
+
+func makeGetTemplateEndpoint(store *templateStore) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(templateKeyRequest)
+		t, err := store.Get(req.Method, req.Lang)
+		if err != nil {
+			return templateResponse{Err: err}, nil
+		}
+		return templateResponse{Body: t}, nil
+	}
+}
+
+func makeCreateTemplateEndpoint(store *templateStore) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(templateRequest)
+		t, err := store.Create(req.Method, req.Lang, req.Template)
+		if err != nil {
+			return templateResponse{Err: err}, nil
+		}
+		return templateResponse{Body: t}, nil
+	}
+}
+
+func makePutTemplateEndpoint(store *templateStore) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(templateRequest)
+		t, err := store.Put(req.Method, req.Lang, req.Template)
+		if err != nil {
+			return templateResponse{Err: err}, nil
+		}
+		return templateResponse{Body: t}, nil
+	}
+}
+
+func makeDeleteTemplateEndpoint(store *templateStore) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(templateKeyRequest)
+		_, err := store.Delete(req.Method, req.Lang)
+		return templateResponse{Err: err}, nil
+	}
+}
+
+func makeTemplateVersionsEndpoint(store *templateStore) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(templateKeyRequest)
+		versions, err := store.Versions(req.Method, req.Lang)
+		if err != nil {
+			return templateResponse{Err: err}, nil
+		}
+		return templateResponse{Body: templateVersionsResponse{req.Method, req.Lang, versions}}, nil
+	}
+}
+
+func makeRollbackTemplateEndpoint(store *templateStore) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(rollbackTemplateRequest)
+		t, err := store.Rollback(req.Method, req.Lang, req.Version)
+		if err != nil {
+			return templateResponse{Err: err}, nil
+		}
+		return templateResponse{Body: t}, nil
+	}
+}
+
+func makePreviewTemplateEndpoint(store *templateStore) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(previewTemplateRequest)
+		if len(req.Template) == 0 {
+			t, err := store.Get(req.Method, req.Lang)
+			if err != nil {
+				return templateResponse{Err: err}, nil
+			}
+			req.Template = t.Template
+		}
+		previews, err := previewTemplate(req.Method, req.Lang, req.Template, templateData{req.Name, req.TimeOfDay})
+		if err != nil {
+			return templateResponse{Err: err}, nil
+		}
+		return templateResponse{Body: previewTemplateResponse{previews}}, nil
+	}
+}
+
+// aliasResponse is the answer to any of the /aliases endpoints. Body is an
+// alias or a list of them. Names are canonicalized before they're looked up,
+// the way they are when they're greeted.
+type aliasResponse struct {
+	Body interface{}
+	Err  error
+}
+
+type listAliasesRequest struct{}
+
+type getAliasRequest struct {
+	Name string
+}
+
+type putAliasRequest struct {
+	Name  string
+	Alias alias
+}
+
+type deleteAliasRequest struct {
+	Name string
+}
+
+func makeListAliasesEndpoint(store AliasStore) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		aliases, err := store.List()
+		if err != nil {
+			return aliasResponse{Err: err}, nil
+		}
+		return aliasResponse{Body: aliases}, nil
+	}
+}
+
+func makeGetAliasEndpoint(store AliasStore, maxLen int) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		name, err := canonicalName(request.(getAliasRequest).Name, maxLen)
+		if err != nil {
+			return aliasResponse{Err: err}, nil
+		}
+		a, err := store.Get(name)
+		if err != nil {
+			return aliasResponse{Err: err}, nil
+		}
+		return aliasResponse{Body: a}, nil
+	}
+}
+
+// The name in the path wins over any name in a PUT body.
+func makePutAliasEndpoint(store AliasStore, maxLen int) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(putAliasRequest)
+		req.Alias.Name = req.Name
+		a, err := checkAlias(req.Alias, maxLen)
+		if err != nil {
+			return aliasResponse{Err: err}, nil
+		}
+		if err := store.Put(a); err != nil {
+			return aliasResponse{Err: err}, nil
+		}
+		return aliasResponse{Body: a}, nil
+	}
+}
+
+func makeDeleteAliasEndpoint(store AliasStore, maxLen int) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		name, err := canonicalName(request.(deleteAliasRequest).Name, maxLen)
+		if err != nil {
+			return aliasResponse{Err: err}, nil
+		}
+		return aliasResponse{Err: store.Delete(name)}, nil
+	}
+}
+
+// An import is started with the upload already saved to Path, and Rows to
+// read it with, or no Rows if it's in a format we can't read. Both import
+// endpoints answer with an importResponse.
+type importRequest struct {
+	Path string
+	Rows importRows
+}
+
+type importResponse struct {
+	Job *importJob
+	Err error
+}
+
+type getImportRequest struct {
+	ID string
+}
+
+func makeImportEndpoint(imp *greetImporter) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(importRequest)
+		if req.Rows == nil {
+			return importResponse{Err: validationError{"file", "unsupported_format", "file must be CSV or NDJSON"}}, nil
+		}
+		job, err := imp.Start(ctx, req.Path, req.Rows)
+		if err != nil {
+			return importResponse{Err: err}, nil
+		}
+		return importResponse{Job: &job}, nil
+	}
+}
+
+func makeGetImportEndpoint(imp *greetImporter) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		job, err := imp.Get(request.(getImportRequest).ID)
+		if err != nil {
+			return importResponse{Err: err}, nil
+		}
+		return importResponse{Job: &job}, nil
+	}
+}
+
+// The IP filter's rules are read and replaced whole. Both endpoints answer
+// with an ipFilterResponse.
+type getIPFilterRequest struct{}
+
+type putIPFilterRequest struct {
+	Rules ipRules
+}
+
+type ipFilterResponse struct {
+	Rules ipRules
+	Err   error
+}
+
+func makeGetIPFilterEndpoint(f *ipFilter) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return ipFilterResponse{Rules: f.Rules()}, nil
+	}
+}
+
+func makePutIPFilterEndpoint(f *ipFilter) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if err := f.SetRules(request.(putIPFilterRequest).Rules); err != nil {
+			return ipFilterResponse{Err: err}, nil
+		}
+		return ipFilterResponse{Rules: f.Rules()}, nil
+	}
+}
+
+// The log level is read and changed under /admin/loglevel. Both endpoints
+// answer with a logLevelResponse.
+type getLogLevelRequest struct{}
+
+type putLogLevelRequest struct {
+	Level       string
+	RevertAfter time.Duration
+}
+
+type logLevelResponse struct {
+	State logLevelState
+	Err   error
+}
+
+func makeGetLogLevelEndpoint(c *logLevelControl) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return logLevelResponse{State: c.State()}, nil
+	}
+}
+
+func makePutLogLevelEndpoint(c *logLevelControl) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(putLogLevelRequest)
+		state, err := c.Set(req.Level, req.RevertAfter)
+		return logLevelResponse{State: state, Err: err}, nil
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// optionsEcho greets with the options it's asked for.
+type optionsEcho struct{}
+
+func (optionsEcho) Hello(_ context.Context, name string, opts GreetOptions) (Greeting, error) {
+	return Greeting{Text: fmt.Sprintf("%s %s %s %s", opts.Formality, opts.Title, name, opts.Location)}, nil
+}
+
+func (optionsEcho) Goodbye(context.Context, string, GreetOptions) (Greeting, error) {
+	return Greeting{}, nil
+}
+
+func TestHelloBatch(t *testing.T) {
+	batch := makeHelloBatchEndpoint(optionsEcho{}, 1)
+	request := helloBatchRequest{
+		Names:   []string{"Lovelace", "Hopper"},
+		Options: helloRequest{Formality: "formal", Title: "Dr", TZ: "Europe/Berlin"},
+	}
+
+	response, err := batch(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"formal Dr Lovelace Europe/Berlin", "formal Dr Hopper Europe/Berlin"} {
+		if got := response.(helloBatchResponse).Results[i]; got.Greeting != want || got.Err != nil {
+			t.Errorf("greeted %q (%v), want %q", got.Greeting, got.Err, want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	response, err = batch(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, got := range response.(helloBatchResponse).Results {
+		if got.Err != context.Canceled {
+			t.Errorf("greeted %q (%v) after being canceled", got.Greeting, got.Err)
+		}
+	}
+
+	request.Options.Formality = "rude"
+	if _, err := batch(context.Background(), request); err == nil {
+		t.Error("greeted with rude formality")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+
+	log "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+)
+
+// Where there's no Consul, -etcd.endpoints has the service register itself
+// with etcd instead, see register.go, as the key -etcd.prefix, the name and
+// the instance's ID, /services/greet/greet-host:8080 say, with the instance's
+// host:port as its value, which is what go-kit's etcd subscribers want. The
+// key is on a lease of -etcd.ttl, which the service keeps renewing while it
+// runs, so an instance that dies without deregistering is gone from etcd
+// once the lease runs out. etcd doesn't check -register.check itself.
+
+// etcdDialTimeout is how long connecting to etcd gets.
+const etcdDialTimeout = 5 * time.Second
+
+// etcdRegistrar is an sd.Registrar that puts a key on a lease it keeps
+// renewing, and revokes the lease, taking the key with it, to deregister.
+type etcdRegistrar struct {
+	client *clientv3.Client
+	key    string
+	value  string
+	ttl    time.Duration
+	logger log.Logger
+
+	mu     sync.Mutex
+	lease  clientv3.LeaseID
+	cancel context.CancelFunc
+}
+
+// newEtcdRegistrar returns an sd.Registrar of instance with the etcd cluster
+// at endpoints, under prefix, on a lease of ttl.
+func newEtcdRegistrar(ctx context.Context, endpoints []string, prefix string, instance serviceInstance, ttl time.Duration, logger log.Logger) (sd.Registrar, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: etcdDialTimeout,
+		Context:     ctx,
+	})
+	if err != nil {
+		return nil, err
+	}
+	key := prefix + instance.Name + "/" + instance.ID
+	return &etcdRegistrar{
+		client: client,
+		key:    key,
+		value:  net.JoinHostPort(instance.Host, instance.Port),
+		ttl:    ttl,
+		logger: log.With(logger, "registry", "etcd", "key", key),
+	}, nil
+}
+
+// Register puts the key on a new lease and keeps renewing it until
+// Deregister.
+func (r *etcdRegistrar) Register() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), etcdDialTimeout)
+	defer cancel()
+	grant, err := r.client.Grant(ctx, int64(r.ttl/time.Second))
+	if err != nil {
+		r.logger.Log("action", "register", "err", err)
+		return
+	}
+	if _, err := r.client.Put(ctx, r.key, r.value, clientv3.WithLease(grant.ID)); err != nil {
+		r.logger.Log("action", "register", "err", err)
+		return
+	}
+	keepAlive, stop := context.WithCancel(context.Background())
+	renewals, err := r.client.KeepAlive(keepAlive, grant.ID)
+	if err != nil {
+		stop()
+		r.logger.Log("action", "register", "err", err)
+		return
+	}
+	r.lease, r.cancel = grant.ID, stop
+	go func() {
+		for range renewals {
+		}
+		if keepAlive.Err() == nil {
+			r.logger.Log("action", "renew", "err", "lease lost")
+		}
+	}()
+	r.logger.Log("action", "register")
+}
+
+// Deregister stops renewing the lease and revokes it, which deletes the key.
+func (r *etcdRegistrar) Deregister() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	r.cancel = nil
+	ctx, cancel := context.WithTimeout(context.Background(), etcdDialTimeout)
+	defer cancel()
+	if _, err := r.client.Revoke(ctx, r.lease); err != nil {
+		r.logger.Log("action", "deregister", "err", err)
+		return
+	}
+	r.logger.Log("action", "deregister")
+}
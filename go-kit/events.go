@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// greetingEvent records a single call to Hello, so it can be pushed to
+// anyone watching the service.
+type greetingEvent struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Greeting string    `json:"greeting,omitempty"`
+	Err      string    `json:"err,omitempty"`
+	Time     time.Time `json:"time"`
+
+	// seq is the event's place in the broker's sequence, the end of its ID.
+	seq uint64
+}
+
+var errInvalidEventID = validationError{"Last-Event-ID", "invalid_event_id", "Last-Event-ID isn't the ID of an event"}
+
+// greetingBroker fans greeting events out to subscribers. It keeps the most
+// recent events around so a subscriber that reconnects can catch up on what
+// it missed.
+//
+// An event's ID is the broker's epoch, when it was made, and the event's
+// place in its sequence, like "kq0x3ymd4g00-42", so an ID a client had from
+// before a restart isn't mistaken for one of the events since.
+type greetingBroker struct {
+	epoch string
+
+	mu      sync.Mutex
+	nextSeq uint64
+	recent  []greetingEvent
+	keep    int
+	clients map[chan greetingEvent]struct{}
+}
+
+func newGreetingBroker(keep int) *greetingBroker {
+	return &greetingBroker{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		nextSeq: 1,
+		keep:    keep,
+		clients: make(map[chan greetingEvent]struct{}),
+	}
+}
+
+// Publish assigns the event an ID and sends it to every subscriber. A
+// subscriber that isn't keeping up misses the event rather than holding up
+// the caller of Hello.
+func (b *greetingBroker) Publish(e greetingEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e.seq = b.nextSeq
+	e.ID = fmt.Sprintf("%s-%d", b.epoch, e.seq)
+	b.nextSeq++
+
+	b.recent = append(b.recent, e)
+	if len(b.recent) > b.keep {
+		b.recent = b.recent[len(b.recent)-b.keep:]
+	}
+
+	for c := range b.clients {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe registers a new subscriber. One that's reconnecting, with
+// lastID, the ID of the last event it had, is also returned the retained
+// events after it, to replay before reading from the channel: all of them,
+// if lastID is from before a restart. A lastID that isn't an event's ID is
+// errInvalidEventID.
+func (b *greetingBroker) Subscribe(lastID string) ([]greetingEvent, chan greetingEvent, error) {
+	var after uint64
+	if lastID != "" {
+		i := strings.LastIndex(lastID, "-")
+		seq, err := strconv.ParseUint(lastID[i+1:], 10, 64)
+		if i < 0 || err != nil {
+			return nil, nil, errInvalidEventID
+		}
+		if lastID[:i] == b.epoch {
+			after = seq
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var missed []greetingEvent
+	if lastID != "" {
+		for _, e := range b.recent {
+			if e.seq > after {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	c := make(chan greetingEvent, 16)
+	b.clients[c] = struct{}{}
+	return missed, c, nil
+}
+
+// Unsubscribe removes a subscriber registered with Subscribe.
+func (b *greetingBroker) Unsubscribe(c chan greetingEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.clients, c)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGreetingBrokerReplay(t *testing.T) {
+	b := newGreetingBroker(10)
+	for _, name := range []string{"Ada", "Grace", "Alan"} {
+		b.Publish(greetingEvent{Name: name})
+	}
+	first, _, _ := b.Subscribe(b.epoch + "-0")
+
+	for name, tc := range map[string]struct {
+		lastID string
+		want   []string
+		err    error
+	}{
+		"connecting":      {"", nil, nil},
+		"reconnecting":    {first[0].ID, []string{"Grace", "Alan"}, nil},
+		"up to date":      {first[2].ID, nil, nil},
+		"after a restart": {"kq0x3ymd4g00-2", []string{"Ada", "Grace", "Alan"}, nil},
+		"not an event's":  {"2", nil, errInvalidEventID},
+		"not a sequence":  {b.epoch + "-two", nil, errInvalidEventID},
+	} {
+		missed, events, err := b.Subscribe(tc.lastID)
+		if err != tc.err {
+			t.Errorf("%s: got %v, want %v", name, err, tc.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		b.Unsubscribe(events)
+		var got []string
+		for _, e := range missed {
+			got = append(got, e.Name)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: replayed %v, want %v", name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// For a quick look at the process without Prometheus, the admin listener
+// serves expvar's JSON at /debug/vars: Go's own cmdline and memstats, and
+//
+//	uptime_seconds  how long the process has been running
+//	goroutines      how many goroutines there are
+//	gc              the number of collections, and their total and last pause
+//	http_requests   HTTP requests answered, by status class: 2xx, 4xx and so on
+//	greetings       what GET /stats says
+//
+// curl http://localhost:6060/debug/vars
+
+// httpRequests counts the HTTP requests answered, by status class.
+var httpRequests = expvar.NewMap("http_requests")
+
+// publishVars publishes the process's variables, and stats.
+func publishVars(stats *greetStats) {
+	start := time.Now()
+	expvar.Publish("uptime_seconds", expvar.Func(func() interface{} {
+		return int64(time.Since(start) / time.Second)
+	}))
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("gc", expvar.Func(func() interface{} {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		gc := map[string]interface{}{
+			"num_gc":         m.NumGC,
+			"pause_total_ns": m.PauseTotalNs,
+		}
+		if m.NumGC > 0 {
+			gc["last_pause_ns"] = m.PauseNs[(m.NumGC+255)%256]
+			gc["last_gc"] = time.Unix(0, int64(m.LastGC)).UTC()
+		}
+		return gc
+	}))
+	expvar.Publish("greetings", expvar.Func(func() interface{} {
+		return stats.summary()
+	}))
+}
+
+// countingHandler counts the requests next answers in httpRequests.
+type countingHandler struct {
+	next http.Handler
+}
+
+// ServeHTTP implements http.Handler.
+func (h countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+	h.next.ServeHTTP(rec, r)
+	httpRequests.Add(strconv.Itoa(rec.code/100)+"xx", 1)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/context"
+)
+
+// The service fronts a public signup flow, so names go through a NameFilter
+// before anything else sees them, logs included.
+
+// A NameFilter decides what to do with a name before it's greeted. It returns
+// the name to greet, which may have been masked, or an error to refuse it.
+type NameFilter interface {
+	Filter(name string) (string, error)
+}
+
+// defaultDenylist is the built in list of words wordFilter won't greet.
+// Operators add their own with -filter.words.
+var defaultDenylist = []string{
+	"arse", "arsehole", "asshole", "bastard", "bitch", "bollocks", "cock",
+	"cunt", "dick", "fuck", "fucker", "motherfucker", "piss", "prick",
+	"shit", "slut", "twat", "wanker", "whore",
+}
+
+// wordFilter is a NameFilter that checks each word of a name against a
+// denylist, ignoring case. Only whole words count, so Dickens and Scunthorpe
+// get through. Denied words are masked with asterisks if mask is set, and
+// otherwise the whole name is refused.
+type wordFilter struct {
+	words map[string]bool
+	mask  bool
+}
+
+func newWordFilter(words []string, mask bool) wordFilter {
+	f := wordFilter{words: map[string]bool{}, mask: mask}
+	for _, w := range words {
+		f.words[strings.ToLower(w)] = true
+	}
+	return f
+}
+
+func (f wordFilter) Filter(name string) (string, error) {
+	var (
+		masked bytes.Buffer
+		denied bool
+	)
+	rest := name
+	for _, w := range strings.FieldsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		i := strings.Index(rest, w)
+		masked.WriteString(rest[:i])
+		if f.words[strings.ToLower(w)] {
+			denied = true
+			masked.WriteString(strings.Repeat("*", utf8.RuneCountInString(w)))
+		} else {
+			masked.WriteString(w)
+		}
+		rest = rest[i+len(w):]
+	}
+	masked.WriteString(rest)
+
+	switch {
+	case !denied:
+		return name, nil
+	case f.mask:
+		return masked.String(), nil
+	default:
+		return "", validationError{"name", "denied", "name is not allowed"}
+	}
+}
+
+// readWordList reads a denylist from a file, one word per line. Blank lines
+// and lines starting with # are skipped.
+func readWordList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, scanner.Err()
+}
+
+// wordListFilter is a wordFilter with the defaultDenylist and the words in
+// a -filter.words file, which is read again on a SIGHUP, see reload.go. It's
+// safe for concurrent use.
+type wordListFilter struct {
+	path string
+	mask bool
+	v    atomic.Value
+}
+
+// newWordListFilter returns a wordListFilter with the words in the file at
+// path.
+func newWordListFilter(path string, mask bool) (*wordListFilter, error) {
+	words, err := readWordList(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &wordListFilter{path: path, mask: mask}
+	f.v.Store(f.filter(words))
+	return f, nil
+}
+
+// filter returns the wordFilter with words.
+func (f *wordListFilter) filter(words []string) wordFilter {
+	return newWordFilter(append(append([]string{}, defaultDenylist...), words...), f.mask)
+}
+
+func (f *wordListFilter) Filter(name string) (string, error) {
+	return f.v.Load().(wordFilter).Filter(name)
+}
+
+// prepareReload implements reloadable.
+func (f *wordListFilter) prepareReload() (func() ([]string, error), error) {
+	words, err := readWordList(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("-filter.words: %v", err)
+	}
+	next := f.filter(words)
+	return func() ([]string, error) {
+		if reflect.DeepEqual(next.words, f.v.Load().(wordFilter).words) {
+			return nil, nil
+		}
+		f.v.Store(next)
+		return []string{fmt.Sprintf("filter.words %d words", len(next.words))}, nil
+	}, nil
+}
+
+// filteringMiddleware runs every name through a NameFilter.
+type filteringMiddleware struct {
+	filter NameFilter
+	next   GreetService
+}
+
+func (mw filteringMiddleware) Hello(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.apply(ctx, s, opts, mw.next.Hello)
+}
+
+func (mw filteringMiddleware) Goodbye(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.apply(ctx, s, opts, mw.next.Goodbye)
+}
+
+func (mw filteringMiddleware) apply(ctx context.Context, s string, opts GreetOptions, call greetMethod) (Greeting, error) {
+	s, err := mw.filter.Filter(s)
+	if err != nil {
+		return Greeting{}, err
+	}
+	return call(ctx, s, opts)
+}
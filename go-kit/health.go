@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// GET /healthz says whether the service, and each of the things it depends
+// on, is healthy. Every dependency registers a Checker under its name when
+// it's set up, and a call runs them all at once, giving each -health.timeout
+// to answer. The service is healthy, and /healthz a 200, only if every check
+// passes; otherwise it's degraded, and /healthz a 503.
+//
+// Kubernetes, or anything else that probes the service, gets two more:
+// GET /livez is a 200 for as long as the process can answer at all, and GET
+// /readyz is /healthz, but a 503 as well until the service has started up,
+// and again from when it starts shutting down. With -shutdown.delay, the
+// service goes on serving for that long after it's stopped being ready, so
+// that the probes see it before it stops taking requests.
+
+// Checker is something the service depends on that can be checked on.
+type Checker interface {
+	// Check returns an error if the dependency isn't usable.
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc is a function that is a Checker.
+type CheckerFunc func(ctx context.Context) error
+
+// Check implements Checker.
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+	healthDown     = "down"
+)
+
+// componentHealth is what a check found.
+type componentHealth struct {
+	Status string `json:"status"`
+	Err    string `json:"err,omitempty"`
+}
+
+// healthReport is the health of the service and each of its components.
+type healthReport struct {
+	Status     string                     `json:"status"`
+	Components map[string]componentHealth `json:"components"`
+}
+
+// healthChecks is the Checkers registered with the service, by name. It's
+// safe for concurrent use.
+type healthChecks struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks map[string]Checker
+}
+
+func newHealthChecks(timeout time.Duration) *healthChecks {
+	return &healthChecks{timeout: timeout, checks: map[string]Checker{}}
+}
+
+// Register adds c to the checks as name, replacing any check registered
+// under it before.
+func (h *healthChecks) Register(name string, c Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = c
+}
+
+// Run runs every check at once and reports what they found. A check that
+// doesn't answer within the timeout is down.
+func (h *healthChecks) Run(ctx context.Context) healthReport {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	h.mu.RLock()
+	checks := make(map[string]Checker, len(h.checks))
+	for name, c := range h.checks {
+		checks[name] = c
+	}
+	h.mu.RUnlock()
+
+	report := healthReport{Status: healthOK, Components: make(map[string]componentHealth, len(checks))}
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for name, c := range checks {
+		wg.Add(1)
+		go func(name string, c Checker) {
+			defer wg.Done()
+			errc := make(chan error, 1)
+			go func() { errc <- c.Check(ctx) }()
+			var err error
+			select {
+			case err = <-errc:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+			health := componentHealth{Status: healthOK}
+			if err != nil {
+				health = componentHealth{Status: healthDown, Err: err.Error()}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[name] = health
+			if err != nil {
+				report.Status = healthDegraded
+			}
+		}(name, c)
+	}
+	wg.Wait()
+	return report
+}
+
+const (
+	lifecycleStarting int32 = iota
+	lifecycleReady
+	lifecycleDraining
+)
+
+var (
+	errStarting = errors.New("starting up")
+	errDraining = errors.New("shutting down")
+)
+
+// readiness is whether the service has started up, and hasn't started
+// shutting down. It's a Checker for /readyz. The zero value is starting up.
+type readiness struct {
+	state int32
+}
+
+// Ready marks the service as started up.
+func (r *readiness) Ready() {
+	atomic.CompareAndSwapInt32(&r.state, lifecycleStarting, lifecycleReady)
+}
+
+// Drain marks the service as shutting down, for good.
+func (r *readiness) Drain() {
+	atomic.StoreInt32(&r.state, lifecycleDraining)
+}
+
+// Check implements Checker.
+func (r *readiness) Check(context.Context) error {
+	switch atomic.LoadInt32(&r.state) {
+	case lifecycleStarting:
+		return errStarting
+	case lifecycleDraining:
+		return errDraining
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	log "github.com/go-kit/kit/log"
+)
+
+// Every greeting the service hands out is kept in a HistoryStore, along with
+// what we know about who asked for it. GET /greetings pages through it.
+
+// greetingRecord is one entry in the greeting history.
+type greetingRecord struct {
+	ID       uint64    `json:"id"`
+	Method   string    `json:"method"`
+	Name     string    `json:"name"`
+	Greeting string    `json:"greeting,omitempty"`
+	Err      string    `json:"err,omitempty"`
+	Time     time.Time `json:"time"`
+	Caller   caller    `json:"caller"`
+}
+
+// caller is whatever the transport could tell us about the client. Transports
+// that know something put it in the context with callerToContext. Subject is
+// who the client authenticated as, if it did; see jwt.go.
+type caller struct {
+	Transport string `json:"transport,omitempty"`
+	Addr      string `json:"addr,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+}
+
+type callerContextKey int
+
+// callerKey is the context key for the caller.
+const callerKey callerContextKey = 0
+
+// withCallerSubject returns ctx with its caller's Subject set to sub, and
+// records it in the request's audit, if it's being audited.
+func withCallerSubject(ctx context.Context, sub string) context.Context {
+	if a, ok := ctx.Value(auditKey).(*pendingAudit); ok {
+		a.setSubject(sub)
+	}
+	c, _ := ctx.Value(callerKey).(caller)
+	c.Subject = sub
+	return context.WithValue(ctx, callerKey, c)
+}
+
+// HistoryStore keeps greeting records in the order they were added.
+type HistoryStore interface {
+	// Add assigns r the next ID and stores it.
+	Add(r greetingRecord) (greetingRecord, error)
+
+	// List returns up to limit records with IDs after the given one, oldest
+	// first. Pass an after of 0 to start from the beginning.
+	List(after uint64, limit int) ([]greetingRecord, error)
+}
+
+// memHistoryStore is a HistoryStore that keeps everything in memory.
+type memHistoryStore struct {
+	mu      sync.RWMutex
+	records []greetingRecord
+}
+
+func newMemHistoryStore() *memHistoryStore {
+	return &memHistoryStore{}
+}
+
+func (s *memHistoryStore) Add(r greetingRecord) (greetingRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.ID = uint64(len(s.records)) + 1
+	s.records = append(s.records, r)
+	return r, nil
+}
+
+func (s *memHistoryStore) List(after uint64, limit int) ([]greetingRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := sort.Search(len(s.records), func(i int) bool { return s.records[i].ID > after })
+	j := i + limit
+	if j > len(s.records) {
+		j = len(s.records)
+	}
+	return append([]greetingRecord(nil), s.records[i:j]...), nil
+}
+
+// fileHistoryStore is a memHistoryStore that also appends every record to a
+// file, one JSON object per line, and reads them back in when it's opened, so
+// the history survives restarts.
+type fileHistoryStore struct {
+	*memHistoryStore
+	mu sync.Mutex
+	f  *os.File
+}
+
+func openFileHistoryStore(path string) (*fileHistoryStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &fileHistoryStore{memHistoryStore: newMemHistoryStore(), f: f}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r greetingRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			f.Close()
+			return nil, err
+		}
+		s.memHistoryStore.Add(r)
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileHistoryStore) Add(r greetingRecord) (greetingRecord, error) {
+	// Holding mu across both steps keeps the file in ID order.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.memHistoryStore.Add(r)
+	if err != nil {
+		return r, err
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return r, err
+	}
+	_, err = s.f.Write(append(b, '\n'))
+	return r, err
+}
+
+// historyMiddleware records every greeting in a HistoryStore. A greeting that
+// fails to record is logged rather than failing the call.
+type historyMiddleware struct {
+	store  HistoryStore
+	logger log.Logger
+	next   GreetService
+}
+
+func (mw historyMiddleware) Hello(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.record(ctx, "Hello", s, opts, mw.next.Hello)
+}
+
+func (mw historyMiddleware) Goodbye(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.record(ctx, "Goodbye", s, opts, mw.next.Goodbye)
+}
+
+func (mw historyMiddleware) record(ctx context.Context, method, s string, opts GreetOptions, call greetMethod) (Greeting, error) {
+	output, err := call(ctx, s, opts)
+	c, _ := ctx.Value(callerKey).(caller)
+	if _, serr := mw.store.Add(greetingRecord{
+		Method:   method,
+		Name:     s,
+		Greeting: output.Text,
+		Err:      err2str(err),
+		Time:     time.Now(),
+		Caller:   c,
+	}); serr != nil {
+		mw.logger.Log("err", serr)
+	}
+	return output, err
+}
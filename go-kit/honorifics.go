@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// A greeting can address someone by a title, like Dr. or Mx. Titles we know
+// are written the way the greeting's language writes them, so Dr. Smith is
+// greeted as "Bonjour, Dr Smith" in French and "Ciao, Dott. Smith" in
+// Italian. Anything else is used as given.
+
+// honorifics are the titles we know, by their lower case English
+// abbreviation without the period, and then by language. A language that's
+// missing uses the English form.
+var honorifics = map[string]map[language.Tag]string{
+	"dr": {
+		language.English:    "Dr.",
+		language.French:     "Dr",
+		language.Italian:    "Dott.",
+		language.Dutch:      "dr.",
+		language.Portuguese: "Dr.",
+	},
+	"prof": {
+		language.English: "Prof.",
+		language.French:  "Pr",
+		language.Dutch:   "prof.",
+	},
+	"mx": {
+		language.English: "Mx.",
+	},
+	"mr": {
+		language.English:    "Mr.",
+		language.German:     "Herr",
+		language.Spanish:    "Sr.",
+		language.French:     "M.",
+		language.Italian:    "Sig.",
+		language.Dutch:      "dhr.",
+		language.Portuguese: "Sr.",
+	},
+	"mrs": {
+		language.English:    "Mrs.",
+		language.German:     "Frau",
+		language.Spanish:    "Sra.",
+		language.French:     "Mme",
+		language.Italian:    "Sig.ra",
+		language.Dutch:      "mevr.",
+		language.Portuguese: "Sra.",
+	},
+	"ms": {
+		language.English:    "Ms.",
+		language.German:     "Frau",
+		language.Spanish:    "Sra.",
+		language.French:     "Mme",
+		language.Italian:    "Sig.ra",
+		language.Dutch:      "mevr.",
+		language.Portuguese: "Sra.",
+	},
+}
+
+// titleFormat puts the title before the name. It goes through greetCatalog
+// like the greetings do, so a language that puts titles somewhere else only
+// needs a translation of it.
+const titleFormat = "%[1]s %[2]s"
+
+// addressName returns name with title in the place lang puts it, or just
+// name if there's no title.
+func addressName(name, title string, lang language.Tag) string {
+	if title == "" {
+		return name
+	}
+	if forms, ok := honorifics[strings.TrimSuffix(strings.ToLower(title), ".")]; ok {
+		if form, ok := forms[lang]; ok {
+			title = form
+		} else {
+			title = forms[language.English]
+		}
+	}
+	return newPrinter(lang).Sprintf(titleFormat, title, name)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+)
+
+// Greetings are looked up in greetCatalog, keyed by their English text, so a
+// phrase with no translation comes out in English.
+
+// greetLanguages are the languages we have greetings for. The first one is
+// the fallback.
+var greetLanguages = []language.Tag{
+	language.English,
+	language.German,
+	language.Spanish,
+	language.French,
+	language.Italian,
+	language.Dutch,
+	language.Portuguese,
+}
+
+var greetCatalog = catalog.NewBuilder(catalog.Fallback(language.English))
+
+var greetMatcher = language.NewMatcher(greetLanguages)
+
+func init() {
+	for _, m := range []struct {
+		tag        language.Tag
+		key, value string
+	}{
+		{language.German, "Hello there, %s", "Hallo, %s"},
+		{language.German, "Hey, %s", "Hi, %s"},
+		{language.German, "Good day, %s", "Guten Tag, %s"},
+		{language.German, "Goodbye, %s", "Auf Wiedersehen, %s"},
+		{language.German, "Bye, %s", "Tschüss, %s"},
+		{language.German, "Farewell, %s", "Auf Wiedersehen, %s"},
+		{language.German, "Good morning, %s", "Guten Morgen, %s"},
+		{language.German, "Good afternoon, %s", "Guten Tag, %s"},
+		{language.German, "Good evening, %s", "Guten Abend, %s"},
+		{language.Spanish, "Hello there, %s", "Hola, %s"},
+		{language.Spanish, "Hey, %s", "¿Qué tal, %s?"},
+		{language.Spanish, "Good day, %s", "Saludos, %s"},
+		{language.Spanish, "Goodbye, %s", "Adiós, %s"},
+		{language.Spanish, "Bye, %s", "Chao, %s"},
+		{language.Spanish, "Farewell, %s", "Que le vaya bien, %s"},
+		{language.Spanish, "Good morning, %s", "Buenos días, %s"},
+		{language.Spanish, "Good afternoon, %s", "Buenas tardes, %s"},
+		{language.Spanish, "Good evening, %s", "Buenas noches, %s"},
+		{language.French, "Hello there, %s", "Bonjour, %s"},
+		{language.French, "Hey, %s", "Salut, %s"},
+		{language.French, "Good day, %s", "Bonjour, %s"},
+		{language.French, "Goodbye, %s", "Au revoir, %s"},
+		{language.French, "Bye, %s", "À plus, %s"},
+		{language.French, "Farewell, %s", "Au revoir, %s"},
+		{language.French, "Good morning, %s", "Bonjour, %s"},
+		{language.French, "Good afternoon, %s", "Bonjour, %s"},
+		{language.French, "Good evening, %s", "Bonsoir, %s"},
+		{language.Italian, "Hello there, %s", "Ciao, %s"},
+		{language.Italian, "Hey, %s", "Ehi, %s"},
+		{language.Italian, "Good day, %s", "Salve, %s"},
+		{language.Italian, "Goodbye, %s", "Arrivederci, %s"},
+		{language.Italian, "Bye, %s", "Ciao, %s"},
+		{language.Italian, "Farewell, %s", "Arrivederla, %s"},
+		{language.Italian, "Good morning, %s", "Buongiorno, %s"},
+		{language.Italian, "Good afternoon, %s", "Buon pomeriggio, %s"},
+		{language.Italian, "Good evening, %s", "Buonasera, %s"},
+		{language.Dutch, "Hello there, %s", "Hallo daar, %s"},
+		{language.Dutch, "Hey, %s", "Hoi, %s"},
+		{language.Dutch, "Good day, %s", "Goedendag, %s"},
+		{language.Dutch, "Goodbye, %s", "Tot ziens, %s"},
+		{language.Dutch, "Bye, %s", "Doei, %s"},
+		{language.Dutch, "Farewell, %s", "Tot ziens, %s"},
+		{language.Dutch, "Good morning, %s", "Goedemorgen, %s"},
+		{language.Dutch, "Good afternoon, %s", "Goedemiddag, %s"},
+		{language.Dutch, "Good evening, %s", "Goedenavond, %s"},
+		{language.Portuguese, "Hello there, %s", "Olá, %s"},
+		{language.Portuguese, "Hey, %s", "Oi, %s"},
+		{language.Portuguese, "Good day, %s", "Saudações, %s"},
+		{language.Portuguese, "Goodbye, %s", "Adeus, %s"},
+		{language.Portuguese, "Bye, %s", "Tchau, %s"},
+		{language.Portuguese, "Farewell, %s", "Até breve, %s"},
+		{language.Portuguese, "Good morning, %s", "Bom dia, %s"},
+		{language.Portuguese, "Good afternoon, %s", "Boa tarde, %s"},
+		{language.Portuguese, "Good evening, %s", "Boa noite, %s"},
+	} {
+		greetCatalog.SetString(m.tag, m.key, m.value)
+	}
+}
+
+// matchLanguage picks the best of greetLanguages for a language preference,
+// given as a single tag like "fr" or as an Accept-Language header value.
+// Anything it can't make sense of gets English.
+func matchLanguage(pref string) language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(pref)
+	if err != nil || len(tags) == 0 {
+		return greetLanguages[0]
+	}
+	_, i, _ := greetMatcher.Match(tags...)
+	return greetLanguages[i]
+}
+
+// newPrinter returns a printer for tag that translates using greetCatalog.
+func newPrinter(tag language.Tag) *message.Printer {
+	return message.NewPrinter(tag, message.Catalog(greetCatalog))
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A client that isn't sure a request got through can send it again with the
+// same Idempotency-Key header, and get the first response back instead of
+// greeting (and recording, and notifying) twice. Keys are remembered for
+// -idempotency.ttl, and only count for the same caller, the subject and tenant
+// it authenticates as, and the same method and path, so nobody else can have
+// a caller's response by sending its key. A retry that arrives while the first
+// request is still being served waits for it. One whose body isn't the first
+// request's is a different request, which is a mistake, and is answered 422
+// Unprocessable Entity.
+//
+// GET and HEAD requests don't change anything, so they ignore the header.
+// Requests and responses bigger than idempotencyMaxBody aren't remembered, so
+// their keys don't protect anything. Nor are answers that ask the client to try again
+// later, like a 429 or 503, so that when it does it's served afresh, or the
+// lack of one when a request panics, as those net/http drops do. At most
+// idempotencyMaxEntries keys, and idempotencyMaxBytes of responses, are
+// remembered at once; past either, the keys that expire soonest are forgotten
+// first.
+
+const idempotencyMaxBody = 1 << 20
+
+const (
+	idempotencyMaxEntries = 10000
+	idempotencyMaxBytes   = 64 << 20
+)
+
+// errIdempotencyKeyReused is the error of a request that has the
+// Idempotency-Key of a different one.
+var errIdempotencyKeyReused = errors.New("the Idempotency-Key was used for a different request")
+
+// idempotencyHandler replays responses to requests it's seen before. who
+// says who a request is from, as authz.who does.
+type idempotencyHandler struct {
+	cache *idempotencyCache
+	who   func(*http.Request) string
+	next  http.Handler
+}
+
+func (h idempotencyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" || r.Method == "GET" || r.Method == "HEAD" {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, idempotencyMaxBody+1))
+	if err != nil {
+		writeProblem(w, err)
+		return
+	}
+	if len(body) > idempotencyMaxBody {
+		r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	key = h.who(r) + " " + r.Method + " " + r.URL.Path + " " + key
+	request := sha256.Sum256(body)
+	e, first := h.cache.start(key, request)
+	if !first {
+		if e.request != request {
+			writeProblem(w, errIdempotencyKeyReused)
+			return
+		}
+		<-e.done
+		if e.stored {
+			e.replay(w)
+			return
+		}
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	rec := &idempotencyRecorder{ResponseWriter: w, code: http.StatusOK}
+	served := false
+	defer func() {
+		// A request that panicked, like one net/http was told to drop with
+		// http.ErrAbortHandler, has no response to remember, so a retry is
+		// served afresh.
+		if !served {
+			h.cache.abandon(key, e)
+		}
+	}()
+	h.next.ServeHTTP(rec, r)
+	served = true
+	h.cache.finish(key, e, rec)
+}
+
+// tryAgainLater says whether a response with code is one the client is
+// expected to retry.
+func tryAgainLater(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// idempotencyEntry is a response, or the promise of one while done is open,
+// to the request whose body has the hash request.
+type idempotencyEntry struct {
+	done    chan struct{}
+	expires time.Time
+	request [sha256.Size]byte
+
+	stored bool
+	code   int
+	header http.Header
+	body   []byte
+}
+
+func (e *idempotencyEntry) replay(w http.ResponseWriter) {
+	for k, v := range e.header {
+		// The replay is a request of its own, with its own ID.
+		if k != requestIDHeader {
+			w.Header()[k] = v
+		}
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(e.code)
+	w.Write(e.body)
+}
+
+// idempotencyCache holds responses by key until they expire.
+type idempotencyCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	bytes     int
+	lastSweep time.Time
+}
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{ttl: ttl, entries: map[string]*idempotencyEntry{}, lastSweep: time.Now()}
+}
+
+// start returns the entry for key, and whether it's new, in which case it's
+// for request, and the caller has to fill it in and close done.
+func (c *idempotencyCache) start(key string, request [sha256.Size]byte) (*idempotencyEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if now.Sub(c.lastSweep) > time.Minute {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				c.remove(k, e)
+			}
+		}
+		c.lastSweep = now
+	}
+	if e, ok := c.entries[key]; ok && now.Before(e.expires) {
+		return e, false
+	} else if ok {
+		c.remove(key, e)
+	}
+	for len(c.entries) >= idempotencyMaxEntries && c.evict() {
+	}
+	e := &idempotencyEntry{done: make(chan struct{}), expires: now.Add(c.ttl), request: request}
+	c.entries[key] = e
+	return e, true
+}
+
+// finish fills in e, the entry for key, with the response rec recorded, and
+// closes done. A response that isn't to be replayed is forgotten, so the key
+// can be used again.
+func (c *idempotencyCache) finish(key string, e *idempotencyEntry, rec *idempotencyRecorder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer close(e.done)
+	e.code, e.header, e.body = rec.code, rec.Header().Clone(), rec.body.Bytes()
+	if rec.tooBig || rec.hijacked || tryAgainLater(rec.code) {
+		if c.entries[key] == e {
+			delete(c.entries, key)
+		}
+		return
+	}
+	if c.entries[key] == e {
+		for c.bytes+len(e.body) > idempotencyMaxBytes && c.evict() {
+		}
+		c.bytes += len(e.body)
+	}
+	// If it was evicted while it was being served, whoever's waiting on it
+	// can still have it.
+	e.stored = true
+}
+
+// abandon forgets e, the entry for key, without a response, and closes done,
+// so whoever's waiting on it is served afresh.
+func (c *idempotencyCache) abandon(key string, e *idempotencyEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries[key] == e {
+		delete(c.entries, key)
+	}
+	close(e.done)
+}
+
+// evict forgets the entry that expires soonest, other than one still being
+// served, and says whether there was one.
+func (c *idempotencyCache) evict() bool {
+	var (
+		key    string
+		oldest *idempotencyEntry
+	)
+	for k, e := range c.entries {
+		if !e.stored {
+			continue
+		}
+		if oldest == nil || e.expires.Before(oldest.expires) {
+			key, oldest = k, e
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	c.remove(key, oldest)
+	return true
+}
+
+// remove drops e, the entry for key.
+func (c *idempotencyCache) remove(key string, e *idempotencyEntry) {
+	delete(c.entries, key)
+	if e.stored {
+		c.bytes -= len(e.body)
+	}
+}
+
+// idempotencyRecorder passes a response through to the client, keeping a
+// copy of it as long as it's small enough.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	code     int
+	body     bytes.Buffer
+	tooBig   bool
+	hijacked bool
+}
+
+func (r *idempotencyRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	if !r.tooBig {
+		if r.body.Len()+len(b) > idempotencyMaxBody {
+			r.tooBig = true
+			r.body.Reset()
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming responses through as they're written.
+func (r *idempotencyRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSockets take over the connection, whereupon there's no
+// response to remember.
+func (r *idempotencyRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection can't be hijacked")
+	}
+	r.hijacked = true
+	return h.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the connection underneath.
+func (r *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// callCounter answers with how many times it's been called, and the
+// status and size its request asks for. A request that asks to abort the
+// call it's counted as is dropped instead.
+type callCounter struct {
+	calls *int
+}
+
+func (h callCounter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	*h.calls++
+	if r.URL.Query().Get("abort") == fmt.Sprint(*h.calls) {
+		panic(http.ErrAbortHandler)
+	}
+	status := http.StatusOK
+	fmt.Sscan(r.URL.Query().Get("status"), &status)
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "call %d", *h.calls)
+	if size := r.URL.Query().Get("size"); size != "" {
+		var n int
+		fmt.Sscan(size, &n)
+		w.Write([]byte(strings.Repeat("x", n)))
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	type request struct {
+		method, target, key string
+	}
+	for name, tc := range map[string]struct {
+		requests []request
+		want     []string
+		replayed []bool
+	}{
+		"replayed": {
+			[]request{{"POST", "/hello", "a"}, {"POST", "/hello", "a"}},
+			[]string{"call 1", "call 1"},
+			[]bool{false, true},
+		},
+		"no key": {
+			[]request{{"POST", "/hello", ""}, {"POST", "/hello", ""}},
+			[]string{"call 1", "call 2"},
+			[]bool{false, false},
+		},
+		"different keys": {
+			[]request{{"POST", "/hello", "a"}, {"POST", "/hello", "b"}},
+			[]string{"call 1", "call 2"},
+			[]bool{false, false},
+		},
+		"different paths": {
+			[]request{{"POST", "/hello", "a"}, {"POST", "/goodbye", "a"}},
+			[]string{"call 1", "call 2"},
+			[]bool{false, false},
+		},
+		"different methods": {
+			[]request{{"POST", "/hello", "a"}, {"PUT", "/hello", "a"}},
+			[]string{"call 1", "call 2"},
+			[]bool{false, false},
+		},
+		"GET": {
+			[]request{{"GET", "/hello", "a"}, {"GET", "/hello", "a"}},
+			[]string{"call 1", "call 2"},
+			[]bool{false, false},
+		},
+		"try again later": {
+			[]request{{"POST", "/hello?status=503", "a"}, {"POST", "/hello?status=503", "a"}},
+			[]string{"call 1", "call 2"},
+			[]bool{false, false},
+		},
+		"error": {
+			[]request{{"POST", "/hello?status=400", "a"}, {"POST", "/hello?status=400", "a"}},
+			[]string{"call 1", "call 1"},
+			[]bool{false, true},
+		},
+		"aborted": {
+			[]request{{"POST", "/hello?abort=1", "a"}, {"POST", "/hello?abort=1", "a"}, {"POST", "/hello?abort=1", "a"}},
+			[]string{"", "call 2", "call 2"},
+			[]bool{false, false, true},
+		},
+		"too big": {
+			[]request{{"POST", "/hello?size=2000000", "a"}, {"POST", "/hello?size=2000000", "a"}},
+			[]string{"call 1", "call 2"},
+			[]bool{false, false},
+		},
+	} {
+		var calls int
+		h := idempotencyHandler{newIdempotencyCache(time.Hour), anyone, callCounter{&calls}}
+		for i, req := range tc.requests {
+			r := httptest.NewRequest(req.method, req.target, nil)
+			if req.key != "" {
+				r.Header.Set("Idempotency-Key", req.key)
+			}
+			w := httptest.NewRecorder()
+			serveDropped(h, w, r)
+			if got := w.Body.String(); !strings.HasPrefix(got, tc.want[i]) {
+				t.Errorf("%s: request %d answered %.20q, want %q", name, i, got, tc.want[i])
+			}
+			if got := w.Header().Get("Idempotent-Replayed") == "true"; got != tc.replayed[i] {
+				t.Errorf("%s: request %d replayed %v, want %v", name, i, got, tc.replayed[i])
+			}
+		}
+	}
+}
+
+// serveDropped serves r with h, as net/http would a request it's told to
+// drop.
+func serveDropped(h http.Handler, w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if v := recover(); v != nil && v != http.ErrAbortHandler {
+			panic(v)
+		}
+	}()
+	h.ServeHTTP(w, r)
+}
+
+// anyone says every request is from the same caller.
+func anyone(*http.Request) string { return "" }
+
+func TestIdempotencyCallersAndBodies(t *testing.T) {
+	type request struct {
+		auth, body string
+	}
+	for name, tc := range map[string]struct {
+		requests []request
+		want     []string
+	}{
+		"same caller and body": {
+			[]request{{"ada", "a"}, {"ada", "a"}},
+			[]string{"call 1", "call 1"},
+		},
+		"different callers": {
+			[]request{{"ada", "a"}, {"grace", "a"}, {"ada", "a"}},
+			[]string{"call 1", "call 2", "call 1"},
+		},
+		"different bodies": {
+			[]request{{"ada", "a"}, {"ada", "b"}, {"ada", "a"}},
+			[]string{"call 1", `{"title":"Unprocessable Entity"`, "call 1"},
+		},
+	} {
+		var calls int
+		who := func(r *http.Request) string { return r.Header.Get("Authorization") }
+		h := idempotencyHandler{newIdempotencyCache(time.Hour), who, callCounter{&calls}}
+		for i, req := range tc.requests {
+			r := httptest.NewRequest("POST", "/hello", strings.NewReader(req.body))
+			r.Header.Set("Idempotency-Key", "key")
+			r.Header.Set("Authorization", req.auth)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got := w.Body.String(); !strings.HasPrefix(got, tc.want[i]) {
+				t.Errorf("%s: request %d answered %.40q, want %q", name, i, got, tc.want[i])
+			}
+		}
+	}
+}
+
+func TestIdempotencyCacheLimits(t *testing.T) {
+	c := newIdempotencyCache(time.Hour)
+	fill := func(key string, size int) {
+		e, first := c.start(key, sha256.Sum256(nil))
+		if !first {
+			t.Fatalf("%s isn't new", key)
+		}
+		rec := &idempotencyRecorder{ResponseWriter: httptest.NewRecorder(), code: http.StatusOK}
+		rec.Write(make([]byte, size))
+		c.finish(key, e, rec)
+	}
+
+	for i := 0; i < idempotencyMaxEntries+10; i++ {
+		fill(fmt.Sprint("entry ", i), 1)
+	}
+	if n := len(c.entries); n != idempotencyMaxEntries {
+		t.Errorf("%d entries, want %d", n, idempotencyMaxEntries)
+	}
+
+	for i := 0; i < 2*idempotencyMaxBytes/idempotencyMaxBody; i++ {
+		fill(fmt.Sprint("big ", i), idempotencyMaxBody)
+	}
+	if c.bytes > idempotencyMaxBytes {
+		t.Errorf("%d bytes kept, want at most %d", c.bytes, idempotencyMaxBytes)
+	}
+	var total int
+	for _, e := range c.entries {
+		total += len(e.body)
+	}
+	if total != c.bytes {
+		t.Errorf("%d bytes counted, but %d kept", c.bytes, total)
+	}
+}
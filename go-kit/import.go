@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+)
+
+// A file of names can be greeted in bulk by uploading it to POST
+// /hello/import; see transport_import.go. The upload is kept in a temporary
+// file, and greeted in the background by a pool of -import.workers workers
+// that every import shares, so a big one can't crowd out everything else. The
+// answer is a job, whose progress, and the rows that failed, can be followed
+// at GET /hello/import/{id}. Jobs are only kept in memory.
+//
+// A CSV file has a name in each row, and optionally a language after it. If
+// the first row has a "name" column, it's a header, and the columns can be any
+// of name, lang, tz, formality and title, in any order. An NDJSON file has a
+// name or a full hello request on each line, the same as POST /hello/many.
+
+// Import job statuses. A job fails if its file can't be read to the end; rows
+// that can't be greeted are only counted.
+const (
+	importRunning = "running"
+	importDone    = "done"
+	importFailed  = "failed"
+)
+
+// importMaxErrors is how many failed rows a job keeps the details of.
+const importMaxErrors = 1000
+
+// importJob is how an import is getting on. Rows is how many rows have been
+// read so far.
+type importJob struct {
+	ID       string           `json:"id"`
+	Status   string           `json:"status"`
+	Rows     int              `json:"rows"`
+	Greeted  int              `json:"greeted"`
+	Failed   int              `json:"failed"`
+	Errors   []importRowError `json:"errors,omitempty"`
+	Err      string           `json:"err,omitempty"`
+	Created  time.Time        `json:"created"`
+	Finished *time.Time       `json:"finished,omitempty"`
+}
+
+// importRowError is why a row, counting from 1, wasn't greeted.
+type importRowError struct {
+	Row  int    `json:"row"`
+	Name string `json:"name,omitempty"`
+	Err  string `json:"err"`
+}
+
+var errImportNotFound = errors.New("import not found")
+
+// importTask is one row of an import, ready to be greeted.
+type importTask struct {
+	ctx context.Context
+	job *importRun
+	row int
+	req helloRequest
+}
+
+// importRun is an importJob while it's being worked on.
+type importRun struct {
+	mu      sync.Mutex
+	job     importJob
+	pending sync.WaitGroup
+}
+
+func (r *importRun) snapshot() importJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job := r.job
+	job.Errors = append([]importRowError(nil), r.job.Errors...)
+	return job
+}
+
+// fail records a row that wasn't greeted.
+func (r *importRun) fail(row int, name string, err string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.job.Failed++
+	if len(r.job.Errors) < importMaxErrors {
+		r.job.Errors = append(r.job.Errors, importRowError{row, name, err})
+	}
+}
+
+// greetImporter runs import jobs through e.
+type greetImporter struct {
+	e      endpoint.Endpoint
+	logger log.Logger
+	tasks  chan importTask
+
+	mu   sync.Mutex
+	jobs map[string]*importRun
+}
+
+func newGreetImporter(e endpoint.Endpoint, workers int, logger log.Logger) *greetImporter {
+	imp := &greetImporter{e: e, logger: logger, tasks: make(chan importTask), jobs: map[string]*importRun{}}
+	for i := 0; i < workers; i++ {
+		go imp.work()
+	}
+	return imp
+}
+
+// Start starts greeting the rows in the file at path, which the job owns and
+// removes when it's done. Greetings are on behalf of ctx's tenant, if it has
+// one.
+func (imp *greetImporter) Start(ctx context.Context, path string, rows importRows) (importJob, error) {
+	id, err := newRandomID()
+	if err != nil {
+		os.Remove(path)
+		return importJob{}, err
+	}
+	run := &importRun{job: importJob{ID: id, Status: importRunning, Created: time.Now()}}
+	imp.mu.Lock()
+	imp.jobs[id] = run
+	imp.mu.Unlock()
+
+	jobCtx := context.WithValue(context.Background(), callerKey, caller{Transport: "import"})
+	if t, ok := ctx.Value(tenantKey).(tenant); ok {
+		jobCtx = context.WithValue(jobCtx, tenantKey, t)
+	}
+	go imp.read(jobCtx, run, path, rows)
+	return run.snapshot(), nil
+}
+
+// Get returns the job with the ID, or errImportNotFound.
+func (imp *greetImporter) Get(id string) (importJob, error) {
+	imp.mu.Lock()
+	run, ok := imp.jobs[id]
+	imp.mu.Unlock()
+	if !ok {
+		return importJob{}, errImportNotFound
+	}
+	return run.snapshot(), nil
+}
+
+// read hands the job's rows to the workers, and finishes the job once
+// they've all been greeted.
+func (imp *greetImporter) read(ctx context.Context, run *importRun, path string, rows importRows) {
+	defer os.Remove(path)
+
+	readErr := func() error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		next := rows(f)
+		for row := 1; ; row++ {
+			req, err := next()
+			if err == io.EOF {
+				return nil
+			}
+			run.mu.Lock()
+			run.job.Rows++
+			run.mu.Unlock()
+			if rowErr, ok := err.(importRowErr); ok {
+				run.fail(row, "", rowErr.Error())
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			run.pending.Add(1)
+			imp.tasks <- importTask{ctx, run, row, req}
+		}
+	}()
+	run.pending.Wait()
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.job.Status = importDone
+	if readErr != nil {
+		imp.logger.Log("import", run.job.ID, "err", readErr)
+		run.job.Status = importFailed
+		run.job.Err = readErr.Error()
+	}
+	now := time.Now()
+	run.job.Finished = &now
+}
+
+func (imp *greetImporter) work() {
+	for t := range imp.tasks {
+		response, err := imp.e(t.ctx, t.req)
+		switch {
+		case err != nil:
+			t.job.fail(t.row, t.req.Name, err.Error())
+		case response.(helloResponse).Err != nil:
+			t.job.fail(t.row, t.req.Name, response.(helloResponse).Err.Error())
+		default:
+			t.job.mu.Lock()
+			t.job.job.Greeted++
+			t.job.mu.Unlock()
+		}
+		t.job.pending.Done()
+	}
+}
+
+// importRows reads an import file. The func it returns gives the next row,
+// io.EOF after the last, an importRowErr for a row that's no good, or any
+// other error if the rest of the file can't be read.
+type importRows func(io.Reader) func() (helloRequest, error)
+
+// importRowErr is a row that can't be read, in a file that can.
+type importRowErr struct {
+	err error
+}
+
+func (e importRowErr) Error() string { return e.err.Error() }
+
+// csvImportRows reads CSV rows, using lang for rows that don't give one.
+func csvImportRows(lang string) importRows {
+	return func(r io.Reader) func() (helloRequest, error) {
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.TrimLeadingSpace = true
+		columns := []string{"name", "lang"}
+		first := true
+		var next func() (helloRequest, error)
+		next = func() (helloRequest, error) {
+			record, err := cr.Read()
+			if err, ok := err.(*csv.ParseError); ok {
+				return helloRequest{}, importRowErr{err}
+			}
+			if err != nil {
+				return helloRequest{}, err
+			}
+			if first {
+				first = false
+				if isImportHeader(record) {
+					columns = make([]string, len(record))
+					for i, column := range record {
+						columns[i] = strings.ToLower(strings.TrimSpace(column))
+					}
+					return next()
+				}
+			}
+			req := helloRequest{Lang: lang}
+			for i, value := range record {
+				if i >= len(columns) {
+					break
+				}
+				switch columns[i] {
+				case "name":
+					req.Name = value
+				case "lang":
+					if value != "" {
+						req.Lang = value
+					}
+				case "tz":
+					req.TZ = value
+				case "formality":
+					req.Formality = value
+				case "title":
+					req.Title = value
+				}
+			}
+			return req, nil
+		}
+		return next
+	}
+}
+
+func isImportHeader(record []string) bool {
+	for _, column := range record {
+		if strings.EqualFold(strings.TrimSpace(column), "name") {
+			return true
+		}
+	}
+	return false
+}
+
+// importLineMax is the longest line an NDJSON import can have.
+const importLineMax = 1 << 20
+
+// ndjsonImportRows reads NDJSON rows, using lang for rows that don't give
+// one. Blank lines are skipped.
+func ndjsonImportRows(lang string) importRows {
+	return func(r io.Reader) func() (helloRequest, error) {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, importLineMax)
+		return func() (helloRequest, error) {
+			for scanner.Scan() {
+				line := bytes.TrimSpace(scanner.Bytes())
+				if len(line) == 0 {
+					continue
+				}
+				req, err := parseHelloItem(line, lang)
+				if err != nil {
+					return helloRequest{}, importRowErr{err}
+				}
+				return req, nil
+			}
+			if err := scanner.Err(); err != nil {
+				return helloRequest{}, err
+			}
+			return helloRequest{}, io.EOF
+		}
+	}
+}
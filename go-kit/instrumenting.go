@@ -0,0 +1,80 @@
+package main
+
+import (
+	"time"
+
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+)
+
+// Every call to the service is counted and timed, by method, and the numbers
+// are served for Prometheus to scrape at /metrics.
+//
+// Each HTTP greeting endpoint's calls are timed as well, from the outside, in
+// greet_endpoint_latency_seconds, a histogram with the Prometheus client's
+// standard buckets, so that quantiles of it, like
+//
+//	histogram_quantile(0.99, sum by (endpoint, le) (rate(greet_endpoint_latency_seconds_bucket[5m])))
+//
+// say how slow each one is. With -metrics.exemplars, the buckets have the
+// trace ID of a call that fell in them as an exemplar, and /metrics serves
+// OpenMetrics to scrapers that ask for it, which is the only way exemplars
+// are served.
+
+// instrumentingMiddleware records how many calls each method gets, how many
+// of them fail, and how long they take.
+type instrumentingMiddleware struct {
+	requestCount   metrics.Counter
+	errorCount     metrics.Counter
+	requestLatency metrics.Histogram
+	next           GreetService
+}
+
+func (mw instrumentingMiddleware) Hello(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.instrument(ctx, "Hello", s, opts, mw.next.Hello)
+}
+
+func (mw instrumentingMiddleware) Goodbye(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.instrument(ctx, "Goodbye", s, opts, mw.next.Goodbye)
+}
+
+func (mw instrumentingMiddleware) instrument(ctx context.Context, method, s string, opts GreetOptions, call greetMethod) (output Greeting, err error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", method).Add(1)
+		if err != nil {
+			mw.errorCount.With("method", method).Add(1)
+		}
+		mw.requestLatency.With("method", method).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	output, err = call(ctx, s, opts)
+	return
+}
+
+// latencyBuckets are the buckets of greet_endpoint_latency_seconds, in
+// seconds.
+var latencyBuckets = stdprometheus.DefBuckets
+
+// latencyEndpoint returns an endpoint.Middleware that times the calls to the
+// endpoint called name in latency, with their trace ID as an exemplar if
+// exemplars is set and they're being traced.
+func latencyEndpoint(latency *stdprometheus.HistogramVec, name string, exemplars bool) endpoint.Middleware {
+	observer := latency.WithLabelValues(name)
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			defer func(begin time.Time) {
+				took := time.Since(begin).Seconds()
+				if sc := trace.SpanContextFromContext(ctx); exemplars && sc.IsSampled() {
+					observer.(stdprometheus.ExemplarObserver).ObserveWithExemplar(took, stdprometheus.Labels{"trace_id": sc.TraceID().String()})
+					return
+				}
+				observer.Observe(took)
+			}(time.Now())
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Requests for the paths in -ipfilter.paths, /admin/ and /tenants by default,
+// can be limited to clients from some networks. -ipfilter.allow and
+// -ipfilter.deny are comma separated CIDRs, or plain addresses. A client in
+// a denied network is refused, and with any networks allowed, so is a client
+// that isn't in one of them. Refused requests are answered 403.
+//
+// A client is its connection's address, unless that's one of the proxies in
+// -ipfilter.proxies, in which case it's the address the proxies say in
+// X-Forwarded-For: the last one in it that isn't a trusted proxy too. With any
+// rules, a client whose address can't be made out is refused.
+//
+// The rules can be changed while the service runs, under /admin/ipfilter (see
+// transport_ipfilter.go), until it's restarted. Whoever changes them should
+// take care not to shut themselves out.
+
+var errForbidden = errors.New("forbidden")
+
+// ipRules are what an ipFilter lets through.
+type ipRules struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// ipFilter decides which clients are let through to which paths.
+type ipFilter struct {
+	paths   []string
+	proxies []*net.IPNet
+
+	mu    sync.RWMutex
+	rules ipRules
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// newIPFilter returns an ipFilter of the paths, starting with rules.
+func newIPFilter(paths, proxies []string, rules ipRules) (*ipFilter, error) {
+	f := &ipFilter{paths: paths}
+	var err error
+	if f.proxies, err = parseNetworks("proxies", proxies); err != nil {
+		return nil, err
+	}
+	if err := f.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Rules returns the rules in force.
+func (f *ipFilter) Rules() ipRules {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.rules
+}
+
+// SetRules replaces the rules, or fails with a validationError and leaves
+// them as they were if any of them aren't networks.
+func (f *ipFilter) SetRules(rules ipRules) error {
+	allow, err := parseNetworks("allow", rules.Allow)
+	if err != nil {
+		return err
+	}
+	deny, err := parseNetworks("deny", rules.Deny)
+	if err != nil {
+		return err
+	}
+	if rules.Allow == nil {
+		rules.Allow = []string{}
+	}
+	if rules.Deny == nil {
+		rules.Deny = []string{}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules, f.allow, f.deny = rules, allow, deny
+	return nil
+}
+
+// splitList splits a comma separated flag, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseNetworks parses CIDRs and addresses, as networks of one address.
+func parseNetworks(field string, s []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, n := range s {
+		n = strings.TrimSpace(n)
+		if !strings.Contains(n, "/") {
+			ip := net.ParseIP(n)
+			if ip == nil {
+				return nil, validationError{field, "invalid_network", fmt.Sprintf("%q is not a CIDR or IP address", n)}
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(n)
+		if err != nil {
+			return nil, validationError{field, "invalid_network", fmt.Sprintf("%q is not a CIDR or IP address", n)}
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// filters says whether requests for path are filtered.
+func (f *ipFilter) filters(path string) bool {
+	return coversPath(f.paths, path)
+}
+
+// coversPath says whether path is one of paths or under one. A path ending in
+// a slash covers everything under it, and one that doesn't covers itself and
+// everything under it.
+func coversPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if path == p || strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// allows says whether the rules let ip through. A nil ip is only let through
+// if there aren't any rules.
+func (f *ipFilter) allows(ip net.IP) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if len(f.allow) == 0 && len(f.deny) == 0 {
+		return true
+	}
+	if ip == nil || contains(f.deny, ip) {
+		return false
+	}
+	return len(f.allow) == 0 || contains(f.allow, ip)
+}
+
+// clientIP returns the address of the client that made r, or nil if it can't
+// be made out.
+func (f *ipFilter) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !contains(f.proxies, ip) {
+		return ip
+	}
+	var hops []string
+	for _, v := range r.Header["X-Forwarded-For"] {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip = net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil || !contains(f.proxies, ip) {
+			return ip
+		}
+	}
+	// Proxies all the way down; the first of them is as close as it gets.
+	return ip
+}
+
+// ipFilterHandler refuses requests filter doesn't let through.
+type ipFilterHandler struct {
+	filter *ipFilter
+	next   http.Handler
+}
+
+func (h ipFilterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.filter.filters(r.URL.Path) && !h.filter.allows(h.filter.clientIP(r)) {
+		writeError(w, http.StatusForbidden, errForbidden)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
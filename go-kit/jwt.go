@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	stdjwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/net/context"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+)
+
+// With -jwt.jwks set, the HTTP greeting endpoints want a JWT, as an
+// Authorization: Bearer header, signed with -jwt.alg by one of the keys
+// published at that JWKS URL. Keys are fetched when they're first needed, and
+// again every -jwt.jwks.ttl, or sooner when a token names a key that isn't
+// known, in case the keys have been rotated. With -jwt.issuer and
+// -jwt.audience set, the token's iss has to be the issuer, and its aud has to
+// include the audience. Requests without a good token are answered 401.
+// That goes for every transport that greets, not only the chained endpoints:
+// /hello/many, /hello/ws, /hello/import, /graphql, /events, Twirp, JSON-RPC
+// and the gateway are behind the same check, gRPC calls carry the token in
+// their authorization metadata, and Thrift calls, which can't carry one, are
+// refused. Nor can NATS, AMQP, Kafka or MQTT messages, so those transports
+// can't be used with it.
+//
+// The token's claims are in the context the service gets, under
+// kitjwt.JWTClaimsContextKey, and its sub is recorded in the greeting history
+// as the caller's subject.
+
+// jwksMinRefresh is the least time between fetches of the keys for tokens
+// naming keys that aren't known, so a stream of bad tokens can't have the
+// keys fetched for every one.
+const jwksMinRefresh = time.Minute
+
+// errUnauthorized is the error of a call without good credentials. scheme is
+// the authentication scheme they're wanted in, if it's a standard one.
+type errUnauthorized struct {
+	scheme string
+	err    error
+}
+
+func (e errUnauthorized) Error() string { return e.err.Error() }
+
+var errNoToken = errors.New("missing bearer token")
+
+// jwtConfig is what a good token has to be.
+type jwtConfig struct {
+	Keys     *jwksCache
+	Method   stdjwt.SigningMethod
+	Issuer   string
+	Audience string
+}
+
+// newJWTAuthenticator returns an endpoint.Middleware that authenticates
+// calls with tokens from the keys at jwksURL, or lets every call through if
+// jwksURL is empty.
+func newJWTAuthenticator(jwksURL string, ttl time.Duration, alg, issuer, audience string, logger log.Logger) (endpoint.Middleware, error) {
+	if jwksURL == "" {
+		return func(next endpoint.Endpoint) endpoint.Endpoint { return next }, nil
+	}
+	method := stdjwt.GetSigningMethod(alg)
+	if method == nil {
+		return nil, fmt.Errorf("unknown JWT signing method %q", alg)
+	}
+	return authenticateJWT(jwtConfig{
+		Keys:     newJWKSCache(jwksURL, ttl, logger),
+		Method:   method,
+		Issuer:   issuer,
+		Audience: audience,
+	}), nil
+}
+
+// authenticateJWT returns an endpoint.Middleware that only lets calls with a
+// good token through, with the token's claims and subject in their context.
+// Calls without one fail with errUnauthorized.
+func authenticateJWT(c jwtConfig) endpoint.Middleware {
+	parse := kitjwt.NewParser(c.Keys.keyfunc, c.Method, kitjwt.MapClaimsFactory)
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		// Errors from next are passed through in an endpointErr, so they
+		// aren't mistaken for the parser's.
+		authenticated := parse(func(ctx context.Context, request interface{}) (interface{}, error) {
+			claims, _ := ctx.Value(kitjwt.JWTClaimsContextKey).(stdjwt.MapClaims)
+			if err := checkClaims(claims, c.Issuer, c.Audience); err != nil {
+				return nil, errUnauthorized{"Bearer", err}
+			}
+			if sub, ok := claims["sub"].(string); ok {
+				ctx = withCallerSubject(ctx, sub)
+			}
+			response, err := next(ctx, request)
+			if err != nil {
+				return response, endpointErr{err}
+			}
+			return response, nil
+		})
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			response, err := authenticated(ctx, request)
+			switch e := err.(type) {
+			case nil:
+				return response, nil
+			case endpointErr:
+				return response, e.err
+			case errUnauthorized:
+				return nil, e
+			}
+			if err == kitjwt.ErrTokenContextMissing {
+				err = errNoToken
+			}
+			return nil, errUnauthorized{"Bearer", err}
+		}
+	}
+}
+
+// endpointErr is an error that came from further down the chain.
+type endpointErr struct {
+	err error
+}
+
+func (e endpointErr) Error() string { return e.err.Error() }
+
+// checkClaims checks the claims a signature doesn't: that the token was
+// issued by issuer, and is meant for audience, unless they're empty. jwt-go
+// has already checked when it's good for.
+func checkClaims(claims stdjwt.MapClaims, issuer, audience string) error {
+	if issuer != "" && claims["iss"] != issuer {
+		return fmt.Errorf("token not issued by %s", issuer)
+	}
+	if audience == "" {
+		return nil
+	}
+	switch aud := claims["aud"].(type) {
+	case string:
+		if aud == audience {
+			return nil
+		}
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("token not meant for %s", audience)
+}
+
+// jwksCache keeps the keys published at a JWKS URL.
+type jwksCache struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	logger log.Logger
+
+	mu      sync.Mutex
+	keys    map[string]interface{}
+	fetched time.Time
+}
+
+func newJWKSCache(url string, ttl time.Duration, logger log.Logger) *jwksCache {
+	return &jwksCache{url: url, ttl: ttl, client: &http.Client{Timeout: 10 * time.Second}, logger: logger}
+}
+
+// keyfunc is a stdjwt.Keyfunc returning the key the token's kid names. A
+// token without a kid can only be checked if there's just the one key.
+func (c *jwksCache) keyfunc(token *stdjwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key, ok := c.lookup(kid)
+	age := time.Since(c.fetched)
+	if c.keys == nil || age > c.ttl || (!ok && age > jwksMinRefresh) {
+		keys, err := c.fetch()
+		if err != nil {
+			// Carry on with the keys we already have, if any.
+			c.logger.Log("jwks", c.url, "err", err)
+		} else {
+			c.keys = keys
+		}
+		// Don't try again straight away either way.
+		c.fetched = time.Now()
+		key, ok = c.lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (c *jwksCache) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+// jwk is one of the keys in a JWKS. Only public RSA and EC keys are used.
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetch returns the signing keys at the JWKS URL, by kid. Keys it can't use
+// are skipped.
+func (c *jwksCache) fetch() (map[string]interface{}, error) {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS answered %s", resp.Status)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := map[string]interface{}{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			c.logger.Log("jwks", c.url, "kid", k.Kid, "err", err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+var jwkCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := jwkInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := jwkInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve, ok := jwkCurves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := jwkInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := jwkInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// jwkInt decodes one of a JWK's base64url numbers.
+func jwkInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("missing key parameter")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
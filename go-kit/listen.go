@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// listenUnix listens on a unix domain socket at path and sets its file mode,
+// which is how access to the socket is controlled. A socket left behind by a
+// previous run is removed first, but anything that isn't a socket is left
+// alone.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// parseFileMode parses an octal file mode such as "0660".
+func parseFileMode(s string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file mode %q", s)
+	}
+	return os.FileMode(m), nil
+}
+
+// Under systemd socket activation, systemd binds the service's sockets, on
+// privileged ports if need be, and passes them to the process when it starts,
+// on the first connection, say. Each socket's FileDescriptorName= says which
+// listener it's for: http, https, acme, admin, grpc or thrift, or socket for
+// -http.socket's unix domain socket. A socket without one, if it's the only
+// one, is for http. The listeners systemd passes are used
+// instead of -http.addr and the like, and turn their listeners on even if
+// the flags are empty.
+//
+//	# greet.socket
+//	[Socket]
+//	ListenStream=80
+//	FileDescriptorName=http
+
+// systemdFirstFD is the first file descriptor systemd passes.
+const systemdFirstFD = 3
+
+// inheritedListeners are the listeners systemd, or the process being
+// upgraded, see upgrade.go, passed the process, by name, and the ones it's
+// listening on, to pass on when it's upgraded itself. It's safe for
+// concurrent use.
+type inheritedListeners struct {
+	mu        sync.Mutex
+	inherited map[string]net.Listener
+	listening map[string]net.Listener
+
+	// parent is told when the process is ready, if it's an upgrade.
+	parent *os.File
+	// upgraded is set once the process has passed its listeners on.
+	upgraded bool
+}
+
+// systemdListeners returns the listeners systemd, or the process being
+// upgraded, passed the process, if they passed any, and unsets the
+// environment variables they passed them in, so they aren't passed on.
+func systemdListeners() (*inheritedListeners, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv(upgradeParentEnv)
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	listeners := &inheritedListeners{
+		inherited: map[string]net.Listener{},
+		listening: map[string]net.Listener{},
+	}
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		ppid, err := strconv.Atoi(os.Getenv(upgradeParentEnv))
+		if err != nil || ppid != os.Getppid() {
+			return listeners, nil
+		}
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return listeners, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < n; i++ {
+		fd := systemdFirstFD + i
+		syscall.CloseOnExec(fd)
+		name := "http"
+		if i < len(names) && names[i] != "" && names[i] != "unknown" {
+			name = names[i]
+		} else if n > 1 {
+			return nil, fmt.Errorf("systemd passed %d sockets, and socket %d has no FileDescriptorName", n, i)
+		}
+		if _, ok := listeners.inherited[name]; ok {
+			return nil, fmt.Errorf("systemd passed more than one %s socket", name)
+		}
+		f := os.NewFile(uintptr(fd), name)
+		if name == upgradeParentName {
+			listeners.parent = f
+			continue
+		}
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("systemd %s socket: %v", name, err)
+		}
+		listeners.inherited[name] = ln
+	}
+	return listeners, nil
+}
+
+// has says whether the process was passed a listener called name.
+func (l *inheritedListeners) has(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.inherited[name]
+	return ok
+}
+
+// listen returns the listener called name, if the process was passed one,
+// or listens on addr.
+func (l *inheritedListeners) listen(name, addr string) (net.Listener, error) {
+	return l.listenWith(name, func() (net.Listener, error) {
+		return net.Listen("tcp", addr)
+	})
+}
+
+// listenUnix returns the listener called name, if the process was passed
+// one, or listens on a unix domain socket at path with mode, as listenUnix
+// does.
+func (l *inheritedListeners) listenUnix(name, path string, mode os.FileMode) (net.Listener, error) {
+	return l.listenWith(name, func() (net.Listener, error) {
+		return listenUnix(path, mode)
+	})
+}
+
+// listenWith returns the listener called name, if the process was passed
+// one, or the one listen returns, keeping it to pass on.
+func (l *inheritedListeners) listenWith(name string, listen func() (net.Listener, error)) (net.Listener, error) {
+	l.mu.Lock()
+	ln, ok := l.inherited[name]
+	l.mu.Unlock()
+	if !ok {
+		var err error
+		if ln, err = listen(); err != nil {
+			return nil, err
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.listening[name] = ln
+	return ln, nil
+}
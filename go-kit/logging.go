@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/go-kit/kit/log"
+)
+
+// The service logs to -log.file, or stderr, as -log.format: logfmt, or json
+// for log pipelines like ELK's. Either way every line has the same fields to
+// go by: ts, the time in UTC, caller, the file and line that logged it, and
+// level, error for lines with an err and info for the rest unless they say
+// otherwise. Lines about a request have its request_id as well.
+//
+//	{"ts": "2018-06-01T12:00:00.000Z", "caller": "middleware.go:145", "level": "info", "request_id": "...", "method": "Hello", ...}
+
+// newLogger returns a logger that writes to the file at path, or stderr if
+// path is empty, in format, logfmt or json.
+func newLogger(format, path string) (log.Logger, error) {
+	var w io.Writer = os.Stderr
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	w = log.NewSyncWriter(w)
+	var logger log.Logger
+	switch format {
+	case "logfmt":
+		logger = log.NewLogfmtLogger(w)
+	case "json":
+		logger = log.NewJSONLogger(w)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, want logfmt or json", format)
+	}
+	return log.With(levelingLogger{logger}, "ts", log.DefaultTimestampUTC, "caller", log.DefaultCaller), nil
+}
+
+// levelingLogger gives the lines it logs a level, if they haven't one.
+type levelingLogger struct {
+	next log.Logger
+}
+
+// Log implements log.Logger.
+func (l levelingLogger) Log(keyvals ...interface{}) error {
+	level := "info"
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		switch keyvals[i] {
+		case "level":
+			return l.next.Log(keyvals...)
+		case "err":
+			if keyvals[i+1] != nil {
+				level = "error"
+			}
+		}
+	}
+	return l.next.Log(append([]interface{}{"level", level}, keyvals...)...)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/go-kit/kit/log"
+)
+
+// The least level calls are logged at, -log.level to begin with, can be
+// changed while the service runs, under /admin/loglevel, to turn on debug
+// logging during an incident, say. A change can be made to revert by itself
+// after a while, so it isn't left on: with a revert_after, the level goes
+// back to what it was before. Another change while one is waiting to revert
+// replaces it, but still reverts to the level from before either of them.
+// A -config file being reloaded sets the level too.
+
+// logLevelState is the level calls are logged at, and the level it reverts
+// to, and when, if it's going to.
+type logLevelState struct {
+	Level    string     `json:"level"`
+	RevertTo string     `json:"revert_to,omitempty"`
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+// logLevelControl changes the level of settings. It's safe for concurrent
+// use.
+type logLevelControl struct {
+	settings *logSettings
+	logger   log.Logger
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	revertTo logLevel
+	revertAt time.Time
+
+	// changes counts the changes, so a timer can tell whether it's been
+	// overtaken by another.
+	changes uint64
+}
+
+func newLogLevelControl(settings *logSettings, logger log.Logger) *logLevelControl {
+	return &logLevelControl{settings: settings, logger: logger}
+}
+
+// State returns the level in force, and what it'll revert to.
+func (c *logLevelControl) State() logLevelState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state()
+}
+
+// state is State, called with mu held.
+func (c *logLevelControl) state() logLevelState {
+	level, _ := c.settings.Load()
+	s := logLevelState{Level: level.String()}
+	if c.timer != nil {
+		at := c.revertAt
+		s.RevertTo, s.RevertAt = c.revertTo.String(), &at
+	}
+	return s
+}
+
+// Set changes the level to the one called name, reverting it after
+// revertAfter, unless that's 0. A level that isn't one, or a negative
+// revertAfter, is a validationError.
+func (c *logLevelControl) Set(name string, revertAfter time.Duration) (logLevelState, error) {
+	level, err := parseLogLevel(name)
+	if err != nil {
+		return logLevelState{}, validationError{"level", "invalid_level", err.Error()}
+	}
+	if revertAfter < 0 {
+		return logLevelState{}, validationError{"revert_after", "invalid_duration", "revert_after can't be negative"}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current, sample := c.settings.Load()
+	revertTo := current
+	if c.timer != nil {
+		c.timer.Stop()
+		revertTo = c.revertTo
+		c.timer = nil
+	}
+	c.settings.Store(level, sample)
+	c.changes++
+	if revertAfter > 0 {
+		change := c.changes
+		c.timer = time.AfterFunc(revertAfter, func() { c.revert(change) })
+		c.revertTo, c.revertAt = revertTo, time.Now().Add(revertAfter)
+	}
+	c.logger.Log("msg", "log level changed", "from", current, "to", level, "revert_after", revertAfter)
+	return c.state(), nil
+}
+
+// revert puts the level back, unless there's been another change since the
+// one reverted.
+func (c *logLevelControl) revert(change uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.changes != change {
+		return
+	}
+	current, sample := c.settings.Load()
+	c.settings.Store(c.revertTo, sample)
+	c.timer = nil
+	c.logger.Log("msg", "log level reverted", "from", current, "to", c.revertTo)
+}
@@ -1,3 +1,6 @@
+//go:build !lambda
+// +build !lambda
+
 package main
 
 // This is a very simple example of a go-kit service. When executed it will
@@ -5,125 +8,1407 @@ package main
 // with a simple JSON payload of {"name": "Your name here"}
 // One could use cURL to make a request like this:
 // curl -v -X POST -H "Content-Type: application/json" -d '{"name": "Aaron"}' http://localhost:8080/hello
+//
+// The same service is also served over gRPC on localhost:8081, using the
+// definitions in pb/greet.proto, and over Thrift on localhost:8082, using the
+// definitions in thrift/greet.thrift.
 
 // For more indepth examples please head to gokit.io/examples, and read over
 // the many excellent exaples provided there.
 
 import (
-	"encoding/json"
+	"crypto/tls"
 	"errors"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/apache/thrift/lib/go/thrift"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/go-nats"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/segmentio/kafka-go"
+	"github.com/soheilhy/cmux"
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
 	"golang.org/x/net/context"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+
+	"github.com/naunga/monolith/go-kit/pb"
+	thriftgreet "github.com/naunga/monolith/go-kit/thrift/gen-go/greet"
 
+	kitjwt "github.com/go-kit/kit/auth/jwt"
 	"github.com/go-kit/kit/endpoint"
 	log "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/multi"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/go-kit/kit/sd"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
 	kithttp "github.com/go-kit/kit/transport/http"
 )
 
-// GreetService is the interface that defines our service, and it will enable
-// us to create compatible middlewares to add functionality.
-type GreetService interface {
-	Hello(string) (string, error)
+// main runs the service, exiting with a status of 1 if it fails, or of 2 if
+// it's been configured wrong.
+func main() {
+	if err := run(); err != nil {
+		if _, ok := err.(usageError); ok {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
 }
 
-// Here we concrete type that we can use to implement the GreetService interface.
-type greetService struct{}
-
-// Create a struct to represent requests to the service.
-type helloRequest struct {
-	Name string `json:"name,omitempty"`
+// usageError is an error in how the service has been configured.
+type usageError struct {
+	err error
 }
 
-// Create a struct to represent responses from the service.
-type helloResponse struct {
-	Greeting string `json:"greeting,omitempty"`
-	Err      error  `json:"err,omitempty"`
-}
+func (e usageError) Error() string { return e.err.Error() }
+
+// run runs the service until it's stopped. If it can't start, it shuts down
+// whatever it had set up, and logs and returns why.
+func run() (failed error) {
+	var (
+		httpAddr = flag.String("http.addr", ":8080", "HTTP listen address, empty to disable")
+		grpcAddr = flag.String("grpc.addr", ":8081", "gRPC listen address")
+
+		greetProvider      = flag.String("greet.provider", "template", "what phrases greetings: catalog or template, see provider.go")
+		greetTemplatesFile = flag.String("greet.templates", "", "JSON file of greeting templates for the template provider, see templates.go")
+		greetSeed          = flag.Int64("greet.seed", 0, "seed for picking between greeting variants, 0 for a different one every run")
+		greetTimeOfDay     = flag.Bool("greet.timeofday", false, "greet by the time of day, even when the caller gives no time zone")
+		cacheTTL           = flag.Duration("cache.ttl", 0, "how long to keep greetings to give again, 0 not to keep them")
+		cacheSize          = flag.Int("cache.size", 10000, "most greetings to keep for -cache.ttl")
+		nameMaxLen         = flag.Int("name.max", defaultNameMaxLen, "longest name, in characters, the service will greet")
+		filterWords        = flag.String("filter.words", "", "file of extra words, one per line, not to greet anyone as")
+		filterMask         = flag.Bool("filter.mask", false, "mask denied words in names with asterisks instead of refusing the name")
+		transliterateSteps = flag.String("transliterate.steps", "cyrillic,greek,latin,ascii", "comma separated steps that spell greetings in ASCII for requests that ask, see transliterate.go")
+		cardBackground     = flag.String("card.background", "", "PNG or JPEG to draw greeting cards on, empty for a plain white card")
+		historyFile        = flag.String("history.file", "", "file to keep the greeting history in, empty to keep it in memory")
+		scheduleFile       = flag.String("schedule.file", "", "file to keep scheduled greetings in, empty to keep them in memory")
+
+		adminAddr         = flag.String("admin.addr", "", "listen address of the health, metrics, debugging and other operational handlers, like localhost:6060, see admin.go, empty to serve the probes, metrics and log level on the public listeners")
+		adminToken        = flag.String("admin.token", "", "Bearer token the handlers on -admin.addr but the probes want, empty for none")
+		httpHeaderTimeout = flag.Duration("http.timeout.header", 10*time.Second, "how long HTTP clients get to send a request's headers, see server.go")
+		httpReadTimeout   = flag.Duration("http.timeout.read", time.Minute, "how long HTTP clients get to send a whole request, 0 for as long as they like")
+		httpWriteTimeout  = flag.Duration("http.timeout.write", time.Minute, "how long an HTTP response gets to be sent, 0 for as long as it likes")
+		httpIdleTimeout   = flag.Duration("http.timeout.idle", 2*time.Minute, "how long an HTTP connection is kept open between requests")
+		httpHeaderMax     = flag.Int("http.header.max", 1<<20, "most bytes of headers an HTTP request can have")
+		httpBodyMax       = flag.Int64("http.body.max", 1<<20, "most bytes an HTTP request's body can have, see body.go")
+		httpSocket        = flag.String("http.socket", "", "path of a unix socket to also serve HTTP on")
+		httpSocketMode    = flag.String("http.socket.mode", "0660", "file mode of the HTTP unix socket")
+		httpsAddr         = flag.String("https.addr", "", "HTTPS listen address, empty to disable")
+		tlsCert           = flag.String("tls.cert", "", "PEM certificate (chain) for the HTTPS listener")
+		tlsKey            = flag.String("tls.key", "", "PEM private key for the HTTPS listener")
+		acmeDomains       = flag.String("acme.domains", "", "comma separated domains to get the HTTPS listener's certificates for from an ACME CA, see acme.go, instead of -tls.cert and -tls.key")
+		acmeCache         = flag.String("acme.cache", "acme-cache", "directory to keep ACME certificates and the account key in, empty not to keep them")
+		acmeEmail         = flag.String("acme.email", "", "email address for the ACME CA to send notices about the certificates to")
+		acmeDirectory     = flag.String("acme.directory", "", "ACME directory URL, empty for Let's Encrypt")
+		acmeHTTP          = flag.String("acme.http", ":80", "listen address to answer ACME HTTP-01 challenges on, with -acme.domains")
+		tlsReload         = flag.Duration("tls.reload", time.Minute, "how often to check -tls.cert and -tls.key for changes, 0 to only reload them on SIGHUP, see reload.go")
+		tlsMinVersion     = flag.String("tls.min.version", "1.2", "least TLS version the HTTPS listener takes: 1.0, 1.1, 1.2 or 1.3")
+		tlsCiphers        = flag.String("tls.ciphers", "", "comma separated cipher suites the HTTPS listener takes for TLS 1.2 and below, see tls.go, empty for Go's defaults")
+		tlsClientCA       = flag.String("tls.client.ca", "", "PEM CAs to verify HTTPS client certificates with, empty not to ask for them")
+		tlsClientReq      = flag.Bool("tls.client.required", true, "refuse HTTPS connections without a client certificate, with -tls.client.ca")
+		tlsClientIDs      = flag.String("tls.client.identities", "", "JSON file of client certificate identities with their tenants and roles, see mtls.go")
+		corsOrigins       = flag.String("cors.origins", "", "comma separated origins whose pages can call -cors.paths, * for any, empty for none, see cors.go")
+		corsMethods       = flag.String("cors.methods", "GET,HEAD,POST", "comma separated methods cross-origin callers can use")
+		corsHeaders       = flag.String("cors.headers", "Accept,Accept-Language,Authorization,Content-Type,Idempotency-Key,X-API-Key,X-Request-ID", "comma separated request headers cross-origin callers can send")
+		corsMaxAge        = flag.Duration("cors.maxage", 10*time.Minute, "how long browsers can keep preflight responses")
+		corsPaths         = flag.String("cors.paths", "/hello,/goodbye,/greetings,/v1/,/twirp/,/graphql,/rpc,/events", "comma separated paths, and everything under them, that can be called cross-origin")
+		ipFilterPaths     = flag.String("ipfilter.paths", "/admin/,/tenants", "comma separated paths, and everything under them, the IP filter applies to")
+		ipFilterAllow     = flag.String("ipfilter.allow", "", "comma separated CIDRs of the only clients let through to -ipfilter.paths, empty for any")
+		ipFilterDeny      = flag.String("ipfilter.deny", "", "comma separated CIDRs of clients refused -ipfilter.paths")
+		ipFilterProxy     = flag.String("ipfilter.proxies", "", "comma separated CIDRs of proxies to take the client's address from X-Forwarded-For of")
+		auditFile         = flag.String("audit.file", "", "file to append an audit record of every HTTP request that could change something to")
+		auditSyslog       = flag.String("audit.syslog", "", "syslog daemon to send audit records to, like udp://host:514, or local")
+		logFormat         = flag.String("log.format", "logfmt", "format to log in: logfmt or json, see logging.go")
+		logFile           = flag.String("log.file", "", "file to append the log to, empty for stderr")
+		logLevelFlag      = flag.String("log.level", "info", "least level of service calls to log: debug, info, warn or error")
+		logSample         = flag.Float64("log.sample", 1, "fraction of successful service calls logged at info to log; errors are always logged")
+		logRedact         = flag.String("log.redact", "", "comma separated fields of logged service calls, input or output, to redact")
+		logRedactPattern  = flag.String("log.redact.pattern", "", "regular expression to redact matches of in logged service calls")
+		slowThreshold     = flag.Duration("slow.threshold", 0, "log HTTP greeting calls that take longer than this at warn, 0 not to")
+		chaosToken        = flag.String("chaos.token", "", "token in X-Chaos-Token that lets requests have faults injected into them, see chaos.go, empty not to")
+		chaosLatency      = flag.Duration("chaos.latency", time.Second, "latency to inject, with -chaos.token")
+		chaosLatencyRate  = flag.Float64("chaos.latency.rate", 0, "fraction of requests with the chaos token to hold up for -chaos.latency")
+		chaosErrorRate    = flag.Float64("chaos.error.rate", 0, "fraction of requests with the chaos token to fail")
+		chaosDropRate     = flag.Float64("chaos.drop.rate", 0, "fraction of requests with the chaos token to drop the connection of")
+		shadowURL         = flag.String("shadow.url", "", "backend to mirror a share of the greeting requests to, responses discarded, empty not to")
+		shadowPercent     = flag.Float64("shadow.percent", 100, "percentage of the requests for -shadow.paths to mirror to -shadow.url")
+		shadowPaths       = flag.String("shadow.paths", "/hello,/goodbye", "comma separated paths, and everything under them, to mirror requests for")
+		shadowInflight    = flag.Int("shadow.inflight", 64, "most mirrored requests to have in flight at once")
+		shadowBody        = flag.Int64("shadow.body", 1<<20, "largest request body to mirror, in bytes")
+		shadowTimeout     = flag.Duration("shadow.timeout", 5*time.Second, "how long mirrored requests get")
+		canaryProvider    = flag.String("canary.provider", "", "greeting provider of a canary version of the HTTP greeting endpoints, see canary.go, empty for none")
+		canaryPercent     = flag.Float64("canary.percent", 0, "percentage of HTTP greeting calls to send to the canary")
+		canaryHeaderFlag  = flag.String("canary.header", "X-Canary=1", "header, as name=value, or just name for any value, of calls to send to the canary")
+		singleflightFlag  = flag.Bool("singleflight", false, "make identical HTTP greeting calls that are in flight at once only once, see singleflight.go")
+		shutdownTimeout   = flag.Duration("shutdown.timeout", 15*time.Second, "how long requests in progress get to finish when the service shuts down")
+		upgradeTimeout    = flag.Duration("upgrade.timeout", time.Minute, "how long the new process gets to be ready on a SIGUSR2 upgrade, see upgrade.go")
+		shutdownDelay     = flag.Duration("shutdown.delay", 0, "how long to go on serving after /readyz starts failing on shutdown, before draining requests")
+		configPath        = flag.String("config", "", "YAML file of settings, keyed by flag name, and templates, see configfile.go")
+		configInterval    = flag.Duration("config.interval", 5*time.Second, "how often to check -config for changes, 0 not to")
+		healthTimeout     = flag.Duration("health.timeout", 2*time.Second, "how long each of the checks behind /healthz gets to answer")
+		consulAddr        = flag.String("consul.addr", "", "address of the Consul agent to register with, like localhost:8500, see consul.go, empty not to")
+		consulInterval    = flag.Duration("consul.check.interval", 10*time.Second, "how often Consul checks the health of the registered instance")
+		etcdEndpoints     = flag.String("etcd.endpoints", "", "comma separated etcd endpoints to register with instead of Consul, like http://localhost:2379, see etcd.go, empty not to")
+		etcdPrefix        = flag.String("etcd.prefix", "/services/", "what the keys registered in etcd start with")
+		etcdTTL           = flag.Duration("etcd.ttl", 30*time.Second, "TTL of the lease the key registered in etcd is on, renewed while the service runs")
+		registerName      = flag.String("register.name", "greet", "name of the service to register as an instance of")
+		registerAddr      = flag.String("register.addr", "", "host:port to register the instance at, empty for the host's name and the port of -http.addr")
+		registerTags      = flag.String("register.tags", "", "comma separated tags to register the instance with")
+		registerCheck     = flag.String("register.check", "", "URL the registry checks the instance's health at, empty for /readyz at the registered host, see register.go")
+		statsdAddr        = flag.String("statsd.addr", "", "address of a StatsD server to push the service's metrics to over UDP, like localhost:8125, see statsd.go, empty not to")
+		statsdFormat      = flag.String("statsd.format", "statsd", "what -statsd.addr speaks: statsd, or dogstatsd for tags")
+		statsdPrefix      = flag.String("statsd.prefix", "greet.", "what the names of the metrics pushed to -statsd.addr start with")
+		statsdTags        = flag.String("statsd.tags", "", "comma separated key:value tags of the metrics pushed to -statsd.addr, dogstatsd only")
+		statsdInterval    = flag.Duration("statsd.interval", 10*time.Second, "how often to push metrics to -statsd.addr")
+		metricsExemplars  = flag.Bool("metrics.exemplars", false, "attach trace IDs to the endpoint latency histograms as exemplars, served as OpenMetrics")
+		serviceChainFlag  = flag.String("middleware.service", defaultServiceChain, "comma separated service middlewares, outermost first, see chain.go")
+		endpointChainFlag = flag.String("middleware.endpoint", defaultEndpointChain, "comma separated HTTP greeting endpoint middlewares, outermost first, see chain.go")
+		rbacPolicyFile    = flag.String("rbac.policy", "", "JSON file of the roles that have each HTTP endpoint permission, see rbac.go, empty for anyone to have all but the restricted ones")
+		httpH2C           = flag.Bool("http.h2c", true, "accept HTTP/2 without TLS (h2c) on the HTTP listeners")
+		otelEndpoint      = flag.String("otel.endpoint", "", "OTLP/HTTP URL to send traces to, e.g. http://localhost:4318/v1/traces, empty to not send them")
+		otelService       = flag.String("otel.service", "greet", "service name to report in traces")
+		zipkinURL         = flag.String("zipkin.url", "", "Zipkin URL to send traces to, e.g. http://localhost:9411/api/v2/spans, empty to not send them")
+		tracePropagate    = flag.String("trace.propagation", "tracecontext,baggage", "comma separated headers to carry on traces in: tracecontext, baggage, b3 or b3multi")
+		idempotencyTTL    = flag.Duration("idempotency.ttl", 24*time.Hour, "how long to remember responses by Idempotency-Key, 0 to ignore the header")
+		httpCmux          = flag.Bool("http.cmux", false, "also serve gRPC on the HTTP address, telling the protocols apart per connection")
+
+		webhookURLs    = flag.String("webhook.urls", "", "comma-separated URLs to POST every greeting to, empty to disable")
+		webhookSecret  = flag.String("webhook.secret", "", "key to sign webhook requests with, empty not to sign them")
+		webhookTimeout = flag.Duration("webhook.timeout", 5*time.Second, "timeout for each webhook request")
+		webhookRetries = flag.Int("webhook.retries", 3, "number of times to retry a failed webhook request")
+
+		batchMax         = flag.Int("batch.max", 100, "maximum number of names in a POST /hello/batch request")
+		batchConcurrency = flag.Int("batch.concurrency", 8, "number of names in a batch greeted at once")
+		importWorkers    = flag.Int("import.workers", 4, "number of names from POST /hello/import files greeted at once, across every import")
+		rateLimitRPS     = flag.Float64("ratelimit.rps", 0, "greetings a second the service gives over every transport between them, 0 for no limit")
+		rateLimitBurst   = flag.Int("ratelimit.burst", 0, "requests over -ratelimit.rps taken at once, 0 for -ratelimit.rps rounded up")
+		timeout          = flag.Duration("timeout", 0, "how long the HTTP greeting endpoints get to answer before a 504, 0 for as long as they like")
+		endpointTimeouts = flag.String("timeouts", "", "comma separated name=duration timeouts for some of hello, goodbye, card and batch, instead of -timeout")
+		bulkheadMax      = flag.Int("bulkhead.max", 0, "calls each HTTP greeting endpoint serves at once, 0 for no limit")
+		bulkheadQueue    = flag.Int("bulkhead.queue", 0, "calls over -bulkhead.max each endpoint holds to wait their turn, rather than answering 503")
+		bulkheadWait     = flag.Duration("bulkhead.wait", time.Second, "how long a call waits its turn before a 503")
+		breakerFailures  = flag.Uint("breaker.failures", 0, "failures in a row that open the HTTP greeting endpoints' circuit breakers, 0 for no breakers")
+		breakerRatio     = flag.Float64("breaker.ratio", 0, "share of failed calls in -breaker.interval, once there have been -breaker.failures calls, that opens a breaker, 0 to go by failures in a row only")
+		breakerInterval  = flag.Duration("breaker.interval", time.Minute, "how often a closed breaker forgets its failures, 0 for never")
+		breakerTimeout   = flag.Duration("breaker.timeout", 30*time.Second, "how long a breaker stays open before probing the service")
+		breakerProbes    = flag.Uint("breaker.probes", 1, "calls a half-open breaker lets through to probe the service")
+		jwtJWKS          = flag.String("jwt.jwks", "", "JWKS URL of the keys to check Bearer tokens to the HTTP greeting endpoints with, empty to not want tokens")
+		jwtJWKSTTL       = flag.Duration("jwt.jwks.ttl", time.Hour, "how long to keep the keys from -jwt.jwks before fetching them again")
+		jwtAlg           = flag.String("jwt.alg", "RS256", "signing method tokens have to use, e.g. RS256 or ES256")
+		jwtIssuer        = flag.String("jwt.issuer", "", "issuer tokens have to come from, empty for any")
+		jwtAudience      = flag.String("jwt.audience", "", "audience tokens have to be for, empty for any")
+		oidcIssuer       = flag.String("oidc.issuer", "", "OIDC issuer whose introspection endpoint to check opaque Bearer tokens at, instead of -jwt.jwks")
+		oidcIntrospect   = flag.String("oidc.introspect", "", "token introspection URL, if it isn't to be discovered from -oidc.issuer")
+		oidcClientID     = flag.String("oidc.client.id", "", "client ID to introspect tokens as")
+		oidcClientSecret = flag.String("oidc.client.secret", "", "client secret to introspect tokens with")
+		oidcAudience     = flag.String("oidc.audience", "", "audience introspected tokens have to be for, empty for any")
+		oidcCache        = flag.Duration("oidc.cache", time.Minute, "how long to keep what the introspection endpoint says about a token")
+		oidcRPS          = flag.Float64("oidc.introspect.rps", 10, "how many tokens that aren't known to ask the introspection endpoint about a second, 0 for no limit")
+		apiKeys          = flag.String("apikeys", "", "comma separated id=key pairs of API keys the HTTP greeting endpoints take in X-API-Key")
+		apiKeysFile      = flag.String("apikeys.file", "", "JSON file of API keys, with their tenants and scopes, see apikeys.go")
+		apiKeysRequired  = flag.Bool("apikeys.required", false, "refuse HTTP greetings without an API key")
+
+		thriftAddr       = flag.String("thrift.addr", ":8082", "Thrift listen address")
+		thriftProtocol   = flag.String("thrift.protocol", "binary", "binary, compact, json, simplejson")
+		thriftBufferSize = flag.Int("thrift.buffer.size", 0, "0 for unbuffered")
+		thriftFramed     = flag.Bool("thrift.framed", false, "true to enable framing")
+
+		sseHeartbeat = flag.Duration("sse.heartbeat", 15*time.Second, "interval between heartbeats on /hello/stream")
+		sseKeep      = flag.Int("sse.keep", 100, "number of recent greetings kept for clients resuming /hello/stream")
 
-// Go Kit uses the RPC model to communicate. So it expects us to not only create
-// structs for requests and responses for each endpoint, but also functions to
-// decode requests and encode responses.
+		natsURL     = flag.String("nats.url", "", "NATS server URL, empty to disable")
+		natsSubject = flag.String("nats.subject", "greet.hello", "NATS subject for hello requests")
+		natsQueue   = flag.String("nats.queue", "greet", "NATS queue group shared by all instances")
 
-func decodeHelloRequest(_ context.Context, r *http.Request) (interface{}, error) {
-	var request helloRequest
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		return nil, err
+		amqpURL      = flag.String("amqp.url", "", "AMQP broker URL, empty to disable")
+		amqpQueue    = flag.String("amqp.queue", "greet.hello", "AMQP queue to consume hello requests from")
+		amqpExchange = flag.String("amqp.exchange", "greet.replies", "AMQP exchange to publish responses to")
+		amqpPrefetch = flag.Int("amqp.prefetch", 10, "number of unacknowledged deliveries to hold at once")
+
+		kafkaBrokers  = flag.String("kafka.brokers", "", "comma-separated Kafka brokers, empty to disable")
+		kafkaGroup    = flag.String("kafka.group", "greet", "Kafka consumer group")
+		kafkaInTopic  = flag.String("kafka.topic.in", "greet.hello", "Kafka topic to consume hello requests from")
+		kafkaOutTopic = flag.String("kafka.topic.out", "greet.hello.replies", "Kafka topic to produce responses to")
+
+		mqttBroker   = flag.String("mqtt.broker", "", "MQTT broker URL, e.g. tcp://localhost:1883, empty to disable")
+		mqttClientID = flag.String("mqtt.client.id", "greet", "MQTT client ID")
+		mqttPrefix   = flag.String("mqtt.prefix", "greet", "MQTT topic prefix")
+		mqttQoS      = flag.Int("mqtt.qos", 1, "MQTT quality of service for subscriptions and replies (0, 1 or 2)")
+	)
+	flag.Parse()
+
+	ctx := context.Background()
+	logger := log.NewLogfmtLogger(os.Stderr)
+	defer func() {
+		if failed != nil {
+			logger.Log("err", failed)
+		}
+	}()
+
+	if err := setFlagsFromEnv(flag.CommandLine); err != nil {
+		return usageError{err}
 	}
-	return request, nil
-}
+	inherited, err := systemdListeners()
+	if err != nil {
+		return err
+	}
+	httpsOn := *httpsAddr != "" || inherited.has("https")
 
-func encodeHelloResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
-	return json.NewEncoder(w).Encode(response)
-}
+	var (
+		problems configErrors
+		live     *liveConfig
+		file     configFile
+	)
+	if *configPath != "" {
+		live = newLiveConfig(*configPath, flag.CommandLine)
+		var err error
+		if file, err = readConfigFile(*configPath); err != nil {
+			return usageError{err}
+		}
+		if err := setFlagsFromFile(flag.CommandLine, file); err != nil {
+			return usageError{err}
+		}
+	}
+	if l, err := newLogger(*logFormat, *logFile); err != nil {
+		problems.add("-log.format or -log.file: %v", err)
+	} else {
+		logger = l
+	}
+	problems.check(*batchConcurrency >= 1, "-batch.concurrency must be at least 1")
+	problems.check(*importWorkers >= 1, "-import.workers must be at least 1")
+	problems.check(!httpsOn || *acmeDomains != "" || (*tlsCert != "" && *tlsKey != ""), "-https.addr needs -tls.cert and -tls.key, or -acme.domains")
+	problems.check(*acmeDomains == "" || httpsOn, "-acme.domains needs -https.addr")
+	problems.check(*bulkheadMax >= 0 && *bulkheadQueue >= 0, "-bulkhead.max and -bulkhead.queue can't be negative")
+	problems.check(*cacheTTL <= 0 || *cacheSize >= 1, "-cache.size must be at least 1")
+	problems.check(*rateLimitRPS >= 0 && *rateLimitBurst >= 0, "-ratelimit.rps and -ratelimit.burst can't be negative")
+	problems.check(*logSample >= 0 && *logSample <= 1, "-log.sample must be between 0 and 1")
+	problems.check(*mqttQoS >= 0 && *mqttQoS <= 2, "-mqtt.qos must be 0, 1 or 2")
+	for name, d := range map[string]time.Duration{
+		"shutdown.timeout":    *shutdownTimeout,
+		"shutdown.delay":      *shutdownDelay,
+		"health.timeout":      *healthTimeout,
+		"timeout":             *timeout,
+		"bulkhead.wait":       *bulkheadWait,
+		"config.interval":     *configInterval,
+		"cors.maxage":         *corsMaxAge,
+		"tls.reload":          *tlsReload,
+		"http.timeout.header": *httpHeaderTimeout,
+		"http.timeout.read":   *httpReadTimeout,
+		"http.timeout.write":  *httpWriteTimeout,
+		"http.timeout.idle":   *httpIdleTimeout,
+		"shadow.timeout":      *shadowTimeout,
+		"webhook.timeout":     *webhookTimeout,
+	} {
+		problems.check(d >= 0, "-%s can't be negative", name)
+	}
+	problems.check(*consulAddr == "" || *consulInterval > 0, "-consul.check.interval must be more than 0")
+	problems.check(*consulAddr == "" || *etcdEndpoints == "", "-consul.addr and -etcd.endpoints can't both be set")
+	problems.check(*etcdEndpoints == "" || *etcdTTL >= time.Second, "-etcd.ttl must be at least 1s")
+	problems.check(*statsdAddr == "" || *statsdInterval > 0, "-statsd.interval must be more than 0")
+	problems.check(*statsdFormat == "statsd" || *statsdFormat == "dogstatsd", "-statsd.format must be statsd or dogstatsd")
+	problems.check(*statsdTags == "" || *statsdFormat == "dogstatsd", "-statsd.tags needs -statsd.format dogstatsd")
+	problems.check(*upgradeTimeout > 0, "-upgrade.timeout must be more than 0")
+	problems.check(*sseHeartbeat > 0, "-sse.heartbeat must be more than 0")
+	problems.check(*httpHeaderMax > 0, "-http.header.max must be more than 0")
+	problems.check(*httpBodyMax > 0, "-http.body.max must be more than 0")
+	// Credentials that are asked for have to be checked on the chained
+	// endpoints too, or they could be called without them.
+	endpointMiddlewares := map[string]bool{}
+	for _, name := range splitList(*endpointChainFlag) {
+		endpointMiddlewares[name] = true
+	}
+	for _, auth := range []struct {
+		flags      string
+		set        bool
+		middleware string
+	}{
+		{"-jwt.jwks", *jwtJWKS != "", "jwt"},
+		{"-oidc.issuer or -oidc.introspect", *oidcIssuer != "" || *oidcIntrospect != "", "jwt"},
+		{"-apikeys, -apikeys.file or -apikeys.required", *apiKeys != "" || *apiKeysFile != "" || *apiKeysRequired, "apikey"},
+		{"-tls.client.ca", *tlsClientCA != "", "cert"},
+		{"-rbac.policy", *rbacPolicyFile != "", "authorize"},
+	} {
+		problems.check(!auth.set || endpointMiddlewares[auth.middleware], "%s needs %s in -middleware.endpoint", auth.flags, auth.middleware)
+	}
+	// Nor can the message transports, whose requests carry no credentials,
+	// be served where they're wanted.
+	credentialsRequired := *jwtJWKS != "" || *oidcIssuer != "" || *oidcIntrospect != "" || *apiKeysRequired
+	var messageTransports []string
+	for _, transport := range []struct {
+		flag string
+		set  bool
+	}{
+		{"-nats.url", *natsURL != ""},
+		{"-amqp.url", *amqpURL != ""},
+		{"-kafka.brokers", *kafkaBrokers != ""},
+		{"-mqtt.broker", *mqttBroker != ""},
+	} {
+		if transport.set {
+			messageTransports = append(messageTransports, transport.flag)
+			problems.check(!credentialsRequired, "%s can't be used with -jwt.jwks, -oidc.issuer, -oidc.introspect or -apikeys.required, its requests carry no credentials", transport.flag)
+		}
+	}
+	tlsVersion, err := parseTLSVersion(*tlsMinVersion)
+	if err != nil {
+		problems.add("-tls.min.version: %v", err)
+	}
+	cipherSuites, err := parseCipherSuites(*tlsCiphers)
+	if err != nil {
+		problems.add("-tls.ciphers: %v", err)
+	}
+	if err := problems.err(); err != nil {
+		return usageError{err}
+	}
+	build := readBuildInfo()
+	logger.Log(append([]interface{}{"msg", "starting"}, build.keyvals()...)...)
 
-// Hello is the func that is required to implement the GreetService interface.
-// creating this func makes the greetService type implicitly implement the
-// GreetService interface.
-func (g greetService) Hello(s string) (string, error) {
-	if s == "" {
-		return "", errors.New("no name provided")
+	seed := *greetSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
 	}
-	return "Hello there, " + strings.Title(s), nil
-}
+	templates, err := openTemplateStore(*greetTemplatesFile)
+	if err != nil {
+		return err
+	}
+	// What can change without a restart is read again on a SIGHUP, see
+	// reload.go.
+	reloads := &reloader{logger: logger}
+	if *greetTemplatesFile != "" {
+		source, err := newTemplatesFile(*greetTemplatesFile, templates)
+		if err != nil {
+			return err
+		}
+		reloads.add(source)
+	}
+	provider, err := newGreetingProvider(*greetProvider, providerConfig{
+		Templates: templates,
+		Seed:      seed,
+	})
+	if err != nil {
+		return err
+	}
+	tenants := newMemTenantStore()
+	withTenants := func(provider GreetingProvider) GreetingProvider {
+		provider = tenantProvider{tenants, newPicker(seed), provider}
+		if *cacheTTL > 0 {
+			provider = newCachingProvider(*cacheTTL, *cacheSize, []templateVersioner{templates, tenants}, provider)
+		}
+		return provider
+	}
+	provider = withTenants(provider)
 
-// A Go Kit Endpoint is a func that takes a Context and a interface{} (empty interface)
-// as parameters and returns an empty interface type and an error.
-func makeHelloEndpoint(svc GreetService) endpoint.Endpoint {
-	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		req := request.(helloRequest)
-		resp, err := svc.Hello(req.Name)
+	translit, err := newTransliterator(*transliterateSteps)
+	if err != nil {
+		return err
+	}
+
+	var words NameFilter = newWordFilter(defaultDenylist, *filterMask)
+	if *filterWords != "" {
+		list, err := newWordListFilter(*filterWords, *filterMask)
 		if err != nil {
-			return helloResponse{resp, err}, nil
+			return err
 		}
-		return helloResponse{resp, nil}, nil
+		words = list
+		reloads.add(list)
 	}
-}
 
-// Here we create a middleware type that will implment the GreetService interface
-type loggingMiddleware struct {
-	logger log.Logger
-	next   GreetService
-}
+	health := newHealthChecks(*healthTimeout)
+	ready := &readiness{}
 
-// This instance of the Hello func makes the loggingMiddleware implment the
-// GreetService interface, which makes it compatible with the greetService type,
-// and allows us to chain different types of middlewares together to extend the
-// service.
-func (mw loggingMiddleware) Hello(s string) (output string, err error) {
-	defer func(begin time.Time) {
-		mw.logger.Log(
-			"method", "Hello",
-			"input", s,
-			"err", err,
-			"took", time.Since(begin),
-		)
-	}(time.Now())
+	var history HistoryStore = newMemHistoryStore()
+	if *historyFile != "" {
+		var err error
+		if history, err = openFileHistoryStore(*historyFile); err != nil {
+			return err
+		}
+	}
+	health.Register("history", CheckerFunc(func(context.Context) error {
+		_, err := history.List(0, 1)
+		return err
+	}))
 
-	output, err = mw.next.Hello(s)
-	return
-}
+	var schedules ScheduleStore = newMemScheduleStore()
+	if *scheduleFile != "" {
+		var err error
+		if schedules, err = openFileScheduleStore(*scheduleFile); err != nil {
+			return err
+		}
+	}
 
-func main() {
-	ctx := context.Background()
-	logger := log.NewLogfmtLogger(os.Stderr)
+	broker := newGreetingBroker(*sseKeep)
+	profiles := newMemProfileStore()
+	aliases := newMemAliasStore()
+	stats := newGreetStats()
+	publishVars(stats)
+
+	callLevel, err := parseLogLevel(*logLevelFlag)
+	if err != nil {
+		return err
+	}
+	logs := newLogSettings(callLevel, *logSample)
+	var redactors []redactor
+	if fields := splitList(*logRedact); len(fields) > 0 {
+		redactors = append(redactors, redactFields(fields))
+	}
+	if *logRedactPattern != "" {
+		re, err := regexp.Compile(*logRedactPattern)
+		if err != nil {
+			return err
+		}
+		redactors = append(redactors, redactPattern(re))
+	}
+	// The middlewares' state is shared, so that services built from the same
+	// chain, the canary's as well as the primary's, are one service.
+	var webhooks *webhookSender
+	if hooks := parseWebhookURLs(*webhookURLs); len(hooks) > 0 {
+		webhooks = newWebhookSender(hooks, *webhookSecret, *webhookTimeout, *webhookRetries, logger)
+	}
+	tenantLimits := newTenantLimiters()
+	fieldKeys := []string{"method"}
+	instruments := instrumentingMiddleware{
+		requestCount: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "greet",
+			Subsystem: "service",
+			Name:      "request_count",
+			Help:      "Number of requests received.",
+		}, fieldKeys),
+		errorCount: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "greet",
+			Subsystem: "service",
+			Name:      "error_count",
+			Help:      "Number of requests that failed.",
+		}, fieldKeys),
+		requestLatency: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: "greet",
+			Subsystem: "service",
+			Name:      "request_latency_seconds",
+			Help:      "Time spent serving requests, in seconds.",
+		}, fieldKeys),
+	}
+	var pushed *statsdSink
+	if *statsdAddr != "" {
+		if pushed, err = newStatsdSink(*statsdAddr, *statsdFormat, *statsdPrefix, splitList(*statsdTags), logger); err != nil {
+			return err
+		}
+		instruments.requestCount = multi.NewCounter(instruments.requestCount, pushed.Counter("service.request_count"))
+		instruments.errorCount = multi.NewCounter(instruments.errorCount, pushed.Counter("service.error_count"))
+		instruments.requestLatency = multi.NewHistogram(instruments.requestLatency, pushed.Latency("service.request_latency"))
+	}
+	services := serviceChain{
+		"logging": func(next GreetService) GreetService {
+			return loggingMiddleware{logger: logger, next: next, settings: logs, redact: redactors}
+		},
+		"events":  func(next GreetService) GreetService { return eventMiddleware{broker, next} },
+		"history": func(next GreetService) GreetService { return historyMiddleware{history, logger, next} },
+		"webhooks": func(next GreetService) GreetService {
+			if webhooks == nil {
+				return next
+			}
+			return webhookMiddleware{webhooks, next}
+		},
+		"filter":        func(next GreetService) GreetService { return filteringMiddleware{words, next} },
+		"transliterate": func(next GreetService) GreetService { return transliteratingMiddleware{translit, next} },
+		"aliases":       func(next GreetService) GreetService { return aliasMiddleware{aliases, next} },
+		"validate":      func(next GreetService) GreetService { return validatingMiddleware{*nameMaxLen, next} },
+		"stats":         func(next GreetService) GreetService { return statsMiddleware{stats, next} },
+		"profiles":      func(next GreetService) GreetService { return profileMiddleware{profiles, next} },
+		"tenants":       func(next GreetService) GreetService { return tenantMiddleware{tenantLimits, next} },
+		"metrics": func(next GreetService) GreetService {
+			mw := instruments
+			mw.next = next
+			return mw
+		},
+	}
+	svc, err := services.build(splitList(*serviceChainFlag), greetService{
+		provider:    provider,
+		clock:       systemClock{},
+		byTimeOfDay: *greetTimeOfDay,
+	})
+	if err != nil {
+		return err
+	}
+	canaryHeader, canaryValue := parseCanaryHeader(*canaryHeaderFlag)
+	canary := canaryConfig{
+		Percent: *canaryPercent,
+		Header:  canaryHeader,
+		Value:   canaryValue,
+		requests: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "greet",
+			Name:      "canary_requests_total",
+			Help:      "HTTP greeting calls, by endpoint, variant and outcome.",
+		}, []string{"endpoint", "variant", "outcome"}),
+		latency: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: "greet",
+			Name:      "canary_latency_seconds",
+			Help:      "Time each variant of the HTTP greeting endpoints spent answering calls, in seconds.",
+			Buckets:   latencyBuckets,
+		}, []string{"endpoint", "variant"}),
+	}
+	if *canaryProvider != "" {
+		p, err := newGreetingProvider(*canaryProvider, providerConfig{
+			Templates: templates,
+			Seed:      seed,
+		})
+		if err != nil {
+			return err
+		}
+		canarySvc, err := services.build(splitList(*serviceChainFlag), greetService{
+			provider:    withTenants(p),
+			clock:       systemClock{},
+			byTimeOfDay: *greetTimeOfDay,
+		})
+		if err != nil {
+			return err
+		}
+		canary.endpoints = map[string]endpoint.Endpoint{
+			"hello":   makeHelloEndpoint(canarySvc),
+			"goodbye": makeGoodbyeEndpoint(canarySvc),
+			"card":    makeHelloEndpoint(canarySvc),
+			"batch":   makeHelloBatchEndpoint(canarySvc, *batchConcurrency),
+		}
+	}
+	canaryToContext := canary.toContext()
+
+	propagator, err := newTracePropagator(*tracePropagate)
+	if err != nil {
+		return err
+	}
+	tracerProvider := newTracerProvider(*otelEndpoint, *zipkinURL, *otelService)
+	defer tracerProvider.Shutdown(context.Background())
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagator)
+	tracer := tracerProvider.Tracer("github.com/naunga/monolith/go-kit")
 
-	var svc GreetService
-	svc = greetService{}
-	svc = loggingMiddleware{logger, svc}
+	authenticate, err := newJWTAuthenticator(*jwtJWKS, *jwtJWKSTTL, *jwtAlg, *jwtIssuer, *jwtAudience, logger)
+	if err != nil {
+		return err
+	}
+	if *oidcIssuer != "" || *oidcIntrospect != "" {
+		if *jwtJWKS != "" {
+			return errors.New("-jwt.jwks and -oidc.issuer or -oidc.introspect are different ways of checking tokens, pick one")
+		}
+		authenticate, err = newIntrospectionAuthenticator(*oidcIssuer, *oidcIntrospect, *oidcClientID, *oidcClientSecret, *oidcAudience, *oidcCache, *oidcRPS)
+		if err != nil {
+			return err
+		}
+	}
+	keyToContext, authenticateKey, err := newAPIKeyAuthenticator(*apiKeys, *apiKeysFile, *apiKeysRequired, tenants)
+	if err != nil {
+		return err
+	}
+	apiKeyToContext := keyToContext.fromHTTP
+	certIdentities, err := readCertIdentities(*tlsClientIDs)
+	if err != nil {
+		return err
+	}
+	certToContext := makeCertToContext(certIdentities, tenants)
+	policy, err := openRBACPolicy(*rbacPolicyFile)
+	if err != nil {
+		return err
+	}
+	if len(messageTransports) > 0 && policy.rolesFor("greet") != nil {
+		return usageError{fmt.Errorf("%s can't be used with a -rbac.policy that restricts greet, its requests carry no credentials", messageTransports[0])}
+	}
+	az := authz{
+		before:       []kithttp.RequestFunc{traceToContext, requestIDToContext, auditToContext, kitjwt.HTTPToContext(), callerToContext, tenantToContext, certToContext, apiKeyToContext},
+		authenticate: endpoint.Chain(authenticate, authenticateKey, authenticateCert, authenticateTenant(tenants)),
+		policy:       policy,
+	}
+	limiter := newRateLimiter(*rateLimitRPS, *rateLimitBurst)
+	limit := rateLimitEndpoint(limiter)
+	limitBatch := rateLimitEndpointN(limiter, func(request interface{}) int {
+		return len(request.(helloBatchRequest).Names)
+	})
+	waitLimit := waitRateLimitEndpoint(limiter)
+	// The greeting transports that aren't chained, see below, are behind
+	// greeting instead, so a token or key that's wanted is wanted everywhere,
+	// and they take from the same bucket. Those that greet more than once a
+	// request are behind authorized, and take from it for each greeting.
+	authorized := endpoint.Chain(az.authenticate, authorize(policy, "greet"))
+	greeting := endpoint.Chain(authorized, limit)
+	if live != nil {
+		live.logs, live.limiter, live.templates, live.logger = logs, limiter, templates, logger
+		if err := live.apply(file); err != nil {
+			return usageError{err}
+		}
+		reloads.add(live)
+	}
+	timeouts, err := parseTimeouts(*timeout, *endpointTimeouts)
+	if err != nil {
+		return err
+	}
+	breakers := breakerConfig{
+		Failures: uint32(*breakerFailures),
+		Ratio:    *breakerRatio,
+		Interval: *breakerInterval,
+		Timeout:  *breakerTimeout,
+		Probes:   uint32(*breakerProbes),
+	}
+	breakerState := kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "greet",
+		Name:      "breaker_state",
+		Help:      "State of each circuit breaker: 0 closed, 1 half-open, 2 open.",
+	}, []string{"name"})
+	bulkheads := bulkheadConfig{
+		Max:   *bulkheadMax,
+		Queue: *bulkheadQueue,
+		Wait:  *bulkheadWait,
+	}
+	bulkheadInflight := kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "greet",
+		Name:      "bulkhead_inflight",
+		Help:      "Calls each endpoint is serving.",
+	}, []string{"name"})
+	helloCB := breakers.newBreaker("hello", breakerState)
+	goodbyeCB := breakers.newBreaker("goodbye", breakerState)
+	if helloCB != nil {
+		health.Register("breaker.hello", breakerChecker{helloCB})
+		health.Register("breaker.goodbye", breakerChecker{goodbyeCB})
+	}
+	helloBreaker := breakerEndpoint(helloCB)
+	goodbyeBreaker := breakerEndpoint(goodbyeCB)
+	endpointLatency := stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{
+		Namespace: "greet",
+		Name:      "endpoint_latency_seconds",
+		Help:      "Time each HTTP greeting endpoint spent answering calls, in seconds.",
+		Buckets:   latencyBuckets,
+	}, []string{"endpoint"})
+	stdprometheus.MustRegister(endpointLatency)
+	slow := slowConfig{
+		Threshold: *slowThreshold,
+		logger:    logger,
+		settings:  logs,
+		redact:    redactors,
+		slow: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "greet",
+			Name:      "slow_requests_total",
+			Help:      "HTTP greeting calls that took longer than -slow.threshold.",
+		}, []string{"endpoint"}),
+	}
+	chaos := chaosConfig{
+		Token:       *chaosToken,
+		Latency:     *chaosLatency,
+		LatencyRate: *chaosLatencyRate,
+		ErrorRate:   *chaosErrorRate,
+		DropRate:    *chaosDropRate,
+	}
+	chaosToContext := chaos.toContext()
+	collapse := singleflightConfig{
+		Enabled: *singleflightFlag,
+		shared: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "greet",
+			Name:      "singleflight_shared_total",
+			Help:      "HTTP greeting calls answered with an identical call's answer.",
+		}, []string{"endpoint"}),
+	}
+	spans := map[string]string{"hello": "Hello", "goodbye": "Goodbye", "card": "HelloCard", "batch": "HelloBatch"}
+	endpoints := endpointChain{
+		"trace": func(name string) endpoint.Middleware { return traceEndpoint(tracer, spans[name]) },
+		"latency": func(name string) endpoint.Middleware {
+			return latencyEndpoint(endpointLatency, name, *metricsExemplars)
+		},
+		"slow":      slow.endpoint,
+		"jwt":       func(string) endpoint.Middleware { return authenticate },
+		"apikey":    func(string) endpoint.Middleware { return authenticateKey },
+		"cert":      func(string) endpoint.Middleware { return authenticateCert },
+		"tenant":    func(string) endpoint.Middleware { return authenticateTenant(tenants) },
+		"authorize": func(string) endpoint.Middleware { return authorize(policy, "greet") },
+		"ratelimit": func(name string) endpoint.Middleware {
+			if name == "batch" {
+				return limitBatch
+			}
+			return limit
+		},
+		"validate":     func(string) endpoint.Middleware { return validateRequest },
+		"singleflight": collapse.endpoint,
+		"bulkhead":     func(name string) endpoint.Middleware { return bulkheads.endpoint(name, bulkheadInflight) },
+		"breaker": func(name string) endpoint.Middleware {
+			if name == "goodbye" {
+				return goodbyeBreaker
+			}
+			return helloBreaker
+		},
+		"timeout": timeouts.endpoint,
+		"chaos":   chaos.endpoint,
+		"canary":  canary.endpoint,
+	}
+	chains := map[string]endpoint.Middleware{}
+	for _, name := range timeoutEndpoints {
+		if chains[name], err = endpoints.build(splitList(*endpointChainFlag), name); err != nil {
+			return err
+		}
+	}
 
 	helloHandler := kithttp.NewServer(
-		ctx,
-		makeHelloEndpoint(svc),
-		decodeHelloRequest,
+		chains["hello"](makeHelloEndpoint(svc)),
+		decodeErrors(decodeHelloRequest),
 		encodeHelloResponse,
+		kithttp.ServerBefore(traceToContext, requestIDToContext, auditToContext, kitjwt.HTTPToContext(), headersToContext, callerToContext, tenantToContext, certToContext, apiKeyToContext, chaosToContext, canaryToContext),
+		kithttp.ServerErrorEncoder(encodeEndpointError),
 	)
 
 	http.Handle("/hello", helloHandler)
-	logger.Log("msg", "HTTP", "addr", ":8080")
-	logger.Log("err", http.ListenAndServe(":8080", nil))
+	http.Handle("/goodbye", kithttp.NewServer(
+		chains["goodbye"](makeGoodbyeEndpoint(svc)),
+		decodeErrors(decodeGoodbyeRequest),
+		encodeGoodbyeResponse,
+		kithttp.ServerBefore(traceToContext, requestIDToContext, auditToContext, kitjwt.HTTPToContext(), callerToContext, tenantToContext, certToContext, apiKeyToContext, chaosToContext, canaryToContext),
+		kithttp.ServerErrorEncoder(encodeEndpointError),
+	))
+
+	cardTemplate := defaultCardTemplate
+	if *cardBackground != "" {
+		var err error
+		if cardTemplate, err = loadCardBackground(*cardBackground); err != nil {
+			return err
+		}
+	}
 
+	router := mux.NewRouter()
+	router.Methods("GET").Path("/hello/card").Handler(kithttp.NewServer(
+		chains["card"](makeHelloEndpoint(svc)),
+		decodeErrors(decodeHelloRequest),
+		makeEncodeCardResponse(textCardRenderer{cardTemplate}),
+		kithttp.ServerBefore(traceToContext, requestIDToContext, auditToContext, kitjwt.HTTPToContext(), callerToContext, tenantToContext, certToContext, apiKeyToContext, chaosToContext, canaryToContext),
+		kithttp.ServerErrorEncoder(encodeEndpointError),
+	))
+	router.Methods("GET").Path("/hello/{name}").Handler(kithttp.NewServer(
+		chains["hello"](makeHelloEndpoint(svc)),
+		decodeErrors(decodeHelloPathRequest),
+		encodeHelloPathResponse,
+		kithttp.ServerBefore(traceToContext, requestIDToContext, auditToContext, kitjwt.HTTPToContext(), headersToContext, callerToContext, tenantToContext, certToContext, apiKeyToContext, chaosToContext, canaryToContext),
+		kithttp.ServerErrorEncoder(encodeEndpointError),
+	))
+	router.Methods("POST").Path("/hello/batch").Handler(kithttp.NewServer(
+		chains["batch"](makeHelloBatchEndpoint(svc, *batchConcurrency)),
+		decodeErrors(makeDecodeHelloBatchRequest(*batchMax)),
+		encodeHelloBatchResponse,
+		kithttp.ServerBefore(traceToContext, requestIDToContext, auditToContext, kitjwt.HTTPToContext(), callerToContext, tenantToContext, certToContext, apiKeyToContext, chaosToContext, canaryToContext),
+		kithttp.ServerErrorEncoder(encodeEndpointError),
+	))
+	importer := newGreetImporter(waitLimit(makeHelloEndpoint(svc)), *importWorkers, logger)
+	router.Methods("POST").Path("/hello/import").Handler(az.gate(authorized, kithttp.NewServer(
+		makeImportEndpoint(importer),
+		decodeErrors(decodeImportRequest),
+		makeEncodeImportResponse(http.StatusAccepted),
+		kithttp.ServerBefore(requestIDToContext, tenantToContext),
+	)))
+	router.Methods("GET").Path("/hello/import/{id}").Handler(az.gate(greeting, kithttp.NewServer(
+		makeGetImportEndpoint(importer),
+		decodeErrors(decodeGetImportRequest),
+		makeEncodeImportResponse(http.StatusOK),
+	)))
+	router.Methods("POST").Path("/hello/many").Handler(az.gate(authorized, manyServer{
+		e:      limit(makeHelloEndpoint(svc)),
+		logger: logger,
+	}))
+	http.Handle("/hello/", router)
+	http.Handle("/hello/ws", az.gate(authorized, wsServer{
+		e:      limit(makeHelloEndpoint(svc)),
+		dec:    decodeWSHelloRequest,
+		enc:    encodeWSResponse,
+		logger: logger,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+		},
+		readLimit: *httpBodyMax,
+	}))
+	http.Handle("/hello/stream", az.handler("history.read", sseHandler{broker, *sseHeartbeat, logger}))
+	http.Handle("/greetings", kithttp.NewServer(
+		az.endpoint("history.read", makeListGreetingsEndpoint(history)),
+		decodeErrors(decodeListGreetingsRequest),
+		encodeListGreetingsResponse,
+		az.options()...,
+	))
+	http.Handle("/greetings/export", az.handler("history.read", exportHandler{history, logger}))
+	scheduler := newGreetScheduler(schedules, waitLimit(makeHelloEndpoint(svc)), logger)
+	scheduleHandler := makeScheduleHandler(az, scheduler)
+	http.Handle("/greetings/schedule", scheduleHandler)
+	http.Handle("/greetings/schedule/", scheduleHandler)
+
+	// What's there to operate the service, rather than to call it, is on
+	// the admin listener if there is one, and the public ones if not; see
+	// admin.go.
+	adminOn := *adminAddr != "" || inherited.has("admin")
+	ops := http.DefaultServeMux
+	if adminOn {
+		ops = http.NewServeMux()
+		ops.Handle("/config", configHandler{redactedFlags(flag.CommandLine)})
+	}
+	ops.Handle("/metrics", promhttp.InstrumentMetricHandler(stdprometheus.DefaultRegisterer, promhttp.HandlerFor(stdprometheus.DefaultGatherer, promhttp.HandlerOpts{
+		EnableOpenMetrics: *metricsExemplars,
+	})))
+	ops.Handle("/version", versionHandler{build})
+	ops.Handle("/healthz", healthHandler{health, nil})
+	ops.Handle("/readyz", healthHandler{health, ready})
+	ops.HandleFunc("/livez", livez)
+	opsAZ := az
+	opsAZ.trusted = adminOn
+	ops.Handle("/admin/loglevel", makeLogLevelHandler(opsAZ, newLogLevelControl(logs, logger)))
+
+	http.Handle("/stats", kithttp.NewServer(
+		az.endpoint("stats.read", makeStatsEndpoint(stats)),
+		decodeErrors(decodeStatsRequest),
+		encodeStatsResponse,
+		az.options()...,
+	))
+	templatesHandler := makeTemplatesHandler(az, templates)
+	http.Handle("/admin/templates", templatesHandler)
+	http.Handle("/admin/templates/", templatesHandler)
+	tenantsHandler := makeTenantsHandler(az, tenants, tenantLimits)
+	http.Handle("/tenants", tenantsHandler)
+	http.Handle("/tenants/", tenantsHandler)
+	ipFilter, err := newIPFilter(splitList(*ipFilterPaths), splitList(*ipFilterProxy), ipRules{
+		Allow: splitList(*ipFilterAllow),
+		Deny:  splitList(*ipFilterDeny),
+	})
+	if err != nil {
+		return err
+	}
+	http.Handle("/admin/ipfilter", makeIPFilterHandler(az, ipFilter))
+	aliasesHandler := makeAliasesHandler(az, aliases, *nameMaxLen)
+	http.Handle("/aliases", aliasesHandler)
+	http.Handle("/aliases/", aliasesHandler)
+	profilesHandler := makeProfilesHandler(az, profiles, *nameMaxLen)
+	http.Handle("/profiles", profilesHandler)
+	http.Handle("/profiles/", profilesHandler)
+	http.Handle("/graphql", az.gate(authorized, makeGraphQLHandler(svc, limiter)))
+	http.Handle("/events", az.gate(greeting, makeCloudEventsHandler(svc, logger)))
+	http.Handle(twirpPrefix, az.gate(greeting, makeTwirpHandler(svc, logger)))
+	http.Handle("/rpc", az.gate(authorized, jsonrpcServer{
+		methods: map[string]jsonrpcMethod{
+			"hello": {limit(makeHelloEndpoint(svc)), decodeJSONRPCHelloParams, encodeJSONRPCHelloResult},
+		},
+		logger: logger,
+	}))
+
+	gateway, err := makeGatewayHandler(ctx, svc, logger)
+	if err != nil {
+		return err
+	}
+	http.Handle("/v1/", az.gate(greeting, gateway))
+
+	// Clients that know the server speaks HTTP/2 can skip the upgrade dance
+	// and send HTTP/2 straight away over cleartext; everyone else keeps using
+	// HTTP/1.1 on the same listener.
+	var handler http.Handler = recoveringHandler{
+		panics: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "greet",
+			Subsystem: "http",
+			Name:      "panics_total",
+			Help:      "Number of HTTP requests that panicked.",
+		}, nil),
+		logger: logger,
+		next:   hideDebugHandler{http.DefaultServeMux},
+	}
+	if *idempotencyTTL > 0 {
+		handler = idempotencyHandler{newIdempotencyCache(*idempotencyTTL), az.who, handler}
+	}
+	if *shadowURL != "" {
+		handler, err = newShadowHandler(*shadowURL, *shadowPercent, splitList(*shadowPaths), *shadowInflight, *shadowBody, *shadowTimeout, kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "greet",
+			Name:      "shadow_requests_total",
+			Help:      "Requests mirrored to -shadow.url, by outcome: sent, failed or skipped.",
+		}, []string{"outcome"}), logger, handler)
+		if err != nil {
+			return err
+		}
+	}
+	handler = ipFilterHandler{ipFilter, handler}
+	var audit multiAuditSink
+	if *auditFile != "" {
+		sink, err := openFileAuditSink(*auditFile)
+		if err != nil {
+			return err
+		}
+		audit = append(audit, sink)
+	}
+	if *auditSyslog != "" {
+		sink, err := dialSyslogAuditSink(*auditSyslog)
+		if err != nil {
+			return err
+		}
+		audit = append(audit, sink)
+	}
+	if len(audit) > 0 {
+		handler = auditHandler{audit, logger, handler}
+	}
+	if origins := splitList(*corsOrigins); len(origins) > 0 {
+		handler = corsHandler{corsConfig{
+			Origins: origins,
+			Methods: splitList(*corsMethods),
+			Headers: splitList(*corsHeaders),
+			MaxAge:  *corsMaxAge,
+			Paths:   splitList(*corsPaths),
+		}, handler}
+	}
+	handler = otelhttp.NewHandler(handler, "http", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return r.Method
+	}))
+	handler = bodyLimitHandler{*httpBodyMax, handler}
+	handler = requestIDHandler{handler}
+	handler = countingHandler{handler}
+	if *httpH2C {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+
+	// Each transport runs in the group, so the first one to fail (or an
+	// interrupt) shuts the whole process down; see shutdown.go. Setting up
+	// the next one can fail once the first have started, in which case
+	// they're shut down before run returns.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	g, gctx := errgroup.WithContext(ctx)
+	limits := httpLimits{
+		ReadHeaderTimeout: *httpHeaderTimeout,
+		ReadTimeout:       *httpReadTimeout,
+		WriteTimeout:      *httpWriteTimeout,
+		IdleTimeout:       *httpIdleTimeout,
+		MaxHeaderBytes:    *httpHeaderMax,
+	}
+	var (
+		servers    []*http.Server
+		stops      []func()
+		grpcServer = grpc.NewServer()
+		running    bool
+	)
+	defer func() {
+		if !running {
+			cancel()
+			drain(*shutdownTimeout, logger, servers, grpcServer, stops)
+			g.Wait()
+		}
+	}()
+
+	g.Go(func() error {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+		select {
+		case sig := <-c:
+			return errStopped{sig}
+		case <-gctx.Done():
+			return nil
+		}
+	})
+
+	upgrades := make(chan os.Signal, 1)
+	signal.Notify(upgrades, syscall.SIGUSR2)
+	g.Go(func() error {
+		defer signal.Stop(upgrades)
+		for {
+			select {
+			case <-upgrades:
+				logger.Log("msg", "upgrading")
+				p, err := inherited.upgrade(*upgradeTimeout)
+				if err != nil {
+					logger.Log("msg", "upgrade failed", "err", err)
+					continue
+				}
+				logger.Log("msg", "upgraded", "pid", p.Pid)
+				return errUpgraded
+			case <-gctx.Done():
+				return nil
+			}
+		}
+	})
+
+	serveUntilDone(g, gctx, func() error {
+		return scheduler.Run(gctx)
+	})
+
+	if pushed != nil {
+		g.Go(func() error {
+			pushed.run(gctx, *statsdInterval)
+			return nil
+		})
+		stops = append(stops, pushed.Close)
+	}
+
+	if live != nil && *configInterval > 0 {
+		g.Go(func() error {
+			live.watch(gctx, *configInterval)
+			return nil
+		})
+	}
+
+	pb.RegisterGreetServer(grpcServer, makeGRPCServer(svc, greeting, []grpctransport.ServerRequestFunc{keyToContext.fromGRPC}, logger))
+
+	if *httpAddr != "" || inherited.has("http") {
+		server := limits.newServer(handler)
+		servers = append(servers, server)
+		serveUntilDone(g, gctx, func() error {
+			ln, err := inherited.listen("http", *httpAddr)
+			if err != nil {
+				return err
+			}
+			if *httpCmux {
+				// gRPC clients wait for the server's SETTINGS frame before
+				// sending any headers, so the matcher has to send one first.
+				m := cmux.New(ln)
+				grpcLn := m.MatchWithWriters(cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"))
+				ln = m.Match(cmux.Any())
+				serveUntilDone(g, gctx, func() error { return grpcServer.Serve(grpcLn) })
+				serveUntilDone(g, gctx, m.Serve)
+				go func() {
+					<-gctx.Done()
+					m.Close()
+				}()
+				logger.Log("msg", "gRPC", "addr", ln.Addr())
+			}
+			logger.Log("msg", "HTTP", "addr", ln.Addr())
+			return server.Serve(ln)
+		})
+	}
+
+	if httpsOn {
+		server := limits.newServer(handler)
+		servers = append(servers, server)
+		var (
+			challenges *http.Server
+			certs      *certReloader
+		)
+		if *acmeDomains != "" {
+			challenges = limits.newServer(nil)
+			servers = append(servers, challenges)
+		} else {
+			if certs, err = newCertReloader(*tlsCert, *tlsKey, logger); err != nil {
+				return err
+			}
+			reloads.add(certs)
+			if *tlsReload > 0 {
+				g.Go(func() error {
+					certs.watch(gctx, *tlsReload)
+					return nil
+				})
+			}
+		}
+		serveUntilDone(g, gctx, func() error {
+			var getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+			if *acmeDomains != "" {
+				m := newACMEManager(splitList(*acmeDomains), *acmeCache, *acmeEmail, *acmeDirectory)
+				getCertificate = m.GetCertificate
+				challenges.Handler = m.HTTPHandler(nil)
+				serveUntilDone(g, gctx, func() error {
+					ln, err := inherited.listen("acme", *acmeHTTP)
+					if err != nil {
+						return err
+					}
+					logger.Log("msg", "ACME HTTP-01", "addr", ln.Addr(), "domains", *acmeDomains)
+					return challenges.Serve(ln)
+				})
+			} else {
+				getCertificate = certs.GetCertificate
+			}
+			config, err := newServerTLSConfig(getCertificate, tlsVersion, cipherSuites, *tlsClientCA, *tlsClientReq)
+			if err != nil {
+				return err
+			}
+			ln, err := inherited.listen("https", *httpsAddr)
+			if err != nil {
+				return err
+			}
+			logger.Log("msg", "HTTPS", "addr", ln.Addr())
+			server.TLSConfig = config
+			return server.ServeTLS(ln, "", "")
+		})
+	}
+
+	if *httpSocket != "" || inherited.has("socket") {
+		server := limits.newServer(handler)
+		servers = append(servers, server)
+		serveUntilDone(g, gctx, func() error {
+			mode, err := parseFileMode(*httpSocketMode)
+			if err != nil {
+				return err
+			}
+			ln, err := inherited.listenUnix("socket", *httpSocket, mode)
+			if err != nil {
+				return err
+			}
+			logger.Log("msg", "HTTP", "socket", *httpSocket)
+			return server.Serve(ln)
+		})
+	}
+
+	if adminOn {
+		server := httpLimits{
+			ReadHeaderTimeout: *httpHeaderTimeout,
+			IdleTimeout:       *httpIdleTimeout,
+			MaxHeaderBytes:    *httpHeaderMax,
+		}.newServer(newAdminMux(*adminToken, ops))
+		servers = append(servers, server)
+		serveUntilDone(g, gctx, func() error {
+			ln, err := inherited.listen("admin", *adminAddr)
+			if err != nil {
+				return err
+			}
+			logger.Log("msg", "admin", "addr", ln.Addr())
+			return server.Serve(ln)
+		})
+	}
+
+	serveUntilDone(g, gctx, func() error {
+		ln, err := inherited.listen("grpc", *grpcAddr)
+		if err != nil {
+			return err
+		}
+		logger.Log("msg", "gRPC", "addr", ln.Addr())
+		return grpcServer.Serve(ln)
+	})
+
+	serveUntilDone(g, gctx, func() error {
+		var protocolFactory thrift.TProtocolFactory
+		switch *thriftProtocol {
+		case "binary":
+			protocolFactory = thrift.NewTBinaryProtocolFactoryDefault()
+		case "compact":
+			protocolFactory = thrift.NewTCompactProtocolFactory()
+		case "json":
+			protocolFactory = thrift.NewTJSONProtocolFactory()
+		case "simplejson":
+			protocolFactory = thrift.NewTSimpleJSONProtocolFactory()
+		default:
+			return fmt.Errorf("invalid Thrift protocol %q", *thriftProtocol)
+		}
+
+		var transportFactory thrift.TTransportFactory
+		if *thriftBufferSize > 0 {
+			transportFactory = thrift.NewTBufferedTransportFactory(*thriftBufferSize)
+		} else {
+			transportFactory = thrift.NewTTransportFactory()
+		}
+		if *thriftFramed {
+			transportFactory = thrift.NewTFramedTransportFactory(transportFactory)
+		}
+
+		ln, err := inherited.listen("thrift", *thriftAddr)
+		if err != nil {
+			return err
+		}
+
+		logger.Log("msg", "Thrift", "addr", ln.Addr())
+		server := thrift.NewTSimpleServer4(
+			thriftgreet.NewGreetServiceProcessor(makeThriftHandler(svc, greeting)),
+			listenerTransport{ln},
+			transportFactory,
+			protocolFactory,
+		)
+		go func() {
+			<-gctx.Done()
+			server.Stop()
+		}()
+		return server.Serve()
+	})
+
+	if *natsURL != "" {
+		nc, err := nats.Connect(*natsURL)
+		if err != nil {
+			return err
+		}
+		defer nc.Close()
+		health.Register("nats", CheckerFunc(func(context.Context) error {
+			if !nc.IsConnected() {
+				return fmt.Errorf("not connected to %s", *natsURL)
+			}
+			return nil
+		}))
+
+		hello := natsSubscriber{
+			ctx:    ctx,
+			e:      limit(makeHelloEndpoint(svc)),
+			dec:    decodeNATSHelloRequest,
+			enc:    encodeNATSResponse,
+			errEnc: encodeNATSError,
+			logger: logger,
+		}
+
+		// Subscribing through a queue group means each request is answered by
+		// just one instance of the service.
+		if _, err := nc.QueueSubscribe(*natsSubject, *natsQueue, hello.ServeMsg(nc)); err != nil {
+			return err
+		}
+		logger.Log("msg", "NATS", "url", *natsURL, "subject", *natsSubject)
+	}
+
+	if *amqpURL != "" {
+		conn, err := amqp.Dial(*amqpURL)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		health.Register("amqp", CheckerFunc(func(context.Context) error {
+			if conn.IsClosed() {
+				return errors.New("connection closed")
+			}
+			return nil
+		}))
+
+		ch, err := conn.Channel()
+		if err != nil {
+			return err
+		}
+		if err := ch.Qos(*amqpPrefetch, 0, false); err != nil {
+			return err
+		}
+		if _, err := ch.QueueDeclare(*amqpQueue, true, false, false, false, nil); err != nil {
+			return err
+		}
+		deliveries, err := ch.Consume(*amqpQueue, "", false, false, false, false, nil)
+		if err != nil {
+			return err
+		}
+
+		hello := amqpSubscriber{
+			ctx:      ctx,
+			e:        limit(makeHelloEndpoint(svc)),
+			dec:      decodeAMQPHelloRequest,
+			enc:      encodeAMQPResponse,
+			exchange: *amqpExchange,
+			logger:   logger,
+		}
+
+		stops = append(stops, func() { ch.Close() })
+		serveUntilDone(g, gctx, func() error {
+			logger.Log("msg", "AMQP", "queue", *amqpQueue)
+			serve := hello.ServeDelivery(ch)
+			for d := range deliveries {
+				serve(&d)
+			}
+			return errors.New("AMQP delivery channel closed")
+		})
+	}
+
+	if *kafkaBrokers != "" {
+		brokers := strings.Split(*kafkaBrokers, ",")
+
+		r := kafka.NewReader(kafka.ReaderConfig{
+			Brokers: brokers,
+			GroupID: *kafkaGroup,
+			Topic:   *kafkaInTopic,
+		})
+		w := kafka.NewWriter(kafka.WriterConfig{
+			Brokers: brokers,
+			Topic:   *kafkaOutTopic,
+		})
+
+		hello := kafkaSubscriber{
+			ctx:    ctx,
+			e:      limit(makeHelloEndpoint(svc)),
+			dec:    decodeKafkaHelloRequest,
+			enc:    encodeKafkaResponse,
+			logger: logger,
+		}
+
+		// The reader is closed once the servers have drained, which ends
+		// Serve, and the writer after it, since Serve writes with it.
+		stops = append(stops, func() {
+			r.Close()
+			w.Close()
+		})
+		serveUntilDone(g, gctx, func() error {
+			logger.Log("msg", "Kafka", "brokers", *kafkaBrokers, "topic", *kafkaInTopic)
+			return hello.Serve(r, w)
+		})
+	}
+
+	if *mqttBroker != "" {
+		hello := mqttSubscriber{
+			ctx:    ctx,
+			e:      limit(makeHelloEndpoint(svc)),
+			dec:    decodeMQTTHelloRequest,
+			enc:    encodeMQTTResponse,
+			errEnc: encodeMQTTError,
+			prefix: *mqttPrefix,
+			qos:    byte(*mqttQoS),
+			logger: logger,
+		}
+
+		opts := mqtt.NewClientOptions().
+			AddBroker(*mqttBroker).
+			SetClientID(*mqttClientID).
+			SetAutoReconnect(true).
+			SetMaxReconnectInterval(time.Minute).
+			SetOnConnectHandler(hello.OnConnect).
+			SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+				logger.Log("msg", "MQTT connection lost", "err", err)
+			})
+
+		c := mqtt.NewClient(opts)
+		if token := c.Connect(); token.Wait() && token.Error() != nil {
+			return token.Error()
+		}
+		defer c.Disconnect(250)
+		health.Register("mqtt", CheckerFunc(func(context.Context) error {
+			if !c.IsConnectionOpen() {
+				return fmt.Errorf("not connected to %s", *mqttBroker)
+			}
+			return nil
+		}))
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	g.Go(func() error {
+		defer signal.Stop(hup)
+		reloads.watch(gctx, hup)
+		return nil
+	})
+
+	var registrar sd.Registrar
+	if *consulAddr != "" || *etcdEndpoints != "" {
+		instance, err := newServiceInstance(*registerName, *registerAddr, splitList(*registerTags), *registerCheck, *httpAddr, *adminAddr)
+		if err != nil {
+			return err
+		}
+		if *consulAddr != "" {
+			registrar, err = newConsulRegistrar(*consulAddr, instance, *consulInterval, logger)
+		} else {
+			registrar, err = newEtcdRegistrar(ctx, splitList(*etcdEndpoints), *etcdPrefix, instance, *etcdTTL, logger)
+		}
+		if err != nil {
+			return err
+		}
+		registrar.Register()
+	}
+
+	running = true
+	g.Go(func() error {
+		<-gctx.Done()
+		if registrar != nil && !inherited.handedOff() {
+			registrar.Deregister()
+		}
+		ready.Drain()
+		if *shutdownDelay > 0 {
+			logger.Log("msg", "not ready", "delay", *shutdownDelay)
+			time.Sleep(*shutdownDelay)
+		}
+		return drain(*shutdownTimeout, logger, servers, grpcServer, stops)
+	})
+	ready.Ready()
+	if err := inherited.ready(); err != nil {
+		logger.Log("msg", "upgrade", "err", err)
+	}
+	err = g.Wait()
+	if _, ok := err.(errStopped); ok || err == errUpgraded {
+		logger.Log("msg", "stopped", "reason", err)
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,37 @@
+//go:build lambda
+// +build lambda
+
+package main
+
+// This is an alternative entrypoint that runs the hello endpoint as an AWS
+// Lambda function behind an API Gateway proxy integration, instead of as a
+// long running server. Build it with the lambda tag:
+// GOOS=linux go build -tags lambda -o main && zip function.zip main
+//
+// Then point a proxy resource, such as POST /hello or GET /hello/{name}, at
+// the function.
+
+import (
+	"os"
+
+	"github.com/aws/aws-lambda-go/lambda"
+
+	log "github.com/go-kit/kit/log"
+)
+
+func main() {
+	logger := log.NewLogfmtLogger(os.Stderr)
+
+	var svc GreetService
+	svc = greetService{clock: systemClock{}}
+	svc = loggingMiddleware{logger: logger, next: svc, settings: newLogSettings(levelInfo, 1)}
+	svc = filteringMiddleware{newWordFilter(defaultDenylist, false), svc}
+	svc = validatingMiddleware{defaultNameMaxLen, svc}
+
+	lambda.Start(lambdaServer{
+		e:      makeHelloEndpoint(svc),
+		dec:    decodeLambdaHelloRequest,
+		enc:    encodeLambdaHelloResponse,
+		logger: logger,
+	}.Handle)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+
+	log "github.com/go-kit/kit/log"
+)
+
+// Calls to the service are logged with a level: errors at error, and
+// successes at info, or at debug with the greeting too. Only calls at
+// -log.level or above are logged, and with -log.sample below 1, only that
+// fraction of the successes logged at info; errors are always logged. Names
+// can be kept out of the log: -log.redact is the fields, input or output,
+// whose values are replaced with "[redacted]", and -log.redact.pattern a
+// regular expression whose matches in either of them are.
+
+// logLevel is how much a log line matters.
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+func (l logLevel) String() string { return logLevelNames[l] }
+
+// parseLogLevel parses debug, info, warn or error.
+func parseLogLevel(s string) (logLevel, error) {
+	for i, name := range logLevelNames {
+		if s == name {
+			return logLevel(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, want one of %s", s, strings.Join(logLevelNames, ", "))
+}
+
+// logSettings is the least level calls are logged at, and the fraction of
+// the successes logged at info that are. They can change while the service
+// runs, see configfile.go.
+type logSettings struct {
+	v atomic.Value
+}
+
+type logSampling struct {
+	level  logLevel
+	sample float64
+}
+
+func newLogSettings(level logLevel, sample float64) *logSettings {
+	s := &logSettings{}
+	s.Store(level, sample)
+	return s
+}
+
+// Load returns the level and sample.
+func (s *logSettings) Load() (logLevel, float64) {
+	l := s.v.Load().(logSampling)
+	return l.level, l.sample
+}
+
+// Store changes the level and sample.
+func (s *logSettings) Store(level logLevel, sample float64) {
+	s.v.Store(logSampling{level, sample})
+}
+
+// redactor changes the value of a field before it's logged, to keep
+// something sensitive out of the log.
+type redactor func(field, value string) string
+
+// redactFields returns a redactor that hides the whole of the fields given.
+func redactFields(fields []string) redactor {
+	return func(field, value string) string {
+		for _, f := range fields {
+			if f == field {
+				return "[redacted]"
+			}
+		}
+		return value
+	}
+}
+
+// redactPattern returns a redactor that hides whatever matches re.
+func redactPattern(re *regexp.Regexp) redactor {
+	return func(_, value string) string {
+		return re.ReplaceAllString(value, "[redacted]")
+	}
+}
+
+// Here we create a middleware type that will implment the GreetService interface
+type loggingMiddleware struct {
+	logger log.Logger
+	next   GreetService
+
+	settings *logSettings
+	redact   []redactor
+}
+
+// This instance of the Hello func makes the loggingMiddleware implment the
+// GreetService interface, which makes it compatible with the greetService type,
+// and allows us to chain different types of middlewares together to extend the
+// service.
+func (mw loggingMiddleware) Hello(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.log(ctx, "Hello", s, opts, mw.next.Hello)
+}
+
+func (mw loggingMiddleware) Goodbye(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.log(ctx, "Goodbye", s, opts, mw.next.Goodbye)
+}
+
+// log calls method with the input, and logs how that went. Every method of
+// GreetService has the same signature, so they can all share it.
+func (mw loggingMiddleware) log(ctx context.Context, method, s string, opts GreetOptions, call greetMethod) (output Greeting, err error) {
+	defer func(begin time.Time) {
+		least, sample := mw.settings.Load()
+		level := levelInfo
+		if err != nil {
+			level = levelError
+		} else if least == levelDebug {
+			level = levelDebug
+		}
+		if level < least || level == levelInfo && sample < 1 && rand.Float64() >= sample {
+			return
+		}
+		keyvals := []interface{}{
+			"level", level,
+			"method", method,
+			"input", mw.redacted("input", s),
+			"lang", opts.Language,
+			"err", err,
+			"took", time.Since(begin),
+		}
+		if level == levelDebug {
+			keyvals = append(keyvals, "output", mw.redacted("output", output.Text))
+		}
+		requestLogger(ctx, mw.logger).Log(keyvals...)
+	}(time.Now())
+
+	output, err = call(ctx, s, opts)
+	return
+}
+
+func (mw loggingMiddleware) redacted(field, value string) string {
+	for _, r := range mw.redact {
+		value = r(field, value)
+	}
+	return value
+}
+
+// greetMethod is the signature every method of GreetService shares.
+type greetMethod func(context.Context, string, GreetOptions) (Greeting, error)
+
+// eventMiddleware publishes every call to Hello on a broker, which is what
+// feeds the /hello/stream endpoint.
+type eventMiddleware struct {
+	broker *greetingBroker
+	next   GreetService
+}
+
+func (mw eventMiddleware) Hello(ctx context.Context, s string, opts GreetOptions) (output Greeting, err error) {
+	output, err = mw.next.Hello(ctx, s, opts)
+	mw.broker.Publish(greetingEvent{
+		Name:     s,
+		Greeting: output.Text,
+		Err:      err2str(err),
+		Time:     time.Now(),
+	})
+	return
+}
+
+// Goodbye isn't a greeting, so it doesn't show up on the stream.
+func (mw eventMiddleware) Goodbye(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.next.Goodbye(ctx, s, opts)
+}
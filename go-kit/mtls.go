@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// With -https.addr set, the service serves HTTPS there too, with the
+// certificate and key in -tls.cert and -tls.key, see tls.go. With
+// -tls.client.ca set as well, clients are asked for a certificate, which has
+// to be signed by one of the CAs in that file, and with -tls.client.required,
+// as it is by default, connections without one are refused.
+//
+// A client certificate says who's calling. Its identity is the first of its
+// URI SANs (a SPIFFE ID, say), DNS SANs, email addresses and common name that
+// -tls.client.identities, a JSON file, knows about:
+//
+//	[{"identity": "spiffe://corp/ci", "tenant": "acme", "roles": ["greet"]}]
+//
+// or, if none of them are in the file, its first one. The identity is
+// recorded in the greeting history as the caller's subject, and its requests
+// belong to its tenant, if it has one. Its roles are in the context, under
+// certIdentityKey.
+
+// certIdentity is what a client certificate is known as.
+type certIdentity struct {
+	Identity string   `json:"identity"`
+	Tenant   string   `json:"tenant,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+type certContextKey int
+
+const (
+	// certIdentityKey is the context key for the certIdentity a request
+	// was made with.
+	certIdentityKey certContextKey = iota
+
+	// certErrKey is the context key for why a request's certificate
+	// couldn't be used.
+	certErrKey
+)
+
+// newServerTLSConfig returns the HTTPS listener's TLS config, serving the
+// certificates getCertificate gets, and asking for client certificates
+// signed by the CAs in clientCA, if it's set.
+func newServerTLSConfig(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error), minVersion uint16, ciphers []uint16, clientCA string, clientRequired bool) (*tls.Config, error) {
+	config := &tls.Config{
+		GetCertificate: getCertificate,
+		MinVersion:     minVersion,
+		CipherSuites:   ciphers,
+	}
+	if clientCA == "" {
+		return config, nil
+	}
+	pem, err := ioutil.ReadFile(clientCA)
+	if err != nil {
+		return nil, err
+	}
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, errors.New(clientCA + " has no PEM certificates in it")
+	}
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if clientRequired {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// readCertIdentities reads -tls.client.identities, by identity.
+func readCertIdentities(path string) (map[string]certIdentity, error) {
+	identities := map[string]certIdentity{}
+	if path == "" {
+		return identities, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []certIdentity
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+	for _, id := range list {
+		if id.Identity == "" {
+			return nil, errors.New(path + ": an entry has no identity")
+		}
+		identities[id.Identity] = id
+	}
+	return identities, nil
+}
+
+// identify returns the identity of a verified client certificate.
+func identify(cert *x509.Certificate, identities map[string]certIdentity) certIdentity {
+	var names []string
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	for _, name := range names {
+		if id, ok := identities[name]; ok {
+			return id
+		}
+	}
+	if len(names) == 0 {
+		return certIdentity{Identity: cert.Subject.String()}
+	}
+	return certIdentity{Identity: names[0]}
+}
+
+// makeCertToContext returns a kithttp.RequestFunc that puts the identity of
+// the request's verified client certificate, if it has one, and its tenant in
+// the context, or why it can't be used for authenticateCert. Like
+// makeAPIKeyToContext, it has to come after callerToContext.
+func makeCertToContext(identities map[string]certIdentity, tenants TenantStore) kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			return ctx
+		}
+		id := identify(r.TLS.VerifiedChains[0][0], identities)
+		if id.Tenant != "" {
+			t, err := tenants.Get(id.Tenant)
+			if err == errTenantNotFound {
+				err = errUnauthorized{err: errors.New("client certificate's tenant doesn't exist")}
+			}
+			if err != nil {
+				return context.WithValue(ctx, certErrKey, err)
+			}
+			ctx = context.WithValue(ctx, tenantKey, t)
+		}
+		return context.WithValue(withCallerSubject(ctx, id.Identity), certIdentityKey, id)
+	}
+}
+
+// authenticateCert is an endpoint.Middleware that fails calls whose client
+// certificate makeCertToContext couldn't use.
+func authenticateCert(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if err, ok := ctx.Value(certErrKey).(error); ok {
+			return nil, err
+		}
+		return next(ctx, request)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	stdjwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Instead of JWTs, the HTTP greeting endpoints can take the opaque access
+// tokens an OAuth2 or OIDC identity provider issues, and ask the provider
+// about each one at its token introspection endpoint (RFC 7662). That's
+// -oidc.introspect, or, with -oidc.issuer set, whatever the issuer's discovery
+// document says it is. The service introspects as the client -oidc.client.id,
+// with -oidc.client.secret. Tokens have to be active, and with -oidc.audience
+// set, for that audience; requests without one are answered 401.
+//
+// What the provider says about a token is kept for -oidc.cache, or until the
+// token expires if that's sooner, so most requests don't wait on it. The
+// answer is in the context the service gets as the token's claims, the same
+// as a JWT's, and its sub is recorded in the greeting history. That a token
+// isn't active is kept as well, so the same bad token isn't asked about
+// again, and tokens that aren't known are asked about no more than
+// -oidc.introspect.rps times a second, so a stream of made up ones can't
+// have the provider asked about every one; past that, requests are answered
+// 429. At most introspectionCacheMax answers are kept.
+
+// introspectionSweep is how often expired answers are dropped from the cache.
+const introspectionSweep = time.Minute
+
+// introspectionCacheMax is the most answers the cache keeps. Past it, one is
+// dropped for each that's added.
+const introspectionCacheMax = 10000
+
+// introspector asks an introspection endpoint about tokens, and remembers what
+// it said.
+type introspector struct {
+	url          string
+	clientID     string
+	clientSecret string
+	ttl          time.Duration
+	client       *http.Client
+	limiter      *rate.Limiter
+
+	mu        sync.Mutex
+	cache     map[[sha256.Size]byte]introspection
+	lastSweep time.Time
+}
+
+// introspection is what was said about a token. An inactive token has no
+// claims.
+type introspection struct {
+	claims  stdjwt.MapClaims
+	expires time.Time
+}
+
+// newIntrospectionAuthenticator returns an endpoint.Middleware that
+// authenticates calls with tokens introspected at introspectURL, or, if that's
+// empty, at the endpoint issuer's discovery document gives, asking about no
+// more than rps tokens a second.
+func newIntrospectionAuthenticator(issuer, introspectURL, clientID, clientSecret, audience string, ttl time.Duration, rps float64) (endpoint.Middleware, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if introspectURL == "" {
+		var err error
+		if introspectURL, err = discoverIntrospection(client, issuer); err != nil {
+			return nil, err
+		}
+	}
+	in := &introspector{
+		url:          introspectURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		ttl:          ttl,
+		client:       client,
+		limiter:      newRateLimiter(rps, 0),
+		cache:        map[[sha256.Size]byte]introspection{},
+		lastSweep:    time.Now(),
+	}
+	return authenticateIntrospection(in, audience), nil
+}
+
+// discoverIntrospection returns the introspection endpoint in issuer's OIDC
+// discovery document.
+func discoverIntrospection(client *http.Client, issuer string) (string, error) {
+	resp, err := client.Get(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("OIDC discovery answered %s", resp.Status)
+	}
+	var doc struct {
+		IntrospectionEndpoint string `json:"introspection_endpoint"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return "", err
+	}
+	if doc.IntrospectionEndpoint == "" {
+		return "", fmt.Errorf("%s has no introspection endpoint", issuer)
+	}
+	return doc.IntrospectionEndpoint, nil
+}
+
+// authenticateIntrospection returns an endpoint.Middleware that only lets
+// calls with an active token through, with what in says about it in their
+// context. Calls without one fail with errUnauthorized.
+func authenticateIntrospection(in *introspector, audience string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			token, ok := ctx.Value(kitjwt.JWTTokenContextKey).(string)
+			if !ok {
+				return nil, errUnauthorized{"Bearer", errNoToken}
+			}
+			claims, err := in.introspect(ctx, token)
+			if err != nil {
+				return nil, err
+			}
+			if claims == nil {
+				return nil, errUnauthorized{"Bearer", errors.New("token is not active")}
+			}
+			if err := checkClaims(claims, "", audience); err != nil {
+				return nil, errUnauthorized{"Bearer", err}
+			}
+			ctx = context.WithValue(ctx, kitjwt.JWTClaimsContextKey, claims)
+			if sub, ok := claims["sub"].(string); ok {
+				ctx = withCallerSubject(ctx, sub)
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// introspect returns the token's claims, or nil if it isn't active. Tokens
+// are only kept hashed.
+func (in *introspector) introspect(ctx context.Context, token string) (stdjwt.MapClaims, error) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+	in.mu.Lock()
+	if now.Sub(in.lastSweep) > introspectionSweep {
+		for k, i := range in.cache {
+			if now.After(i.expires) {
+				delete(in.cache, k)
+			}
+		}
+		in.lastSweep = now
+	}
+	i, ok := in.cache[key]
+	in.mu.Unlock()
+	if ok && now.Before(i.expires) {
+		return i.claims, nil
+	}
+	if r := in.limiter.Reserve(); r.Delay() > 0 {
+		d := r.Delay()
+		r.Cancel()
+		return nil, errRateLimited{d}
+	}
+
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequest("POST", in.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", mediaTypeJSON)
+	req.SetBasicAuth(url.QueryEscape(in.clientID), url.QueryEscape(in.clientSecret))
+	resp, err := in.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token introspection answered %s", resp.Status)
+	}
+	var claims stdjwt.MapClaims
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, err
+	}
+
+	i = introspection{expires: now.Add(in.ttl)}
+	if active, _ := claims["active"].(bool); active {
+		i.claims = claims
+		if exp, ok := claims["exp"].(float64); ok {
+			if t := time.Unix(int64(exp), 0); t.Before(i.expires) {
+				i.expires = t
+			}
+		}
+	}
+	in.mu.Lock()
+	if _, ok := in.cache[key]; !ok && len(in.cache) >= introspectionCacheMax {
+		for k := range in.cache {
+			delete(in.cache, k)
+			break
+		}
+	}
+	in.cache[key] = i
+	in.mu.Unlock()
+	return i.claims, nil
+}
@@ -0,0 +1,20 @@
+#!/usr/bin/env sh
+
+# Install proto3 from source
+#  brew install autoconf automake libtool
+#  git clone https://github.com/google/protobuf
+#  ./autogen.sh ; ./configure ; make ; make install
+#
+# Update protoc Go bindings via
+#  go get -u github.com/golang/protobuf/{proto,protoc-gen-go}
+#
+# and the HTTP gateway generator via
+#  go get -u github.com/grpc-ecosystem/grpc-gateway/protoc-gen-grpc-gateway
+#
+# See also
+#  https://github.com/grpc/grpc-go/tree/master/examples
+
+GOOGLEAPIS=$GOPATH/src/github.com/grpc-ecosystem/grpc-gateway/third_party/googleapis
+
+protoc -I. -I$GOOGLEAPIS greet.proto --go_out=plugins=grpc:.
+protoc -I. -I$GOOGLEAPIS greet.proto --grpc-gateway_out=logtostderr=true:.
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Errors are answered over HTTP as RFC 7807 problem details, as
+// application/problem+json whatever the request asked for, with the status
+// the error calls for and a machine-readable code that says what went wrong
+// more precisely than the status does:
+//
+//	HTTP/1.1 400 Bad Request
+//	Content-Type: application/problem+json
+//
+//	{"title": "Bad Request", "status": 400, "detail": "name is 120 characters long, the limit is 100",
+//	 "code": "too_long", "field": "name", "request_id": "0d6fb2e8..."}
+//
+// A request that breaks the rules is a 400, with the reason as its code and
+// the field it's about, and one for something that isn't there a 404.
+// Whatever the service doesn't recognize is a 500, coded after its status,
+// internal_server_error. Its detail, and that of any other 5xx without a code
+// of its own, is internalDetail rather than the error's, which could tell the
+// client more about the service's insides than it should know; the error
+// itself is logged, with the request ID, by recoveringHandler.
+
+const mediaTypeProblem = "application/problem+json"
+
+// internalDetail is the detail of a problem whose error isn't the client's
+// to see.
+const internalDetail = "the server couldn't answer the request, the request ID finds why in its log"
+
+// errorLogger is a ResponseWriter that logs the errors that are answered
+// with internalDetail.
+type errorLogger interface {
+	logError(err error)
+}
+
+// problem is an RFC 7807 problem details object, with its code, the field of
+// a validationError and the request ID as extension members. Its type is
+// always about:blank, so it's left out.
+type problem struct {
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Code      string `json:"code"`
+	Field     string `json:"field,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// classifyError returns the status err is answered with, and its code.
+func classifyError(err error) (int, string) {
+	switch e := err.(type) {
+	case validationError:
+		return http.StatusBadRequest, e.Reason
+	case errUnauthorized:
+		return http.StatusUnauthorized, "unauthorized"
+	case errNotPermitted:
+		return http.StatusForbidden, "not_permitted"
+	case errRateLimited:
+		return http.StatusTooManyRequests, "rate_limited"
+	case errTimeout:
+		return http.StatusGatewayTimeout, "timeout"
+	}
+	switch err {
+	case errNoName:
+		return http.StatusBadRequest, "name_required"
+	case errForbidden:
+		return http.StatusForbidden, "forbidden"
+	case errTenantMismatch:
+		return http.StatusForbidden, "tenant_mismatch"
+	case errAliasNotFound:
+		return http.StatusNotFound, "alias_not_found"
+	case errImportNotFound:
+		return http.StatusNotFound, "import_not_found"
+	case errProfileNotFound:
+		return http.StatusNotFound, "profile_not_found"
+	case errScheduleNotFound:
+		return http.StatusNotFound, "schedule_not_found"
+	case errTemplateNotFound:
+		return http.StatusNotFound, "template_not_found"
+	case errTemplateVersionNotFound:
+		return http.StatusNotFound, "template_version_not_found"
+	case errTenantNotFound:
+		return http.StatusNotFound, "tenant_not_found"
+	case errProfileExists:
+		return http.StatusConflict, "profile_exists"
+	case errTemplateExists:
+		return http.StatusConflict, "template_exists"
+	case errTenantExists:
+		return http.StatusConflict, "tenant_exists"
+	case errScheduleNotPending:
+		return http.StatusConflict, "schedule_not_pending"
+	case errIdempotencyKeyReused:
+		return http.StatusUnprocessableEntity, "idempotency_key_reused"
+	case errTenantRateLimited:
+		return http.StatusTooManyRequests, "tenant_rate_limited"
+	case errBreakerOpen:
+		return http.StatusServiceUnavailable, "breaker_open"
+	case errBulkheadFull:
+		return http.StatusServiceUnavailable, "bulkhead_full"
+	}
+	if tooLarge(err) {
+		return http.StatusRequestEntityTooLarge, "body_too_large"
+	}
+	return http.StatusInternalServerError, statusCode(http.StatusInternalServerError)
+}
+
+// statusCode is the code of an error that has none of its own, after the
+// status it's answered with: bad_request for a 400, say.
+func statusCode(status int) string {
+	return strings.ToLower(strings.Replace(http.StatusText(status), " ", "_", -1))
+}
+
+// writeProblem answers with err as a problem, with the status and code
+// classifyError gives it.
+func writeProblem(w http.ResponseWriter, err error) error {
+	status, code := classifyError(err)
+	return writeProblemStatus(w, status, code, err)
+}
+
+// writeError answers with err as a problem with status, and the code
+// classifyError gives it, if it gives it one for status.
+func writeError(w http.ResponseWriter, status int, err error) error {
+	code := statusCode(status)
+	if s, c := classifyError(err); s == status {
+		code = c
+	}
+	return writeProblemStatus(w, status, code, err)
+}
+
+func writeProblemStatus(w http.ResponseWriter, status int, code string, err error) error {
+	p := newProblem(status, code, err)
+	p.RequestID = w.Header().Get(requestIDHeader)
+	if l, ok := w.(errorLogger); ok && p.Detail == internalDetail {
+		l.logError(err)
+	}
+	w.Header().Set("Content-Type", mediaTypeProblem)
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(p)
+}
+
+// newProblem returns err as a problem with status and code.
+func newProblem(status int, code string, err error) problem {
+	p := problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: err.Error(),
+		Code:   code,
+	}
+	if status >= http.StatusInternalServerError && code == statusCode(status) {
+		p.Detail = internalDetail
+	}
+	if e, ok := err.(validationError); ok {
+		p.Field = e.Field
+	}
+	return p
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/go-kit/kit/log"
+)
+
+func TestProblemDetail(t *testing.T) {
+	secret := errors.New("dial tcp 10.0.0.7:5432: connection refused")
+	for name, tc := range map[string]struct {
+		status int
+		err    error
+		detail string
+		logged bool
+	}{
+		"client's error":   {http.StatusBadRequest, errNoName, errNoName.Error(), false},
+		"known 5xx":        {http.StatusServiceUnavailable, errBreakerOpen, errBreakerOpen.Error(), false},
+		"unknown":          {http.StatusInternalServerError, secret, internalDetail, true},
+		"unknown, but 502": {http.StatusBadGateway, secret, internalDetail, true},
+	} {
+		var logged []interface{}
+		w := &panicWriter{ResponseWriter: httptest.NewRecorder(), logger: log.LoggerFunc(func(keyvals ...interface{}) error {
+			logged = keyvals
+			return nil
+		})}
+		writeError(w, tc.status, tc.err)
+
+		var p problem
+		if err := json.Unmarshal(w.ResponseWriter.(*httptest.ResponseRecorder).Body.Bytes(), &p); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if p.Detail != tc.detail {
+			t.Errorf("%s: detail %q, want %q", name, p.Detail, tc.detail)
+		}
+		if got := logged != nil; got != tc.logged {
+			t.Errorf("%s: logged %v, want %v", name, logged, tc.logged)
+		}
+	}
+}
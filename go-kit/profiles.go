@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/net/context"
+	"golang.org/x/text/language"
+)
+
+// Users can keep a profile with the name they'd like to be greeted by, and in
+// what language. A Hello or Goodbye that carries a user ID greets the user the
+// way their profile says, whatever name and language came with the request.
+// The profiles themselves are managed under /profiles.
+
+// profile is one user's greeting preferences. Pronouns are kept for the
+// greetings that need them; a plain hello doesn't.
+type profile struct {
+	UserID        string `json:"user_id"`
+	PreferredName string `json:"preferred_name,omitempty"`
+	Pronouns      string `json:"pronouns,omitempty"`
+	Locale        string `json:"locale,omitempty"`
+}
+
+var (
+	errProfileNotFound = errors.New("profile not found")
+	errProfileExists   = errors.New("profile already exists")
+)
+
+// ProfileStore keeps profiles by user ID.
+type ProfileStore interface {
+	// Create stores a new profile, or fails with errProfileExists.
+	Create(p profile) error
+
+	// Get returns the profile for id, or errProfileNotFound.
+	Get(id string) (profile, error)
+
+	// Put stores p, replacing any profile it had before.
+	Put(p profile) error
+
+	// Delete removes the profile for id, or fails with errProfileNotFound.
+	Delete(id string) error
+}
+
+// memProfileStore is a ProfileStore that keeps everything in memory.
+type memProfileStore struct {
+	mu       sync.RWMutex
+	profiles map[string]profile
+}
+
+func newMemProfileStore() *memProfileStore {
+	return &memProfileStore{profiles: map[string]profile{}}
+}
+
+func (s *memProfileStore) Create(p profile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.profiles[p.UserID]; ok {
+		return errProfileExists
+	}
+	s.profiles[p.UserID] = p
+	return nil
+}
+
+func (s *memProfileStore) Get(id string) (profile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.profiles[id]
+	if !ok {
+		return profile{}, errProfileNotFound
+	}
+	return p, nil
+}
+
+func (s *memProfileStore) Put(p profile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profiles[p.UserID] = p
+	return nil
+}
+
+func (s *memProfileStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.profiles[id]; !ok {
+		return errProfileNotFound
+	}
+	delete(s.profiles, id)
+	return nil
+}
+
+// checkProfile returns p with its preferred name canonicalized, or a
+// validationError if it's not a profile we can greet anyone with.
+func checkProfile(p profile, maxLen int) (profile, error) {
+	if p.UserID == "" {
+		return p, validationError{"user_id", "required", "user_id is required"}
+	}
+	name, err := canonicalName(p.PreferredName, maxLen)
+	if err != nil {
+		return p, withField(err, "preferred_name")
+	}
+	p.PreferredName = name
+	if p.Locale != "" {
+		if _, err := language.Parse(p.Locale); err != nil {
+			return p, validationError{"locale", "invalid_locale", fmt.Sprintf("%q is not a language tag", p.Locale)}
+		}
+	}
+	return p, nil
+}
+
+// profileMiddleware swaps the name and language of a request for the ones in
+// the caller's profile, when there's a user ID to look it up by. Users without
+// a profile are greeted as they asked to be.
+type profileMiddleware struct {
+	profiles ProfileStore
+	next     GreetService
+}
+
+func (mw profileMiddleware) Hello(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.personalize(ctx, s, opts, mw.next.Hello)
+}
+
+func (mw profileMiddleware) Goodbye(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.personalize(ctx, s, opts, mw.next.Goodbye)
+}
+
+func (mw profileMiddleware) personalize(ctx context.Context, s string, opts GreetOptions, call greetMethod) (Greeting, error) {
+	if opts.UserID == "" {
+		return call(ctx, s, opts)
+	}
+	p, err := mw.profiles.Get(opts.UserID)
+	switch {
+	case err == errProfileNotFound:
+		return call(ctx, s, opts)
+	case err != nil:
+		return Greeting{}, err
+	}
+	if p.PreferredName != "" {
+		s = p.PreferredName
+	}
+	if p.Locale != "" {
+		opts.Language = matchLanguage(p.Locale)
+	}
+	return call(ctx, s, opts)
+}
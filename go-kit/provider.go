@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// greetService works out what kind of greeting to give, and a
+// GreetingProvider phrases it. Providers register themselves by name in an
+// init func, and -greet.provider picks one, so a new way of phrasing
+// greetings is a new file rather than a change to the service.
+
+// A GreetingProvider turns a PhraseRequest into a greeting.
+type GreetingProvider interface {
+	Phrase(PhraseRequest) (Greeting, error)
+}
+
+// PhraseRequest is what greetService has decided about a greeting. Method is
+// hello or goodbye, followed by the formality if it isn't neutral, as in
+// hello.formal. Format is the built in phrasing, which is also its key in
+// greetCatalog. Tenant is the tenant the greeting is for, if any.
+type PhraseRequest struct {
+	Method    string
+	Format    string
+	Name      string
+	TimeOfDay string
+	Language  language.Tag
+	Tenant    string
+}
+
+// providerConfig is what providers are made from. Providers take what they
+// need from it and ignore the rest.
+type providerConfig struct {
+	// Templates are the service's greeting templates; see templates.go.
+	Templates *templateStore
+
+	// Seed seeds any random choices a provider makes.
+	Seed int64
+}
+
+type providerFactory func(providerConfig) (GreetingProvider, error)
+
+var greetingProviders = map[string]providerFactory{}
+
+// registerGreetingProvider makes a provider available by name.
+func registerGreetingProvider(name string, f providerFactory) {
+	greetingProviders[name] = f
+}
+
+// newGreetingProvider makes the provider registered as name.
+func newGreetingProvider(name string, config providerConfig) (GreetingProvider, error) {
+	f, ok := greetingProviders[name]
+	if !ok {
+		var names []string
+		for name := range greetingProviders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown greeting provider %q, want one of %s", name, strings.Join(names, ", "))
+	}
+	return f(config)
+}
+
+func init() {
+	registerGreetingProvider("catalog", func(providerConfig) (GreetingProvider, error) {
+		return catalogProvider{}, nil
+	})
+}
+
+// catalogProvider phrases greetings with the translations in greetCatalog.
+type catalogProvider struct{}
+
+func (catalogProvider) Phrase(r PhraseRequest) (Greeting, error) {
+	return Greeting{Text: newPrinter(r.Language).Sprintf(r.Format, r.Name), Language: r.Language}, nil
+}
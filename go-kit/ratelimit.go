@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// With -ratelimit.rps set, the HTTP greeting endpoints, and every other
+// transport that greets, share a token bucket that fills at that many requests
+// a second, holding up to -ratelimit.burst. A request that greets more than
+// once, on /hello/batch, /hello/many, /hello/ws, in a JSON-RPC batch or a
+// GraphQL query, takes a token for each greeting. A request that finds it
+// empty is answered 429 Too Many Requests, with a Retry-After saying how many
+// seconds until there's a token for it, rather than being queued. The
+// greetings given in the background, the rows of an import and the scheduled
+// greetings, wait for theirs instead. Tenants with a rate limit of their own
+// are held to both.
+
+// errRateLimited is the error of a request the limiter turned away.
+// RetryAfter is how long until it would have been let through.
+type errRateLimited struct {
+	RetryAfter time.Duration
+}
+
+func (e errRateLimited) Error() string { return "rate limit exceeded" }
+
+// newRateLimiter returns a limiter allowing rps requests a second, in bursts
+// of up to burst, or of rps rounded up if burst is 0. An rps of 0 allows
+// everything.
+func newRateLimiter(rps float64, burst int) *rate.Limiter {
+	return rate.NewLimiter(rateLimit(rps, burst))
+}
+
+// setRateLimit changes what limiter allows, as newRateLimiter would have it.
+func setRateLimit(limiter *rate.Limiter, rps float64, burst int) {
+	limit, burst := rateLimit(rps, burst)
+	limiter.SetBurst(burst)
+	limiter.SetLimit(limit)
+}
+
+func rateLimit(rps float64, burst int) (rate.Limit, int) {
+	if rps == 0 {
+		return rate.Inf, 0
+	}
+	if burst == 0 {
+		burst = int(math.Ceil(rps))
+	}
+	return rate.Limit(rps), burst
+}
+
+// rateLimitEndpoint returns an endpoint.Middleware that turns calls away
+// with errRateLimited when limiter has no token for them.
+func rateLimitEndpoint(limiter *rate.Limiter) endpoint.Middleware {
+	return rateLimitEndpointN(limiter, func(interface{}) int { return 1 })
+}
+
+// rateLimitEndpointN is rateLimitEndpoint for calls that greet more than
+// once, which take tokens(request) tokens each.
+func rateLimitEndpointN(limiter *rate.Limiter, tokens func(request interface{}) int) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if err := takeTokens(limiter, tokens(request)); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// takeTokens takes n tokens from limiter, or, if it hasn't got them, none,
+// failing with errRateLimited. A call that wants more than the burst takes
+// all of it, rather than never being let through.
+func takeTokens(limiter *rate.Limiter, n int) error {
+	if burst := limiter.Burst(); n > burst {
+		n = burst
+	}
+	r := limiter.ReserveN(time.Now(), n)
+	if d := r.Delay(); d > 0 {
+		// Give the tokens back, so turned away requests don't hold up the
+		// ones after them.
+		r.Cancel()
+		return errRateLimited{d}
+	}
+	return nil
+}
+
+// waitRateLimitEndpoint returns an endpoint.Middleware that holds calls until
+// limiter has a token for them, for the greetings given in the background,
+// which have nobody to answer 429 to.
+func waitRateLimitEndpoint(limiter *rate.Limiter) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if err := limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
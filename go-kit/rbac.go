@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	stdjwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/net/context"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// Each HTTP endpoint needs a permission, and -rbac.policy, a JSON file, says
+// which roles have each one:
+//
+//	{"templates.write": ["admin"], "stats.read": ["viewer", "admin"], "greet": ["*"]}
+//
+// A caller with none of a permission's roles is answered 403, and one that
+// hasn't authenticated at all 401. "*" is any caller that has authenticated.
+// Permissions the policy doesn't mention are anyone's, but for the restricted
+// ones, which change what the service does, show who's been greeted and how
+// they like it, or are only for its operators, and which nobody has unless
+// the policy gives them to someone. Without a policy, the service can be
+// called, but not changed or looked into, except on the admin listener, where
+// /admin/loglevel is whoever gets past -admin.token's. The policy is read
+// again when the file changes.
+//
+// A caller's roles are its API key's scopes, its client certificate's roles,
+// and its token's roles claim, and the scopes in its scope claim.
+
+// permissions are the permissions the endpoints need, and a policy can give.
+var permissions = []string{
+	"greet",
+	"history.read",
+	"stats.read",
+	"schedule.read", "schedule.write",
+	"templates.read", "templates.write",
+	"tenants.read", "tenants.write",
+	"aliases.read", "aliases.write",
+	"profiles.read", "profiles.write",
+	"ipfilter.read", "ipfilter.write",
+	"loglevel.read", "loglevel.write",
+}
+
+// restrictedPermissions are the permissions nobody has unless the policy
+// says who does.
+var restrictedPermissions = map[string]bool{
+	"history.read":    true,
+	"schedule.read":   true,
+	"schedule.write":  true,
+	"templates.read":  true,
+	"templates.write": true,
+	"tenants.read":    true,
+	"tenants.write":   true,
+	"aliases.write":   true,
+	"profiles.read":   true,
+	"profiles.write":  true,
+	"ipfilter.read":   true,
+	"ipfilter.write":  true,
+	"loglevel.read":   true,
+	"loglevel.write":  true,
+}
+
+// anyRole is the role every authenticated caller has.
+const anyRole = "*"
+
+// errNotPermitted is the error of a call by someone without the permission
+// for it.
+type errNotPermitted struct {
+	permission string
+}
+
+func (e errNotPermitted) Error() string {
+	return "caller doesn't have the " + e.permission + " permission"
+}
+
+// rbacPolicyCheck is how often an rbacPolicy looks for changes to its file.
+const rbacPolicyCheck = time.Second
+
+// rbacPolicy is the roles that have each permission.
+type rbacPolicy struct {
+	path string
+
+	mu      sync.Mutex
+	roles   map[string][]string
+	modTime time.Time
+	checked time.Time
+}
+
+// openRBACPolicy returns the policy in the file at path, or a policy that
+// lets anyone do anything if path is empty.
+func openRBACPolicy(path string) (*rbacPolicy, error) {
+	p := &rbacPolicy{path: path}
+	if path == "" {
+		return p, nil
+	}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// rolesFor returns the roles that have permission, or nil if anyone has it.
+// No roles at all is nobody.
+func (p *rbacPolicy) rolesFor(permission string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.path != "" && time.Since(p.checked) > rbacPolicyCheck {
+		// A file that's gone bad keeps the policy it had.
+		p.reload()
+	}
+	roles, ok := p.roles[permission]
+	if !ok && restrictedPermissions[permission] {
+		return []string{}
+	}
+	return roles
+}
+
+// reload reads the file if it's changed since it was last read.
+func (p *rbacPolicy) reload() error {
+	p.checked = time.Now()
+	fi, err := os.Stat(p.path)
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(p.modTime) {
+		return nil
+	}
+	b, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+	var roles map[string][]string
+	if err := json.Unmarshal(b, &roles); err != nil {
+		return err
+	}
+	for permission := range roles {
+		if !knownPermission(permission) {
+			return fmt.Errorf("%s: unknown permission %q, want one of %s", p.path, permission, strings.Join(permissions, ", "))
+		}
+	}
+	p.roles, p.modTime = roles, fi.ModTime()
+	return nil
+}
+
+func knownPermission(permission string) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// callerRoles returns the roles of the caller in ctx.
+func callerRoles(ctx context.Context) []string {
+	var roles []string
+	if k, ok := ctx.Value(apiKeyKey).(apiKey); ok {
+		roles = append(roles, k.Scopes...)
+	}
+	if id, ok := ctx.Value(certIdentityKey).(certIdentity); ok {
+		roles = append(roles, id.Roles...)
+	}
+	if claims, ok := ctx.Value(kitjwt.JWTClaimsContextKey).(stdjwt.MapClaims); ok {
+		if list, ok := claims["roles"].([]interface{}); ok {
+			for _, r := range list {
+				if r, ok := r.(string); ok {
+					roles = append(roles, r)
+				}
+			}
+		}
+		if scope, ok := claims["scope"].(string); ok {
+			roles = append(roles, strings.Fields(scope)...)
+		}
+	}
+	return roles
+}
+
+// authorize returns an endpoint.Middleware that only lets calls through from
+// callers with one of the roles that have permission, under policy.
+func authorize(policy *rbacPolicy, permission string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			allowed := policy.rolesFor(permission)
+			if allowed == nil {
+				return next(ctx, request)
+			}
+			if c, _ := ctx.Value(callerKey).(caller); c.Subject == "" {
+				return nil, errUnauthorized{err: errors.New("authentication required")}
+			}
+			roles := callerRoles(ctx)
+			for _, a := range allowed {
+				if a == anyRole {
+					return next(ctx, request)
+				}
+				for _, r := range roles {
+					if r == a {
+						return next(ctx, request)
+					}
+				}
+			}
+			return nil, errNotPermitted{permission}
+		}
+	}
+}
+
+// authz authenticates and authorizes the calls to endpoints outside the
+// greeting chain, for the permissions the policy restricts.
+type authz struct {
+	before       []kithttp.RequestFunc
+	authenticate endpoint.Middleware
+	policy       *rbacPolicy
+	// trusted is set on the admin listener, whose callers can do what the
+	// policy gives nobody, since -admin.token has let them in.
+	trusted bool
+}
+
+// endpoint returns e, needing permission. Calls are only authenticated if the
+// policy restricts the permission, so endpoints anyone can call don't want
+// credentials either.
+func (a authz) endpoint(permission string, e endpoint.Endpoint) endpoint.Endpoint {
+	guarded := a.authenticate(authorize(a.policy, permission)(e))
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		roles := a.policy.rolesFor(permission)
+		if roles == nil || a.trusted && len(roles) == 0 {
+			return e(ctx, request)
+		}
+		return guarded(ctx, request)
+	}
+}
+
+// handler returns h, needing permission, for the handlers that aren't go-kit
+// servers.
+func (a authz) handler(permission string, h http.Handler) http.Handler {
+	return a.gate(func(next endpoint.Endpoint) endpoint.Endpoint {
+		return a.endpoint(permission, next)
+	}, h)
+}
+
+// gate returns h, behind m, for the handlers that aren't go-kit servers. Its
+// requests' contexts are made by before, as a server's would be, and go on
+// to h with whatever m adds to them, such as who the caller authenticated
+// as. A call m turns away is answered as a server would answer it.
+func (a authz) gate(m endpoint.Middleware, h http.Handler) http.Handler {
+	check := m(func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return ctx, nil
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		for _, f := range a.before {
+			ctx = f(ctx, r)
+		}
+		checked, err := check(ctx, nil)
+		if err != nil {
+			encodeEndpointError(ctx, err, w)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(checked.(context.Context)))
+	})
+}
+
+// who authenticates r as a's servers would, for the handlers that have to
+// know who's calling before any of them do. It returns the subject r
+// authenticated as and the tenant it's for, quoted, or the empty ones if it
+// doesn't authenticate.
+func (a authz) who(r *http.Request) string {
+	ctx := r.Context()
+	for _, f := range a.before {
+		ctx = f(ctx, r)
+	}
+	checked, err := a.authenticate(func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return ctx, nil
+	})(ctx, nil)
+	if err == nil {
+		ctx = checked.(context.Context)
+	} else {
+		ctx = context.Background()
+	}
+	c, _ := ctx.Value(callerKey).(caller)
+	t, _ := ctx.Value(tenantKey).(tenant)
+	return fmt.Sprintf("%q %q", c.Subject, t.ID)
+}
+
+// options are the kithttp.ServerOptions of servers with endpoints from
+// endpoint.
+func (a authz) options() []kithttp.ServerOption {
+	return []kithttp.ServerOption{
+		kithttp.ServerBefore(a.before...),
+		kithttp.ServerErrorEncoder(encodeEndpointError),
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	stdjwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/net/context"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+)
+
+func writeRBACPolicy(t *testing.T, policy string) string {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := ioutil.WriteFile(path, []byte(policy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func nop(context.Context, interface{}) (interface{}, error) { return nil, nil }
+
+func TestAuthorize(t *testing.T) {
+	policy, err := openRBACPolicy(writeRBACPolicy(t, `{
+		"greet": ["*"],
+		"stats.read": ["viewer", "admin"],
+		"templates.write": ["admin"],
+		"tenants.write": []
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	noPolicy, err := openRBACPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anonymous := context.Background()
+	authenticated := func(sub string) context.Context {
+		return withCallerSubject(context.Background(), sub)
+	}
+	withScopes := func(scopes ...string) context.Context {
+		return context.WithValue(authenticated("key"), apiKeyKey, apiKey{ID: "key", Scopes: scopes})
+	}
+	withClaims := func(claims stdjwt.MapClaims) context.Context {
+		return context.WithValue(authenticated("token"), kitjwt.JWTClaimsContextKey, claims)
+	}
+
+	type want int
+	const (
+		allowed want = iota
+		unauthorized
+		notPermitted
+	)
+	for name, tc := range map[string]struct {
+		policy     *rbacPolicy
+		permission string
+		ctx        context.Context
+		want       want
+	}{
+		"anyone, anonymously":         {policy, "greet", anonymous, unauthorized},
+		"anyone, authenticated":       {policy, "greet", authenticated("ada"), allowed},
+		"role from a key's scopes":    {policy, "stats.read", withScopes("viewer"), allowed},
+		"role from a token's roles":   {policy, "stats.read", withClaims(stdjwt.MapClaims{"roles": []interface{}{"admin"}}), allowed},
+		"role from a token's scope":   {policy, "stats.read", withClaims(stdjwt.MapClaims{"scope": "openid viewer"}), allowed},
+		"without the role":            {policy, "templates.write", withScopes("viewer"), notPermitted},
+		"nobody":                      {policy, "tenants.write", withScopes("admin"), notPermitted},
+		"unmentioned":                 {policy, "aliases.read", anonymous, allowed},
+		"unmentioned restricted":      {policy, "loglevel.write", withScopes("admin"), notPermitted},
+		"no policy":                   {noPolicy, "stats.read", anonymous, allowed},
+		"no policy, restricted":       {noPolicy, "templates.write", anonymous, unauthorized},
+		"no policy, restricted, role": {noPolicy, "templates.write", withScopes("admin"), notPermitted},
+		"no policy, history":          {noPolicy, "history.read", anonymous, unauthorized},
+		"no policy, profiles":         {noPolicy, "profiles.read", withScopes("admin"), notPermitted},
+		"no policy, schedule":         {noPolicy, "schedule.read", anonymous, unauthorized},
+	} {
+		_, err := authorize(tc.policy, tc.permission)(nop)(tc.ctx, nil)
+		var got want
+		switch err.(type) {
+		case nil:
+			got = allowed
+		case errUnauthorized:
+			got = unauthorized
+		case errNotPermitted:
+			got = notPermitted
+		default:
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %v (%v), want %v", name, got, err, tc.want)
+		}
+	}
+}
+
+func TestAuthzTrusted(t *testing.T) {
+	policy, err := openRBACPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unchecked := func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	az := authz{authenticate: unchecked, policy: policy}
+	if _, err := az.endpoint("loglevel.write", nop)(context.Background(), nil); err == nil {
+		t.Error("loglevel.write allowed without a policy")
+	}
+	az.trusted = true
+	if _, err := az.endpoint("loglevel.write", nop)(context.Background(), nil); err != nil {
+		t.Errorf("loglevel.write on the admin listener: %v", err)
+	}
+}
+
+func TestOpenRBACPolicy(t *testing.T) {
+	for policy, ok := range map[string]bool{
+		`{"greet": ["*"]}`:            true,
+		`{}`:                          true,
+		`{"greet": "*"}`:              false,
+		`{"templates.delete": ["*"]}`: false,
+		`not json`:                    false,
+	} {
+		_, err := openRBACPolicy(writeRBACPolicy(t, policy))
+		if (err == nil) != ok {
+			t.Errorf("%s: err %v", policy, err)
+		}
+	}
+}
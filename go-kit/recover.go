@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+
+	log "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+)
+
+// A panic while serving an HTTP request is recovered from, rather than left
+// to net/http, which drops the connection. The panic is logged with its stack
+// and the request ID, counted in greet_http_panics_total, and, if nothing has
+// been written yet, answered with a 500 in the same JSON as other errors.
+// The errors of the 5xx problems that don't tell the client what they were
+// are logged here too.
+
+var errInternal = errors.New("internal server error")
+
+// recoveringHandler recovers from panics in next.
+type recoveringHandler struct {
+	panics metrics.Counter
+	logger log.Logger
+	next   http.Handler
+}
+
+func (h recoveringHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rw := &panicWriter{ResponseWriter: w, logger: h.logger}
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		if v == http.ErrAbortHandler {
+			// net/http's way of dropping the connection on purpose.
+			panic(v)
+		}
+		h.panics.Add(1)
+		requestLogger(r.Context(), h.logger).Log(
+			"method", r.Method, "path", r.URL.Path,
+			"panic", fmt.Sprint(v), "stack", string(debug.Stack()),
+		)
+		if !rw.written {
+			writeError(w, http.StatusInternalServerError, errInternal)
+		}
+	}()
+	h.next.ServeHTTP(rw, r)
+}
+
+// panicWriter notes whether any of the response has been written, so a
+// recovered panic doesn't try to start another. It's an errorLogger.
+type panicWriter struct {
+	http.ResponseWriter
+	logger  log.Logger
+	written bool
+}
+
+func (w *panicWriter) logError(err error) {
+	w.logger.Log("request_id", w.Header().Get(requestIDHeader), "err", err)
+}
+
+func (w *panicWriter) WriteHeader(code int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *panicWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming responses through as they're written.
+func (w *panicWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.written = true
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSockets take over the connection.
+func (w *panicWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection can't be hijacked")
+	}
+	w.written = true
+	return h.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the connection underneath.
+func (w *panicWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// With a service registry to register with, Consul's -consul.addr or etcd's
+// -etcd.endpoints, the service registers itself there once it's started, as an
+// instance of -register.name, so clients can find it, and deregisters itself as
+// soon as it starts shutting down, before it stops answering. The instance is
+// at -register.addr, which is the host's name and the port of -http.addr unless
+// it's said otherwise, with -register.tags, and Consul checks its health at
+// -register.check, which is /readyz on the advertised host, at the port of
+// -admin.addr if it's set and -http.addr's if not, unless that's said otherwise
+// too. A draining instance's /readyz fails, so it's taken out of rotation even
+// if it doesn't get to deregister.
+
+// serviceInstance is this instance of the service, as it's registered.
+type serviceInstance struct {
+	ID    string
+	Name  string
+	Host  string
+	Port  string
+	Tags  []string
+	Check string
+}
+
+// newServiceInstance returns the instance called name at addr, with tags and
+// checked at check, filling in what's empty from the addresses it listens
+// at, httpAddr and adminAddr.
+func newServiceInstance(name, addr string, tags []string, check, httpAddr, adminAddr string) (serviceInstance, error) {
+	if addr == "" {
+		if httpAddr == "" {
+			return serviceInstance{}, fmt.Errorf("no address to register, without -http.addr or -register.addr")
+		}
+		_, port, err := net.SplitHostPort(httpAddr)
+		if err != nil {
+			return serviceInstance{}, err
+		}
+		hostname, err := os.Hostname()
+		if err != nil {
+			return serviceInstance{}, err
+		}
+		addr = net.JoinHostPort(hostname, port)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return serviceInstance{}, fmt.Errorf("invalid address to register %q: %v", addr, err)
+	}
+	if check == "" {
+		checkPort := port
+		if adminAddr != "" {
+			if _, checkPort, err = net.SplitHostPort(adminAddr); err != nil {
+				return serviceInstance{}, err
+			}
+		}
+		check = "http://" + net.JoinHostPort(host, checkPort) + "/readyz"
+	}
+	return serviceInstance{
+		ID:    name + "-" + addr,
+		Name:  name,
+		Host:  host,
+		Port:  port,
+		Tags:  tags,
+		Check: check,
+	}, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	log "github.com/go-kit/kit/log"
+)
+
+// On a SIGHUP, the service reads again what it can change without a
+// restart: the -config file, see configfile.go, the -greet.templates file,
+// the -filter.words list, and the -tls.cert and -tls.key pair, see tls.go.
+// Everything is read and checked before anything changes, and if any of it
+// is wrong, that's logged and nothing changes at all. Otherwise it all
+// changes at once, and what changed is logged in one line:
+//
+//	msg="config reloaded" changed="log.level info -> debug, template hello/en, filter.words 23 words, TLS certificate"
+//
+// so settings can be tuned without a restart, or a deploy.
+
+// reloadable is something that's read again on a SIGHUP.
+type reloadable interface {
+	// prepareReload reads it again and checks it, returning a func that puts
+	// it in force and says what changed.
+	prepareReload() (func() ([]string, error), error)
+}
+
+// reloader reloads everything reloadable at once.
+type reloader struct {
+	reloadables []reloadable
+	logger      log.Logger
+}
+
+// add has r reload x as well.
+func (r *reloader) add(x reloadable) {
+	r.reloadables = append(r.reloadables, x)
+}
+
+// reload reloads everything, if all of it's right, and logs what changed.
+func (r *reloader) reload() {
+	var (
+		errs    configErrors
+		applies []func() ([]string, error)
+	)
+	for _, x := range r.reloadables {
+		apply, err := x.prepareReload()
+		if err != nil {
+			errs.add("%v", err)
+			continue
+		}
+		applies = append(applies, apply)
+	}
+	if err := errs.err(); err != nil {
+		r.logger.Log("msg", "config not reloaded", "err", err)
+		return
+	}
+
+	var changed []string
+	for _, apply := range applies {
+		c, err := apply()
+		changed = append(changed, c...)
+		if err != nil {
+			errs.add("%v", err)
+		}
+	}
+	if err := errs.err(); err != nil {
+		r.logger.Log("msg", "config partly reloaded", "changed", describeChanges(changed), "err", err)
+		return
+	}
+	r.logger.Log("msg", "config reloaded", "changed", describeChanges(changed))
+}
+
+// watch reloads everything whenever there's something on hup, until ctx is
+// done.
+func (r *reloader) watch(ctx context.Context, hup <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.reload()
+		}
+	}
+}
+
+// describeChanges says what changed, in a line.
+func describeChanges(changed []string) string {
+	if len(changed) == 0 {
+		return "nothing"
+	}
+	return strings.Join(changed, ", ")
+}
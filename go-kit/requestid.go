@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+
+	"golang.org/x/net/context"
+
+	log "github.com/go-kit/kit/log"
+)
+
+// Every HTTP request gets an ID, the one in its X-Request-ID header if it has
+// a usable one, or a new one otherwise. The ID is echoed back in the response's
+// X-Request-ID, put in the bodies of JSON error responses, and logged with
+// everything the request leads the service to log, so a report of something
+// going wrong can be matched up with the logs.
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDMaxLen is the longest request ID taken from a client.
+const requestIDMaxLen = 128
+
+type requestIDContextKey int
+
+// requestIDKey is the context key for the request ID.
+const requestIDKey requestIDContextKey = 0
+
+// requestIDHandler gives requests their IDs.
+type requestIDHandler struct {
+	next http.Handler
+}
+
+func (h requestIDHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(requestIDHeader)
+	if !validRequestID(id) {
+		var err error
+		if id, err = newRandomID(); err != nil {
+			// Better to serve the request without one than not at all.
+			h.next.ServeHTTP(w, r)
+			return
+		}
+	}
+	w.Header().Set(requestIDHeader, id)
+	h.next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+}
+
+// validRequestID says whether a client's request ID can be used as it is. It
+// has to be short, and printable ASCII without spaces, so it can't mess up
+// the logs it ends up in.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > requestIDMaxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDToContext is a kithttp.RequestFunc that carries the request ID
+// over into the context endpoints get.
+func requestIDToContext(ctx context.Context, r *http.Request) context.Context {
+	if id, ok := r.Context().Value(requestIDKey).(string); ok {
+		return context.WithValue(ctx, requestIDKey, id)
+	}
+	return ctx
+}
+
+// requestLogger returns logger, logging ctx's request ID with everything if
+// it has one.
+func requestLogger(ctx context.Context, logger log.Logger) log.Logger {
+	if id, ok := ctx.Value(requestIDKey).(string); ok {
+		return log.With(logger, "request_id", id)
+	}
+	return logger
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+)
+
+// Greetings can be scheduled for later. A greetScheduler keeps them in a
+// ScheduleStore and, when each one is due, sends its hello request through
+// the service like any other, so it shows up in the history and on
+// /hello/stream. With -schedule.file the store is a file, and greetings that
+// came due while the service was down are sent as soon as it's back.
+
+// The states a scheduled greeting goes through. Only a pending greeting can
+// be cancelled.
+const (
+	schedulePending   = "pending"
+	scheduleDelivered = "delivered"
+	scheduleFailed    = "failed"
+	scheduleCancelled = "cancelled"
+)
+
+// scheduledGreeting is a hello request to send at a given time, and what came
+// of it.
+type scheduledGreeting struct {
+	ID          string       `json:"id"`
+	Request     helloRequest `json:"request"`
+	At          time.Time    `json:"at"`
+	Status      string       `json:"status"`
+	Greeting    string       `json:"greeting,omitempty"`
+	Err         string       `json:"err,omitempty"`
+	DeliveredAt *time.Time   `json:"delivered_at,omitempty"`
+}
+
+var (
+	errScheduleNotFound   = errors.New("scheduled greeting not found")
+	errScheduleNotPending = errors.New("scheduled greeting is no longer pending")
+)
+
+// ScheduleStore keeps scheduled greetings by ID.
+type ScheduleStore interface {
+	// Save stores g, replacing any earlier version of it.
+	Save(g scheduledGreeting) error
+
+	// Get returns the scheduled greeting with the ID, or errScheduleNotFound.
+	Get(id string) (scheduledGreeting, error)
+
+	// Pending returns every pending greeting, soonest first.
+	Pending() ([]scheduledGreeting, error)
+}
+
+// memScheduleStore is a ScheduleStore that keeps everything in memory.
+type memScheduleStore struct {
+	mu        sync.RWMutex
+	greetings map[string]scheduledGreeting
+}
+
+func newMemScheduleStore() *memScheduleStore {
+	return &memScheduleStore{greetings: map[string]scheduledGreeting{}}
+}
+
+func (s *memScheduleStore) Save(g scheduledGreeting) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.greetings[g.ID] = g
+	return nil
+}
+
+func (s *memScheduleStore) Get(id string) (scheduledGreeting, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, ok := s.greetings[id]
+	if !ok {
+		return scheduledGreeting{}, errScheduleNotFound
+	}
+	return g, nil
+}
+
+func (s *memScheduleStore) Pending() ([]scheduledGreeting, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var pending []scheduledGreeting
+	for _, g := range s.greetings {
+		if g.Status == schedulePending {
+			pending = append(pending, g)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].At.Before(pending[j].At) })
+	return pending, nil
+}
+
+// fileScheduleStore is a memScheduleStore that also appends every version of
+// every greeting to a file, one JSON object per line. Reading the file back
+// in, the last version of each greeting wins.
+type fileScheduleStore struct {
+	*memScheduleStore
+	mu sync.Mutex
+	f  *os.File
+}
+
+func openFileScheduleStore(path string) (*fileScheduleStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &fileScheduleStore{memScheduleStore: newMemScheduleStore(), f: f}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var g scheduledGreeting
+		if err := json.Unmarshal(scanner.Bytes(), &g); err != nil {
+			f.Close()
+			return nil, err
+		}
+		s.memScheduleStore.Save(g)
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileScheduleStore) Save(g scheduledGreeting) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return s.memScheduleStore.Save(g)
+}
+
+// greetScheduler sends scheduled greetings to e when they're due.
+type greetScheduler struct {
+	store  ScheduleStore
+	e      endpoint.Endpoint
+	logger log.Logger
+
+	// mu keeps a greeting from being cancelled while it's being sent.
+	mu   sync.Mutex
+	wake chan struct{}
+}
+
+func newGreetScheduler(store ScheduleStore, e endpoint.Endpoint, logger log.Logger) *greetScheduler {
+	return &greetScheduler{store: store, e: e, logger: logger, wake: make(chan struct{}, 1)}
+}
+
+// Schedule stores a new pending greeting for req, to be sent at at.
+func (s *greetScheduler) Schedule(req helloRequest, at time.Time) (scheduledGreeting, error) {
+	id, err := newRandomID()
+	if err != nil {
+		return scheduledGreeting{}, err
+	}
+	g := scheduledGreeting{ID: id, Request: req, At: at, Status: schedulePending}
+	if err := s.store.Save(g); err != nil {
+		return scheduledGreeting{}, err
+	}
+	// Run may be waiting on a greeting that's due later than this one.
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return g, nil
+}
+
+// Get returns the scheduled greeting with the ID.
+func (s *greetScheduler) Get(id string) (scheduledGreeting, error) {
+	return s.store.Get(id)
+}
+
+// Cancel cancels a pending greeting, or fails with errScheduleNotPending if
+// it's too late.
+func (s *greetScheduler) Cancel(id string) (scheduledGreeting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, err := s.store.Get(id)
+	if err != nil {
+		return g, err
+	}
+	if g.Status != schedulePending {
+		return g, errScheduleNotPending
+	}
+	g.Status = scheduleCancelled
+	return g, s.store.Save(g)
+}
+
+// Run sends greetings as they come due, until ctx is done.
+func (s *greetScheduler) Run(ctx context.Context) error {
+	ctx = context.WithValue(ctx, callerKey, caller{Transport: "schedule"})
+	for {
+		pending, err := s.store.Pending()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for len(pending) > 0 && !pending[0].At.After(now) {
+			s.deliver(ctx, pending[0].ID)
+			pending = pending[1:]
+		}
+
+		// With nothing pending, there's nothing to do until Schedule says so.
+		var (
+			timer *time.Timer
+			due   <-chan time.Time
+		)
+		if len(pending) > 0 {
+			timer = time.NewTimer(pending[0].At.Sub(now))
+			due = timer.C
+		}
+		select {
+		case <-due:
+		case <-s.wake:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// deliver sends the greeting with the ID, unless it's been cancelled since
+// Run last looked.
+func (s *greetScheduler) deliver(ctx context.Context, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, err := s.store.Get(id)
+	if err != nil || g.Status != schedulePending {
+		return
+	}
+
+	response, err := s.e(ctx, g.Request)
+	if err == nil {
+		resp := response.(helloResponse)
+		g.Greeting, err = resp.Greeting, resp.Err
+	}
+	g.Status, g.Err = scheduleDelivered, err2str(err)
+	if err != nil {
+		g.Status = scheduleFailed
+	}
+	now := time.Now()
+	g.DeliveredAt = &now
+	if err := s.store.Save(g); err != nil {
+		s.logger.Log("err", err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// Every HTTP listener has its own http.Server, with limits on how long a
+// client can take, so a slow one can't hold connections open for as long as
+// it likes: -http.timeout.header to send its request's headers, of at most
+// -http.header.max bytes, -http.timeout.read to send the whole request, body
+// and all, -http.timeout.write for the response to be sent, and
+// -http.timeout.idle to keep a connection open between requests. A large
+// POST /hello/import has to be uploaded within -http.timeout.read.
+//
+// Responses that stream for as long as the client likes, /hello/stream,
+// /hello/ws, /hello/many and /greetings/export, aren't held to the read and
+// write timeouts. Nor is the admin listener's, so profiles can run for as
+// long as they're asked to.
+
+// httpLimits are the limits on the clients of an HTTP listener. Zero
+// durations are no limit.
+type httpLimits struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+}
+
+// newServer returns a server of handler held to l.
+func (l httpLimits) newServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: l.ReadHeaderTimeout,
+		ReadTimeout:       l.ReadTimeout,
+		WriteTimeout:      l.WriteTimeout,
+		IdleTimeout:       l.IdleTimeout,
+		MaxHeaderBytes:    l.MaxHeaderBytes,
+	}
+}
+
+// liftDeadlines frees a response that streams for as long as the client
+// likes from the server's read and write timeouts.
+func liftDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+}
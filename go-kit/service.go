@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// GreetService is the interface that defines our service, and it will enable
+// us to create compatible middlewares to add functionality. The context
+// carries request scoped values, like who's calling, to those middlewares.
+type GreetService interface {
+	Hello(context.Context, string, GreetOptions) (Greeting, error)
+	Goodbye(context.Context, string, GreetOptions) (Greeting, error)
+}
+
+// A Greeting is what the service has to say, and the language it's in, which
+// isn't always the one asked for. Transliterated is Text in ASCII, if it was
+// asked for; see transliterate.go.
+type Greeting struct {
+	Text           string
+	Language       language.Tag
+	Transliterated string
+}
+
+// errNoName is the error for greeting nobody.
+var errNoName = errors.New("no name provided")
+
+// GreetOptions change how a name is greeted. The zero value greets in English.
+// Setting a Location greets by the time of day there, and PreserveCase leaves
+// the name capitalized the way the caller wrote it. UserID, if set, is whose
+// profile to greet by; see profiles.go. Title, like Dr. or Mx., goes with the
+// name; see honorifics.go. Tenant is who the request is on behalf of, if
+// anyone; see tenants.go. NoAlias greets the name as given, even if it has an
+// alias; see aliases.go. Transliterate asks for the greeting in ASCII too.
+type GreetOptions struct {
+	Language      language.Tag
+	Location      *time.Location
+	PreserveCase  bool
+	UserID        string
+	Formality     Formality
+	Title         string
+	Tenant        string
+	NoAlias       bool
+	Transliterate bool
+}
+
+// Formality picks the phrasing of a greeting. The zero value is neutral.
+type Formality string
+
+const (
+	FormalityCasual  Formality = "casual"
+	FormalityNeutral Formality = "neutral"
+	FormalityFormal  Formality = "formal"
+)
+
+// parseFormality parses a formality as given in a request. An empty one is
+// neutral.
+func parseFormality(s string) (Formality, error) {
+	switch f := Formality(s); f {
+	case "":
+		return FormalityNeutral, nil
+	case FormalityCasual, FormalityNeutral, FormalityFormal:
+		return f, nil
+	}
+	return "", validationError{"formality", "invalid_formality", fmt.Sprintf("formality must be casual, neutral or formal, not %q", s)}
+}
+
+func (o GreetOptions) formality() Formality {
+	if o.Formality == "" {
+		return FormalityNeutral
+	}
+	return o.Formality
+}
+
+// Here we concrete type that we can use to implement the GreetService interface.
+// provider phrases the greetings, with the catalog if it's nil, and
+// byTimeOfDay makes every Hello a good morning, afternoon or evening, by the
+// clock.
+type greetService struct {
+	provider    GreetingProvider
+	clock       Clock
+	byTimeOfDay bool
+}
+
+// Hello is the func that is required to implement the GreetService interface.
+// creating this func makes the greetService type implicitly implement the
+// GreetService interface.
+func (g greetService) Hello(_ context.Context, s string, opts GreetOptions) (Greeting, error) {
+	if s == "" {
+		return Greeting{}, errNoName
+	}
+	format := helloFormats[opts.formality()]
+	if g.byTimeOfDay || opts.Location != nil {
+		format = timeOfDayFormats[timeOfDay(g.now(opts))]
+	}
+	return g.greet("hello", format, addressName(capitalize(s, opts), opts.Title, opts.Language), opts)
+}
+
+// Goodbye is the other half of the conversation, and takes names the same way
+// Hello does.
+func (g greetService) Goodbye(_ context.Context, s string, opts GreetOptions) (Greeting, error) {
+	if s == "" {
+		return Greeting{}, errNoName
+	}
+	return g.greet("goodbye", goodbyeFormats[opts.formality()], addressName(capitalize(s, opts), opts.Title, opts.Language), opts)
+}
+
+// greet has the provider phrase a greeting for method, which is named for its
+// formality too unless it's neutral, like hello.formal.
+func (g greetService) greet(method, format, name string, opts GreetOptions) (Greeting, error) {
+	if f := opts.formality(); f != FormalityNeutral {
+		method += "." + string(f)
+	}
+	var provider GreetingProvider = catalogProvider{}
+	if g.provider != nil {
+		provider = g.provider
+	}
+	return provider.Phrase(PhraseRequest{
+		Method:    method,
+		Format:    format,
+		Name:      name,
+		TimeOfDay: timeOfDay(g.now(opts)),
+		Language:  opts.Language,
+		Tenant:    opts.Tenant,
+	})
+}
+
+// capitalize starts each word of the name with a capital letter, following the
+// rules of the greeting's language. Letters that are already capitals stay
+// that way, so McDonald isn't turned into Mcdonald.
+func capitalize(name string, opts GreetOptions) string {
+	if opts.PreserveCase {
+		return name
+	}
+	return cases.Title(opts.Language, cases.NoLower).String(name)
+}
+
+// helloFormats and goodbyeFormats are the greetings, by formality.
+var (
+	helloFormats = map[Formality]string{
+		FormalityCasual:  "Hey, %s",
+		FormalityNeutral: "Hello there, %s",
+		FormalityFormal:  "Good day, %s",
+	}
+	goodbyeFormats = map[Formality]string{
+		FormalityCasual:  "Bye, %s",
+		FormalityNeutral: "Goodbye, %s",
+		FormalityFormal:  "Farewell, %s",
+	}
+)
+
+// timeOfDayFormats are the time of day greetings, by the part of the day.
+// They suit any formality, so they're used whatever the request asked for.
+var timeOfDayFormats = map[string]string{
+	"morning":   "Good morning, %s",
+	"afternoon": "Good afternoon, %s",
+	"evening":   "Good evening, %s",
+}
+
+// now is the time where the caller is, if they said, and otherwise here.
+func (g greetService) now(opts GreetOptions) time.Time {
+	var t time.Time
+	if g.clock != nil {
+		t = g.clock.Now()
+	} else {
+		t = time.Now()
+	}
+	if opts.Location != nil {
+		t = t.In(opts.Location)
+	}
+	return t
+}
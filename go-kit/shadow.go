@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+)
+
+// With -shadow.url set, a share of the requests for -shadow.paths, the
+// greeting endpoints by default, are sent on to that backend as well, a new
+// greeting provider being tried out, say. -shadow.percent is how many of
+// every hundred. The copies go out in the background, after the request has
+// been read, and their answers are thrown away, so however the shadow
+// backend does, callers don't know about it. The copies have an X-Shadow
+// header, and the request's own request ID.
+//
+// At most -shadow.inflight copies are in flight at once, for -shadow.timeout
+// at most, and requests with bodies of more than -shadow.body bytes aren't
+// copied; a request there's no room to copy isn't held up, just not copied.
+// How the copies fared is counted in
+// greet_shadow_requests_total, by outcome: sent, failed or skipped.
+
+// shadowHeader marks the requests a shadowHandler sends.
+const shadowHeader = "X-Shadow"
+
+// shadowHandler mirrors some of the requests to next to target.
+type shadowHandler struct {
+	target   *url.URL
+	percent  float64
+	paths    []string
+	maxBody  int64
+	client   *http.Client
+	inflight chan struct{}
+	mirrored metrics.Counter
+	logger   log.Logger
+	next     http.Handler
+}
+
+func newShadowHandler(target string, percent float64, paths []string, inflight int, maxBody int64, timeout time.Duration, mirrored metrics.Counter, logger log.Logger, next http.Handler) (*shadowHandler, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	return &shadowHandler{
+		target:   u,
+		percent:  percent,
+		paths:    paths,
+		maxBody:  maxBody,
+		client:   &http.Client{Timeout: timeout},
+		inflight: make(chan struct{}, inflight),
+		mirrored: mirrored,
+		logger:   logger,
+		next:     next,
+	}, nil
+}
+
+func (h *shadowHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if coversPath(h.paths, r.URL.Path) && r.Header.Get(shadowHeader) == "" && rand.Float64()*100 < h.percent {
+		h.mirror(r)
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// mirror sends a copy of r to the target in the background, reading its
+// body first, and putting it back for next.
+func (h *shadowHandler) mirror(r *http.Request) {
+	if r.ContentLength > h.maxBody {
+		h.mirrored.With("outcome", "skipped").Add(1)
+		return
+	}
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = ioutil.ReadAll(io.LimitReader(r.Body, h.maxBody+1))
+		r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		if err != nil || int64(len(body)) > h.maxBody {
+			h.mirrored.With("outcome", "skipped").Add(1)
+			return
+		}
+	}
+	select {
+	case h.inflight <- struct{}{}:
+	default:
+		h.mirrored.With("outcome", "skipped").Add(1)
+		return
+	}
+	u := *h.target
+	u.Path = strings.TrimSuffix(u.Path, "/") + r.URL.Path
+	u.RawQuery = r.URL.RawQuery
+	header := r.Header.Clone()
+	header.Set(shadowHeader, "1")
+	if id, ok := r.Context().Value(requestIDKey).(string); ok {
+		header.Set(requestIDHeader, id)
+	}
+	go func() {
+		defer func() { <-h.inflight }()
+		req, err := http.NewRequest(r.Method, u.String(), bytes.NewReader(body))
+		if err != nil {
+			h.mirrored.With("outcome", "failed").Add(1)
+			return
+		}
+		req.Header = header
+		resp, err := h.client.Do(req)
+		if err != nil {
+			h.mirrored.With("outcome", "failed").Add(1)
+			h.logger.Log("shadow", u.Host, "request_id", header.Get(requestIDHeader), "err", err)
+			return
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		h.mirrored.With("outcome", "sent").Add(1)
+	}()
+}
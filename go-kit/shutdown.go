@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+
+	log "github.com/go-kit/kit/log"
+)
+
+// The listeners and consumers all run in one errgroup.Group. When one of them
+// fails, or the process gets a SIGINT or SIGTERM, the group's context is done
+// and the service shuts down gracefully: /readyz starts failing, and after
+// -shutdown.delay the HTTP servers stop taking new connections and wait for
+// the requests they're serving to be answered, the gRPC server likewise, and
+// then the message consumers and Thrift server are stopped. Anything still unanswered after -shutdown.timeout is dropped.
+
+// errStopped is what the group ends with when the process gets sig, which is
+// it being stopped rather than failing.
+type errStopped struct {
+	sig os.Signal
+}
+
+func (e errStopped) Error() string { return e.sig.String() }
+
+// serveUntilDone runs serve in g. An error it returns once ctx is done, as
+// every server's Serve does when it's stopped, is the server having been
+// shut down, not a failure.
+func serveUntilDone(g *errgroup.Group, ctx context.Context, serve func() error) {
+	g.Go(func() error {
+		err := serve()
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	})
+}
+
+// drain shuts the servers down, giving them up to timeout between them to
+// finish what they're doing, and then calls stops.
+func drain(timeout time.Duration, logger log.Logger, servers []*http.Server, grpcServer *grpc.Server, stops []func()) error {
+	logger.Log("msg", "shutting down", "timeout", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		first error
+	)
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				// Whatever's left is dropped.
+				server.Close()
+				mu.Lock()
+				if first == nil {
+					first = err
+				}
+				mu.Unlock()
+			}
+		}(server)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	}()
+	wg.Wait()
+
+	for _, stop := range stops {
+		stop()
+	}
+	return first
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+)
+
+// With -singleflight set, identical HTTP greeting calls that are in flight
+// at the same time, as when a herd of clients retries at once, are made
+// once, and every one of them gets that call's answer. Calls are identical
+// if they're for the same endpoint, tenant and subject, with the same
+// request. The call that's made is the first one's, with its context, so if
+// that caller goes away, the others get its error too. Calls that got
+// another's answer are counted, by endpoint, in
+// greet_singleflight_shared_total.
+
+// singleflightConfig says whether calls are collapsed, and counts the ones
+// that are.
+type singleflightConfig struct {
+	Enabled bool
+	shared  metrics.Counter
+}
+
+// endpoint returns an endpoint.Middleware that collapses the identical calls
+// to the endpoint called name.
+func (c singleflightConfig) endpoint(name string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		if !c.Enabled {
+			return next
+		}
+		var group singleflight.Group
+		shared := c.shared.With("endpoint", name)
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			cl, _ := ctx.Value(callerKey).(caller)
+			t, _ := ctx.Value(tenantKey).(tenant)
+			key := fmt.Sprintf("%s\x00%s\x00%#v", t.ID, cl.Subject, request)
+			made := false
+			response, err, _ := group.Do(key, func() (interface{}, error) {
+				made = true
+				return next(ctx, request)
+			})
+			if !made {
+				shared.Add(1)
+			}
+			return response, err
+		}
+	}
+}
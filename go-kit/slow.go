@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+)
+
+// With -slow.threshold set, an HTTP greeting call that takes longer than that
+// is logged at warn, with what there is to know about it: the endpoint, how
+// long it took, how it ended, its request and trace IDs, who made it, for
+// which tenant, and the request itself, redacted as the service's calls are.
+// Slow calls are counted, by endpoint, in greet_slow_requests_total.
+
+// slowConfig is what a call has to take longer than to be slow, and what's
+// done about it. Slow calls are only logged if the least level settings says
+// to log is warn or below. A zero Threshold means no call is slow.
+type slowConfig struct {
+	Threshold time.Duration
+	logger    log.Logger
+	settings  *logSettings
+	redact    []redactor
+	slow      metrics.Counter
+}
+
+// endpoint returns an endpoint.Middleware that logs and counts the calls to
+// the endpoint called name that are slow.
+func (c slowConfig) endpoint(name string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		if c.Threshold <= 0 {
+			return next
+		}
+		slow := c.slow.With("endpoint", name)
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			defer func(begin time.Time) {
+				took := time.Since(begin)
+				if took <= c.Threshold {
+					return
+				}
+				slow.Add(1)
+				if level, _ := c.settings.Load(); level > levelWarn {
+					return
+				}
+				cl, _ := ctx.Value(callerKey).(caller)
+				t, _ := ctx.Value(tenantKey).(tenant)
+				input := fmt.Sprintf("%+v", request)
+				for _, r := range c.redact {
+					input = r("input", input)
+				}
+				keyvals := []interface{}{
+					"level", levelWarn,
+					"slow", name,
+					"took", took,
+					"threshold", c.Threshold,
+					"err", err,
+					"subject", cl.Subject,
+					"addr", cl.Addr,
+					"tenant", t.ID,
+					"request", input,
+				}
+				if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+					keyvals = append(keyvals, "trace_id", sc.TraceID().String())
+				}
+				requestLogger(ctx, c.logger).Log(keyvals...)
+			}(time.Now())
+			return next(ctx, request)
+		}
+	}
+}
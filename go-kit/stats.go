@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axiomhq/hyperloglog"
+	"golang.org/x/net/context"
+)
+
+// The service keeps a few running counts of what it's been asked to do, for
+// GET /stats. They're lost on restart, and the number of different names is
+// an estimate, kept in a HyperLogLog sketch so it takes the same few
+// kilobytes however many names there are.
+
+// greetStats counts greetings since the service started.
+type greetStats struct {
+	mu        sync.Mutex
+	since     time.Time
+	total     uint64
+	errors    uint64
+	methods   map[string]uint64
+	languages map[string]uint64
+	names     *hyperloglog.Sketch
+}
+
+func newGreetStats() *greetStats {
+	return &greetStats{
+		since:     time.Now(),
+		methods:   map[string]uint64{},
+		languages: map[string]uint64{},
+		names:     hyperloglog.New(),
+	}
+}
+
+// statsSummary is a snapshot of greetStats. Languages only counts greetings
+// that succeeded.
+type statsSummary struct {
+	Since       time.Time         `json:"since"`
+	Total       uint64            `json:"total"`
+	Errors      uint64            `json:"errors"`
+	Methods     map[string]uint64 `json:"methods"`
+	Languages   map[string]uint64 `json:"languages"`
+	UniqueNames uint64            `json:"unique_names"`
+}
+
+// add counts one call to method. Names are counted without regard to case,
+// so aaron and Aaron are one name.
+func (s *greetStats) add(method, name string, g Greeting, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total++
+	s.methods[method]++
+	if err != nil {
+		s.errors++
+		return
+	}
+	s.languages[g.Language.String()]++
+	s.names.Insert([]byte(strings.ToLower(name)))
+}
+
+func (s *greetStats) summary() statsSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary := statsSummary{
+		Since:       s.since,
+		Total:       s.total,
+		Errors:      s.errors,
+		Methods:     map[string]uint64{},
+		Languages:   map[string]uint64{},
+		UniqueNames: s.names.Estimate(),
+	}
+	for k, v := range s.methods {
+		summary.Methods[k] = v
+	}
+	for k, v := range s.languages {
+		summary.Languages[k] = v
+	}
+	return summary
+}
+
+// statsMiddleware counts every call in greetStats.
+type statsMiddleware struct {
+	stats *greetStats
+	next  GreetService
+}
+
+func (mw statsMiddleware) Hello(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.count(ctx, "hello", s, opts, mw.next.Hello)
+}
+
+func (mw statsMiddleware) Goodbye(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.count(ctx, "goodbye", s, opts, mw.next.Goodbye)
+}
+
+func (mw statsMiddleware) count(ctx context.Context, method, s string, opts GreetOptions, call greetMethod) (Greeting, error) {
+	g, err := call(ctx, s, opts)
+	mw.stats.add(method, s, g, err)
+	return g, err
+}
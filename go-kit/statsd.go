@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	log "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/dogstatsd"
+	"github.com/go-kit/kit/metrics/statsd"
+)
+
+// Where nothing scrapes /metrics, -statsd.addr has the service push the
+// calls it gets, the ones that fail and how long they take, by method, to a
+// StatsD server over UDP every -statsd.interval, as well as counting them for
+// Prometheus:
+//
+//	greet.service.request_count      a counter
+//	greet.service.error_count        a counter
+//	greet.service.request_latency    a timing, in milliseconds
+//
+// -statsd.prefix is what the names start with. With -statsd.format
+// dogstatsd, they're tagged with method:Hello and the like, and -statsd.tags,
+// like env:prod,region:eu, as well; plain StatsD has no tags, so the numbers
+// are the sum over every method. What's been counted since the last push is
+// pushed once more when the service shuts down, after it's stopped taking
+// calls.
+
+// statsdSink collects metrics to push to a StatsD server.
+type statsdSink struct {
+	counter func(name string) metrics.Counter
+	timing  func(name string) metrics.Histogram
+	writeTo func(io.Writer) (int64, error)
+
+	conn   net.Conn
+	logger log.Logger
+}
+
+// newStatsdSink returns a statsdSink pushing to addr in format, statsd or
+// dogstatsd, with names starting with prefix and, for dogstatsd, tagged with
+// tags, each key:value.
+func newStatsdSink(addr, format, prefix string, tags []string, logger log.Logger) (*statsdSink, error) {
+	var lvs []string
+	for _, tag := range tags {
+		i := strings.Index(tag, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid StatsD tag %q, want key:value", tag)
+		}
+		lvs = append(lvs, tag[:i], tag[i+1:])
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &statsdSink{conn: conn, logger: logger}
+	switch format {
+	case "dogstatsd":
+		d := dogstatsd.New(prefix, logger)
+		s.counter = func(name string) metrics.Counter { return d.NewCounter(name, 1).With(lvs...) }
+		s.timing = func(name string) metrics.Histogram { return d.NewTiming(name, 1).With(lvs...) }
+		s.writeTo = d.WriteTo
+	case "statsd":
+		if len(lvs) > 0 {
+			conn.Close()
+			return nil, fmt.Errorf("StatsD tags need the dogstatsd format")
+		}
+		d := statsd.New(prefix, logger)
+		s.counter = func(name string) metrics.Counter { return d.NewCounter(name, 1) }
+		s.timing = func(name string) metrics.Histogram { return d.NewTiming(name, 1) }
+		s.writeTo = d.WriteTo
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("invalid StatsD format %q, want statsd or dogstatsd", format)
+	}
+	return s, nil
+}
+
+// Counter returns the counter called name.
+func (s *statsdSink) Counter(name string) metrics.Counter {
+	return s.counter(name)
+}
+
+// Latency returns the timing called name, which is observed in seconds, the
+// way the Prometheus histograms are, and pushed in milliseconds.
+func (s *statsdSink) Latency(name string) metrics.Histogram {
+	return millisecondsHistogram{s.timing(name)}
+}
+
+// run pushes what's been collected every interval until ctx is done.
+func (s *statsdSink) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.flush()
+		}
+	}
+}
+
+// flush pushes what's been collected since the last push.
+func (s *statsdSink) flush() {
+	if _, err := s.writeTo(s.conn); err != nil {
+		s.logger.Log("msg", "StatsD", "err", err)
+	}
+}
+
+// Close pushes what's left, and closes the connection.
+func (s *statsdSink) Close() {
+	s.flush()
+	s.conn.Close()
+}
+
+// millisecondsHistogram observes values in seconds in a histogram of
+// milliseconds.
+type millisecondsHistogram struct {
+	next metrics.Histogram
+}
+
+func (h millisecondsHistogram) With(labelValues ...string) metrics.Histogram {
+	return millisecondsHistogram{h.next.With(labelValues...)}
+}
+
+func (h millisecondsHistogram) Observe(value float64) {
+	h.next.Observe(value * 1000)
+}
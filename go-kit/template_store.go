@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// The service's templates can be changed while it runs, under
+// /admin/templates; see transport_templates.go. They start out as the ones in
+// -greet.templates. Every change, deletes included, is kept as a new version
+// of the template for its method and language, so a bad template can be
+// rolled back to one that worked. Versions are only kept in memory.
+
+var (
+	errTemplateNotFound        = errors.New("template not found")
+	errTemplateExists          = errors.New("template already exists")
+	errTemplateVersionNotFound = errors.New("template version not found")
+)
+
+// templateSource gives out the templates to use right now.
+type templateSource interface {
+	current() greetTemplates
+}
+
+func (t greetTemplates) current() greetTemplates { return t }
+
+// templateVersion is one version of a template. A deleted template has a
+// version with no template in it.
+type templateVersion struct {
+	Version  int         `json:"version"`
+	Template rawVariants `json:"template,omitempty"`
+	Deleted  bool        `json:"deleted,omitempty"`
+	Created  time.Time   `json:"created"`
+}
+
+// storedTemplate is a version of the template for a method and language.
+type storedTemplate struct {
+	Method string `json:"method"`
+	Lang   string `json:"lang"`
+	templateVersion
+}
+
+type templateKey struct {
+	method, lang string
+}
+
+// templateStore is a templateSource that keeps every version of every
+// template, and serves the latest ones.
+type templateStore struct {
+	mu       sync.Mutex
+	versions map[templateKey][]templateVersion
+
+	// live is the latest version of every template that isn't deleted,
+	// parsed, so greetings don't have to take mu.
+	live atomic.Value
+
+	// changes counts the times live has changed.
+	changes uint64
+}
+
+// newTemplateStore returns a templateStore with raw, as it's written in a
+// templates file, as the first version of each template.
+func newTemplateStore(raw map[string]map[string]rawVariants) (*templateStore, error) {
+	s := &templateStore{versions: map[templateKey][]templateVersion{}}
+	for method, byLang := range raw {
+		for lang, variants := range byLang {
+			key, err := makeTemplateKey(method, lang)
+			if err != nil {
+				return nil, err
+			}
+			s.versions[key] = []templateVersion{{Version: 1, Template: variants, Created: time.Now()}}
+		}
+	}
+	if err := s.update(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// openTemplateStore returns a templateStore starting with the templates file
+// at path, or with no templates if path is empty.
+func openTemplateStore(path string) (*templateStore, error) {
+	if path == "" {
+		return newTemplateStore(nil)
+	}
+	raw, err := readGreetTemplates(path)
+	if err != nil {
+		return nil, err
+	}
+	return newTemplateStore(raw)
+}
+
+// makeTemplateKey checks method and lang, and writes lang the way
+// parseGreetTemplates will, so "EN" and "en" are the same template.
+func makeTemplateKey(method, lang string) (templateKey, error) {
+	if method == "" {
+		return templateKey{}, validationError{"method", "required", "method is required"}
+	}
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return templateKey{}, validationError{"lang", "invalid_lang", "lang is not a language tag"}
+	}
+	return templateKey{method, tag.String()}, nil
+}
+
+func (s *templateStore) current() greetTemplates {
+	t, _ := s.live.Load().(greetTemplates)
+	return t
+}
+
+// List returns the latest version of every template that isn't deleted,
+// sorted by method and language.
+func (s *templateStore) List() []storedTemplate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []storedTemplate{}
+	for key, versions := range s.versions {
+		if v := versions[len(versions)-1]; !v.Deleted {
+			list = append(list, storedTemplate{key.method, key.lang, v})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Method != list[j].Method {
+			return list[i].Method < list[j].Method
+		}
+		return list[i].Lang < list[j].Lang
+	})
+	return list
+}
+
+// Get returns the latest version of a template, or errTemplateNotFound if
+// there isn't one or it's deleted.
+func (s *templateStore) Get(method, lang string) (storedTemplate, error) {
+	key, err := makeTemplateKey(method, lang)
+	if err != nil {
+		return storedTemplate{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versions := s.versions[key]
+	if len(versions) == 0 || versions[len(versions)-1].Deleted {
+		return storedTemplate{}, errTemplateNotFound
+	}
+	return storedTemplate{key.method, key.lang, versions[len(versions)-1]}, nil
+}
+
+// Versions returns every version of a template, oldest first.
+func (s *templateStore) Versions(method, lang string) ([]templateVersion, error) {
+	key, err := makeTemplateKey(method, lang)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versions := s.versions[key]
+	if len(versions) == 0 {
+		return nil, errTemplateNotFound
+	}
+	return append([]templateVersion(nil), versions...), nil
+}
+
+// Create stores the first version of a template, or fails with
+// errTemplateExists if there's one already that isn't deleted.
+func (s *templateStore) Create(method, lang string, template rawVariants) (storedTemplate, error) {
+	return s.add(method, lang, func(versions []templateVersion) (templateVersion, error) {
+		if len(versions) > 0 && !versions[len(versions)-1].Deleted {
+			return templateVersion{}, errTemplateExists
+		}
+		return templateVersion{Template: template}, nil
+	})
+}
+
+// Put stores a new version of a template, creating it if need be.
+func (s *templateStore) Put(method, lang string, template rawVariants) (storedTemplate, error) {
+	return s.add(method, lang, func([]templateVersion) (templateVersion, error) {
+		return templateVersion{Template: template}, nil
+	})
+}
+
+// Delete stores a version of a template that deletes it, or fails with
+// errTemplateNotFound if it's already deleted.
+func (s *templateStore) Delete(method, lang string) (storedTemplate, error) {
+	return s.add(method, lang, func(versions []templateVersion) (templateVersion, error) {
+		if len(versions) == 0 || versions[len(versions)-1].Deleted {
+			return templateVersion{}, errTemplateNotFound
+		}
+		return templateVersion{Deleted: true}, nil
+	})
+}
+
+// Rollback stores a new version of a template that's a copy of an old one.
+// Rolling back to a version that deleted the template deletes it again.
+func (s *templateStore) Rollback(method, lang string, version int) (storedTemplate, error) {
+	return s.add(method, lang, func(versions []templateVersion) (templateVersion, error) {
+		if len(versions) == 0 {
+			return templateVersion{}, errTemplateNotFound
+		}
+		if version < 1 || version > len(versions) {
+			return templateVersion{}, errTemplateVersionNotFound
+		}
+		old := versions[version-1]
+		return templateVersion{Template: old.Template, Deleted: old.Deleted}, nil
+	})
+}
+
+// add appends the version next makes out of a template's versions so far,
+// and puts it live. A template that doesn't parse is a validationError, and
+// leaves things as they were.
+func (s *templateStore) add(method, lang string, next func([]templateVersion) (templateVersion, error)) (storedTemplate, error) {
+	key, err := makeTemplateKey(method, lang)
+	if err != nil {
+		return storedTemplate{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versions := s.versions[key]
+	v, err := next(versions)
+	if err != nil {
+		return storedTemplate{}, err
+	}
+	if !v.Deleted {
+		if _, err := parseGreetTemplates(map[string]map[string]rawVariants{key.method: {key.lang: v.Template}}); err != nil {
+			return storedTemplate{}, validationError{"template", "invalid_template", err.Error()}
+		}
+	}
+	v.Version = len(versions) + 1
+	v.Created = time.Now()
+	s.versions[key] = append(versions, v)
+	if err := s.update(); err != nil {
+		s.versions[key] = versions
+		return storedTemplate{}, err
+	}
+	return storedTemplate{key.method, key.lang, v}, nil
+}
+
+// update parses the latest version of every template that isn't deleted,
+// and puts them live. It's called with mu held.
+func (s *templateStore) update() error {
+	raw := map[string]map[string]rawVariants{}
+	for key, versions := range s.versions {
+		v := versions[len(versions)-1]
+		if v.Deleted {
+			continue
+		}
+		if raw[key.method] == nil {
+			raw[key.method] = map[string]rawVariants{}
+		}
+		raw[key.method][key.lang] = v.Template
+	}
+	templates, err := parseGreetTemplates(raw)
+	if err != nil {
+		return err
+	}
+	s.live.Store(templates)
+	atomic.AddUint64(&s.changes, 1)
+	return nil
+}
+
+// TemplateVersion changes whenever any of the templates do.
+func (s *templateStore) TemplateVersion() uint64 {
+	return atomic.LoadUint64(&s.changes)
+}
+
+// previewTemplate renders each of a template's variants for data, without
+// storing anything.
+func previewTemplate(method, lang string, template rawVariants, data templateData) ([]string, error) {
+	key, err := makeTemplateKey(method, lang)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseGreetTemplates(map[string]map[string]rawVariants{key.method: {key.lang: template}})
+	if err != nil {
+		return nil, validationError{"template", "invalid_template", err.Error()}
+	}
+	previews := []string{}
+	for _, variants := range parsed[key.method] {
+		for _, v := range variants.variants {
+			var buf bytes.Buffer
+			if err := v.tmpl.Execute(&buf, data); err != nil {
+				return nil, validationError{"template", "invalid_template", err.Error()}
+			}
+			previews = append(previews, buf.String())
+		}
+	}
+	return previews, nil
+}
+
+// checkTemplates checks that raw, as it's written in a templates file, can
+// be stored.
+func checkTemplates(raw map[string]map[string]rawVariants) error {
+	for method, byLang := range raw {
+		for lang := range byLang {
+			if _, err := makeTemplateKey(method, lang); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := parseGreetTemplates(raw)
+	return err
+}
+
+// putChanged stores a new version of each of raw's templates, as they're
+// written in a templates file, that's changed since last, the same file as
+// it was before, and isn't already the latest version. It returns the
+// templates it stored, as template method/lang.
+func (s *templateStore) putChanged(raw, last map[string]map[string]rawVariants) ([]string, error) {
+	var changed []string
+	for method, byLang := range raw {
+		for lang, variants := range byLang {
+			if was, ok := last[method][lang]; ok && reflect.DeepEqual(was, variants) {
+				continue
+			}
+			if stored, err := s.Get(method, lang); err == nil && reflect.DeepEqual(stored.Template, variants) {
+				continue
+			}
+			if _, err := s.Put(method, lang, variants); err != nil {
+				return changed, fmt.Errorf("%s %s: %v", method, lang, err)
+			}
+			changed = append(changed, "template "+method+"/"+lang)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// templatesFile is the -greet.templates file the store started with, which
+// is read again on a SIGHUP, see reload.go.
+type templatesFile struct {
+	path  string
+	store *templateStore
+
+	mu   sync.Mutex
+	last map[string]map[string]rawVariants
+}
+
+// newTemplatesFile returns the templatesFile at path that store started
+// with.
+func newTemplatesFile(path string, store *templateStore) (*templatesFile, error) {
+	raw, err := readGreetTemplates(path)
+	if err != nil {
+		return nil, err
+	}
+	return &templatesFile{path: path, store: store, last: raw}, nil
+}
+
+// prepareReload implements reloadable.
+func (f *templatesFile) prepareReload() (func() ([]string, error), error) {
+	raw, err := readGreetTemplates(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("-greet.templates: %v", err)
+	}
+	if err := checkTemplates(raw); err != nil {
+		return nil, fmt.Errorf("-greet.templates: %v", err)
+	}
+	return func() ([]string, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		changed, err := f.store.putChanged(raw, f.last)
+		if err != nil {
+			return changed, fmt.Errorf("-greet.templates: %v", err)
+		}
+		f.last = raw
+		return changed, nil
+	}, nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sync"
+	"text/template"
+
+	"golang.org/x/text/language"
+)
+
+// The template provider, the default, lets operators replace the built in
+// phrasing with text/templates, read from a JSON file given by
+// -greet.templates. The file maps each method to templates
+// by language:
+//
+//	{
+//		"hello": {"en": "Good {{.TimeOfDay}}, {{.Name}}", "fr": "Bonjour, {{.Name}}"},
+//		"goodbye": {"en": "See you later, {{.Name}}"}
+//	}
+//
+// Languages without a template keep using the catalog in i18n.go, so
+// replacing the English phrasing doesn't turn every other language English.
+// Casual and formal greetings have templates of their own, under the method
+// name and the formality, e.g. "hello.formal"; "hello" is only the neutral one.
+//
+// A language can have a list of variants instead of a single template, and
+// each greeting picks one of them at random, in proportion to their weights:
+//
+//	{"hello": {"en": [{"text": "Hi, {{.Name}}", "weight": 3}, {"text": "Hey, {{.Name}}"}]}}
+//
+// A variant without a weight has a weight of 1. A bad template stops the
+// service at startup rather than failing on first use. Templates can be
+// changed after that under /admin/templates; see template_store.go.
+
+func init() {
+	registerGreetingProvider("template", func(config providerConfig) (GreetingProvider, error) {
+		var templates templateSource = greetTemplates(nil)
+		if config.Templates != nil {
+			templates = config.Templates
+		}
+		return templateProvider{templates, newPicker(config.Seed), catalogProvider{}}, nil
+	})
+}
+
+// templateProvider is a GreetingProvider that uses templates where it has
+// them, and fallback where it doesn't. picker chooses between variants.
+type templateProvider struct {
+	templates templateSource
+	picker    Picker
+	fallback  GreetingProvider
+}
+
+func (p templateProvider) Phrase(r PhraseRequest) (Greeting, error) {
+	text, ok, err := p.templates.current().render(r.Method, r.Language, templateData{r.Name, r.TimeOfDay}, p.picker)
+	if !ok {
+		return p.fallback.Phrase(r)
+	}
+	return Greeting{Text: text, Language: r.Language}, err
+}
+
+// greetTemplates holds parsed templates, by method name and language.
+type greetTemplates map[string]map[language.Tag]templateVariants
+
+// templateVariants are the templates to pick from for one method and
+// language. total is the sum of their weights.
+type templateVariants struct {
+	variants []templateVariant
+	total    int
+}
+
+type templateVariant struct {
+	tmpl   *template.Template
+	weight int
+}
+
+// rawVariant is a variant as it's written in the templates file.
+type rawVariant struct {
+	Text   string `json:"text"`
+	Weight int    `json:"weight,omitempty"`
+}
+
+// rawVariants is either a single template or a list of variants.
+type rawVariants []rawVariant
+
+func (v *rawVariants) UnmarshalJSON(b []byte) error {
+	var text string
+	if err := json.Unmarshal(b, &text); err == nil {
+		*v = rawVariants{{Text: text}}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]rawVariant)(v))
+}
+
+// templateData is what a greeting template gets to work with.
+type templateData struct {
+	Name      string
+	TimeOfDay string
+}
+
+// readGreetTemplates reads the templates in the file at path, unparsed.
+func readGreetTemplates(path string) (map[string]map[string]rawVariants, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var raw map[string]map[string]rawVariants
+	if err := json.NewDecoder(f).Decode(&raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// parseGreetTemplates parses templates as they're written in a templates
+// file, by method and then language.
+func parseGreetTemplates(raw map[string]map[string]rawVariants) (greetTemplates, error) {
+	templates := greetTemplates{}
+	for method, byLang := range raw {
+		templates[method] = map[language.Tag]templateVariants{}
+		for lang, variants := range byLang {
+			tag, err := language.Parse(lang)
+			if err != nil {
+				return nil, err
+			}
+			if len(variants) == 0 {
+				return nil, errors.New(method + "." + lang + ": no templates")
+			}
+			var parsed templateVariants
+			for _, v := range variants {
+				switch {
+				case v.Weight < 0:
+					return nil, errors.New(method + "." + lang + ": negative weight")
+				case v.Weight == 0:
+					v.Weight = 1
+				}
+				t, err := template.New(method + "." + lang).Parse(v.Text)
+				if err != nil {
+					return nil, err
+				}
+				// Fields that don't exist only show up when executing.
+				if err := t.Execute(ioutil.Discard, templateData{}); err != nil {
+					return nil, err
+				}
+				parsed.variants = append(parsed.variants, templateVariant{t, v.Weight})
+				parsed.total += v.Weight
+			}
+			templates[method][tag] = parsed
+		}
+	}
+	return templates, nil
+}
+
+// render executes a template for method in lang, picked by p. ok is false if
+// there's no such template.
+func (t greetTemplates) render(method string, lang language.Tag, data templateData, p Picker) (greeting string, ok bool, err error) {
+	variants, ok := t[method][lang]
+	if !ok {
+		return "", false, nil
+	}
+	var buf bytes.Buffer
+	if err := variants.pick(p).Execute(&buf, data); err != nil {
+		return "", true, err
+	}
+	return buf.String(), true, nil
+}
+
+// pick picks one of the variants, or the first if there's no Picker.
+func (v templateVariants) pick(p Picker) *template.Template {
+	if len(v.variants) == 1 || p == nil {
+		return v.variants[0].tmpl
+	}
+	n := p.Intn(v.total)
+	for _, variant := range v.variants {
+		if n < variant.weight {
+			return variant.tmpl
+		}
+		n -= variant.weight
+	}
+	return v.variants[len(v.variants)-1].tmpl
+}
+
+// A Picker picks a number in [0, n), to choose between greeting variants.
+// *rand.Rand is one, and tests can use one that always picks the same.
+type Picker interface {
+	Intn(n int) int
+}
+
+// lockedPicker is a Picker that's safe to share between goroutines, which a
+// *rand.Rand isn't.
+type lockedPicker struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// newPicker returns a Picker seeded with seed, so the same seed picks the
+// same variants in the same order.
+func newPicker(seed int64) *lockedPicker {
+	return &lockedPicker{r: rand.New(rand.NewSource(seed))}
+}
+
+func (p *lockedPicker) Intn(n int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.r.Intn(n)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+// fixedPicker is a Picker that always picks the same.
+type fixedPicker int
+
+func (p fixedPicker) Intn(int) int { return int(p) }
+
+func mustParseTemplates(t *testing.T, raw map[string]map[string]rawVariants) greetTemplates {
+	templates, err := parseGreetTemplates(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return templates
+}
+
+var weightedTemplates = map[string]map[string]rawVariants{
+	"hello": {"en": {
+		{Text: "Hi, {{.Name}}", Weight: 3},
+		{Text: "Hey, {{.Name}}"},
+		{Text: "Yo, {{.Name}}", Weight: 6},
+	}},
+}
+
+func TestPickWeights(t *testing.T) {
+	templates := mustParseTemplates(t, weightedTemplates)
+	for _, tc := range []struct {
+		n    int
+		want string
+	}{
+		{0, "Hi, Ada"},
+		{2, "Hi, Ada"},
+		{3, "Hey, Ada"},
+		{4, "Yo, Ada"},
+		{9, "Yo, Ada"},
+	} {
+		got, ok, err := templates.render("hello", language.English, templateData{Name: "Ada"}, fixedPicker(tc.n))
+		if !ok || err != nil {
+			t.Fatalf("pick %d: ok %v, err %v", tc.n, ok, err)
+		}
+		if got != tc.want {
+			t.Errorf("pick %d: got %q, want %q", tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestPickDistribution(t *testing.T) {
+	const picks = 100000
+	templates := mustParseTemplates(t, weightedTemplates)
+	picker := newPicker(1)
+	counts := map[string]int{}
+	for i := 0; i < picks; i++ {
+		got, _, err := templates.render("hello", language.English, templateData{Name: "Ada"}, picker)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[got]++
+	}
+	for greeting, share := range map[string]float64{"Hi, Ada": 0.3, "Hey, Ada": 0.1, "Yo, Ada": 0.6} {
+		if got := float64(counts[greeting]) / picks; math.Abs(got-share) > 0.01 {
+			t.Errorf("%q picked %.3f of the time, want %.1f", greeting, got, share)
+		}
+	}
+}
+
+func TestPickerSeed(t *testing.T) {
+	templates := mustParseTemplates(t, weightedTemplates)
+	a, b := newPicker(42), newPicker(42)
+	for i := 0; i < 100; i++ {
+		x, _, _ := templates.render("hello", language.English, templateData{Name: "Ada"}, a)
+		y, _, _ := templates.render("hello", language.English, templateData{Name: "Ada"}, b)
+		if x != y {
+			t.Fatalf("pick %d with the same seed: %q and %q", i, x, y)
+		}
+	}
+}
+
+func TestParseGreetTemplates(t *testing.T) {
+	for name, tc := range map[string]struct {
+		raw map[string]map[string]rawVariants
+		ok  bool
+	}{
+		"single":          {map[string]map[string]rawVariants{"hello": {"en": {{Text: "Hi, {{.Name}}"}}}}, true},
+		"no variants":     {map[string]map[string]rawVariants{"hello": {"en": {}}}, false},
+		"negative weight": {map[string]map[string]rawVariants{"hello": {"en": {{Text: "Hi", Weight: -1}}}}, false},
+		"bad language":    {map[string]map[string]rawVariants{"hello": {"not a language": {{Text: "Hi"}}}}, false},
+		"bad template":    {map[string]map[string]rawVariants{"hello": {"en": {{Text: "Hi, {{.Name"}}}}, false},
+		"unknown field":   {map[string]map[string]rawVariants{"hello": {"en": {{Text: "Hi, {{.Nickname}}"}}}}, false},
+	} {
+		_, err := parseGreetTemplates(tc.raw)
+		if ok := err == nil; ok != tc.ok {
+			t.Errorf("%s: err %v", name, err)
+		}
+	}
+}
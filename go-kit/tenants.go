@@ -0,0 +1,310 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	stdjwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/net/context"
+	"golang.org/x/text/language"
+	"golang.org/x/time/rate"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+)
+
+// The service can be shared between tenants, each with its own templates,
+// default locale and rate limit, managed under /tenants. A request belongs to
+// the tenant its credentials are for: one of the tenant's API keys in an
+// X-API-Key header, an API key or client certificate that's for the tenant
+// (see apikeys.go and mtls.go), or a token whose tenant claim names it. An
+// X-Tenant-ID header only says which tenant the client expects to be, and a
+// request whose credentials aren't for that tenant is answered 403. Requests
+// that don't belong to a tenant are served as before.
+
+// tenant is one tenant's configuration. Templates are written the way they
+// are in a templates file (see templates.go) and take precedence over the
+// service's own. Locale is the language for requests that don't ask for one,
+// and RateLimit, if set, is how many greetings a second the tenant gets.
+type tenant struct {
+	ID        string                            `json:"id"`
+	APIKeys   []string                          `json:"api_keys,omitempty"`
+	Locale    string                            `json:"locale,omitempty"`
+	RateLimit float64                           `json:"rate_limit,omitempty"`
+	Templates map[string]map[string]rawVariants `json:"templates,omitempty"`
+
+	// templates are Templates, parsed by checkTenant.
+	templates greetTemplates
+}
+
+var (
+	errTenantNotFound    = errors.New("tenant not found")
+	errTenantExists      = errors.New("tenant already exists")
+	errTenantRateLimited = errors.New("tenant rate limit exceeded")
+	errTenantMismatch    = errors.New("X-Tenant-ID isn't the tenant the credentials are for")
+)
+
+// TenantStore keeps tenants by ID, and by API key.
+type TenantStore interface {
+	// Create stores a new tenant, or fails with errTenantExists.
+	Create(t tenant) error
+
+	// Get returns the tenant with the ID, or errTenantNotFound.
+	Get(id string) (tenant, error)
+
+	// ByAPIKey returns the tenant with the API key, or errTenantNotFound.
+	ByAPIKey(key string) (tenant, error)
+
+	// Put stores t, replacing any tenant it had before.
+	Put(t tenant) error
+
+	// Delete removes the tenant with the ID, or fails with errTenantNotFound.
+	Delete(id string) error
+}
+
+// memTenantStore is a TenantStore that keeps everything in memory.
+type memTenantStore struct {
+	mu      sync.RWMutex
+	tenants map[string]tenant
+	keys    map[string]string
+
+	// changes counts the times tenants have been stored or removed.
+	changes uint64
+}
+
+func newMemTenantStore() *memTenantStore {
+	return &memTenantStore{tenants: map[string]tenant{}, keys: map[string]string{}}
+}
+
+func (s *memTenantStore) Create(t tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[t.ID]; ok {
+		return errTenantExists
+	}
+	return s.put(t)
+}
+
+func (s *memTenantStore) Get(id string) (tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tenants[id]
+	if !ok {
+		return tenant{}, errTenantNotFound
+	}
+	return t, nil
+}
+
+func (s *memTenantStore) ByAPIKey(key string) (tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tenants[s.keys[key]]
+	if !ok {
+		return tenant{}, errTenantNotFound
+	}
+	return t, nil
+}
+
+func (s *memTenantStore) Put(t tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.put(t)
+}
+
+// put stores t with mu held. An API key can only belong to one tenant.
+func (s *memTenantStore) put(t tenant) error {
+	for _, key := range t.APIKeys {
+		if id, ok := s.keys[key]; ok && id != t.ID {
+			return validationError{"api_keys", "taken", "an API key belongs to another tenant"}
+		}
+	}
+	s.remove(t.ID)
+	s.tenants[t.ID] = t
+	for _, key := range t.APIKeys {
+		s.keys[key] = t.ID
+	}
+	return nil
+}
+
+func (s *memTenantStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[id]; !ok {
+		return errTenantNotFound
+	}
+	s.remove(id)
+	return nil
+}
+
+func (s *memTenantStore) remove(id string) {
+	for _, key := range s.tenants[id].APIKeys {
+		delete(s.keys, key)
+	}
+	delete(s.tenants, id)
+	atomic.AddUint64(&s.changes, 1)
+}
+
+// TemplateVersion changes whenever a tenant, and so maybe its templates,
+// does.
+func (s *memTenantStore) TemplateVersion() uint64 {
+	return atomic.LoadUint64(&s.changes)
+}
+
+// checkTenant returns t with its templates parsed, or a validationError if
+// it's not a tenant we can serve.
+func checkTenant(t tenant) (tenant, error) {
+	if t.ID == "" {
+		return t, validationError{"id", "required", "id is required"}
+	}
+	if t.Locale != "" {
+		if _, err := language.Parse(t.Locale); err != nil {
+			return t, validationError{"locale", "invalid_locale", fmt.Sprintf("%q is not a language tag", t.Locale)}
+		}
+	}
+	if t.RateLimit < 0 {
+		return t, validationError{"rate_limit", "negative", "rate_limit may not be negative"}
+	}
+	templates, err := parseGreetTemplates(t.Templates)
+	if err != nil {
+		return t, validationError{"templates", "invalid_template", err.Error()}
+	}
+	t.templates = templates
+	return t, nil
+}
+
+type tenantContextKey int
+
+const (
+	// tenantKey is the context key for the tenant a request belongs to.
+	tenantKey tenantContextKey = iota
+
+	// tenantIDKey is the context key for the tenant a request's X-Tenant-ID
+	// says it's for.
+	tenantIDKey
+)
+
+// tenantToContext is a kithttp.RequestFunc that puts the tenant the
+// request's X-Tenant-ID names, if it has one, in the context, for
+// authenticateTenant to check.
+func tenantToContext(ctx context.Context, r *http.Request) context.Context {
+	if id := r.Header.Get("X-Tenant-ID"); id != "" {
+		return context.WithValue(ctx, tenantIDKey, id)
+	}
+	return ctx
+}
+
+// authenticateTenant returns an endpoint.Middleware that puts the tenant a
+// call's token claims, if it claims one, in the context, and fails calls
+// whose X-Tenant-ID isn't the tenant their credentials are for with
+// errTenantMismatch. It has to come after the middlewares that check the
+// credentials.
+func authenticateTenant(tenants TenantStore) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			t, _ := ctx.Value(tenantKey).(tenant)
+			claims, _ := ctx.Value(kitjwt.JWTClaimsContextKey).(stdjwt.MapClaims)
+			if id, _ := claims["tenant"].(string); id != "" {
+				if t.ID != "" && t.ID != id {
+					return nil, errTenantMismatch
+				}
+				var err error
+				t, err = tenants.Get(id)
+				if err == errTenantNotFound {
+					err = errUnauthorized{err: errors.New("token's tenant doesn't exist")}
+				}
+				if err != nil {
+					return nil, err
+				}
+				ctx = context.WithValue(ctx, tenantKey, t)
+			}
+			if id, ok := ctx.Value(tenantIDKey).(string); ok && id != t.ID {
+				return nil, errTenantMismatch
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// tenantMiddleware holds tenants to their rate limits, and marks their
+// requests so tenantProvider can use their templates.
+type tenantMiddleware struct {
+	limiters *tenantLimiters
+	next     GreetService
+}
+
+func (mw tenantMiddleware) Hello(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.admit(ctx, s, opts, mw.next.Hello)
+}
+
+func (mw tenantMiddleware) Goodbye(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.admit(ctx, s, opts, mw.next.Goodbye)
+}
+
+func (mw tenantMiddleware) admit(ctx context.Context, s string, opts GreetOptions, call greetMethod) (Greeting, error) {
+	t, ok := ctx.Value(tenantKey).(tenant)
+	if !ok {
+		return call(ctx, s, opts)
+	}
+	if !mw.limiters.allow(t) {
+		return Greeting{}, errTenantRateLimited
+	}
+	opts.Tenant = t.ID
+	return call(ctx, s, opts)
+}
+
+// tenantLimiters keeps a rate limiter for each tenant that has a rate limit.
+type tenantLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newTenantLimiters() *tenantLimiters {
+	return &tenantLimiters{limiters: map[string]*rate.Limiter{}}
+}
+
+// forget drops the limiter of the tenant with the ID, when it's deleted.
+func (l *tenantLimiters) forget(id string) {
+	l.mu.Lock()
+	delete(l.limiters, id)
+	l.mu.Unlock()
+}
+
+// allow says whether t can have another greeting now. A tenant whose limit
+// has changed gets a new limiter.
+func (l *tenantLimiters) allow(t tenant) bool {
+	if t.RateLimit == 0 {
+		return true
+	}
+	l.mu.Lock()
+	limiter, ok := l.limiters[t.ID]
+	if !ok || limiter.Limit() != rate.Limit(t.RateLimit) {
+		burst := int(t.RateLimit)
+		if burst < 1 {
+			burst = 1
+		}
+		limiter = rate.NewLimiter(rate.Limit(t.RateLimit), burst)
+		l.limiters[t.ID] = limiter
+	}
+	l.mu.Unlock()
+	return limiter.Allow()
+}
+
+// tenantProvider is a GreetingProvider that uses the tenant's templates for
+// the tenant's requests, and fallback for everything else.
+type tenantProvider struct {
+	tenants  TenantStore
+	picker   Picker
+	fallback GreetingProvider
+}
+
+func (p tenantProvider) Phrase(r PhraseRequest) (Greeting, error) {
+	if r.Tenant != "" {
+		if t, err := p.tenants.Get(r.Tenant); err == nil {
+			return templateProvider{t.templates, p.picker, p.fallback}.Phrase(r)
+		}
+	}
+	return p.fallback.Phrase(r)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	stdjwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/net/context"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+)
+
+func TestAuthenticateTenant(t *testing.T) {
+	tenants := newMemTenantStore()
+	for _, id := range []string{"acme", "initech"} {
+		if err := tenants.Put(tenant{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	acme, _ := tenants.Get("acme")
+
+	withKeyFor := func(ctx context.Context, t tenant) context.Context {
+		return context.WithValue(ctx, tenantKey, t)
+	}
+	withClaim := func(ctx context.Context, id string) context.Context {
+		return context.WithValue(ctx, kitjwt.JWTClaimsContextKey, stdjwt.MapClaims{"tenant": id})
+	}
+	asking := func(id string) context.Context {
+		return context.WithValue(context.Background(), tenantIDKey, id)
+	}
+	for name, tc := range map[string]struct {
+		ctx    context.Context
+		tenant string
+		err    error
+	}{
+		"nobody":                  {context.Background(), "", nil},
+		"key":                     {withKeyFor(context.Background(), acme), "acme", nil},
+		"key, asking for it":      {withKeyFor(asking("acme"), acme), "acme", nil},
+		"key, asking for another": {withKeyFor(asking("initech"), acme), "", errTenantMismatch},
+		"asking, unauthenticated": {asking("acme"), "", errTenantMismatch},
+		"claim":                   {withClaim(context.Background(), "acme"), "acme", nil},
+		"claim, asking for it":    {withClaim(asking("acme"), "acme"), "acme", nil},
+		"claim, asking another":   {withClaim(asking("initech"), "acme"), "", errTenantMismatch},
+		"claim and another key":   {withClaim(withKeyFor(context.Background(), acme), "initech"), "", errTenantMismatch},
+		"claim of no tenant":      {withClaim(context.Background(), "globex"), "", errUnauthorized{}},
+	} {
+		var got string
+		_, err := authenticateTenant(tenants)(func(ctx context.Context, _ interface{}) (interface{}, error) {
+			t, _ := ctx.Value(tenantKey).(tenant)
+			got = t.ID
+			return nil, nil
+		})(tc.ctx, nil)
+		if _, ok := tc.err.(errUnauthorized); ok {
+			if _, ok := err.(errUnauthorized); !ok {
+				t.Errorf("%s: got %v, want an errUnauthorized", name, err)
+			}
+			continue
+		}
+		if err != tc.err {
+			t.Errorf("%s: got %v, want %v", name, err, tc.err)
+			continue
+		}
+		if got != tc.tenant {
+			t.Errorf("%s: tenant %q, want %q", name, got, tc.tenant)
+		}
+	}
+}
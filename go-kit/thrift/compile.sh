@@ -0,0 +1,5 @@
+#!/usr/bin/env sh
+
+# See also https://thrift.apache.org/tutorial/go
+
+thrift -r --gen "go:package_prefix=github.com/naunga/monolith/go-kit/thrift/gen-go/,thrift_import=github.com/apache/thrift/lib/go/thrift" greet.thrift
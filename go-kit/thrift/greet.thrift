@@ -0,0 +1,8 @@
+struct HelloReply {
+	1: string greeting
+	2: string err
+}
+
+service GreetService {
+	HelloReply Hello(1: string name)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// -timeout is how long the HTTP greeting endpoints get to answer, and
+// -timeouts sets it for some of them, as comma separated name=duration pairs
+// of hello, goodbye, card and batch, e.g. batch=10s. An endpoint that takes
+// longer is answered 504 Gateway Timeout, without waiting for it to finish,
+// and its context is cancelled, so whatever it's waiting on can give up too.
+// Timeouts count as failures for the circuit breakers.
+
+// timeoutEndpoints are the endpoints -timeouts can name.
+var timeoutEndpoints = []string{"hello", "goodbye", "card", "batch"}
+
+// errTimeout is the error of a call that took longer than it had.
+type errTimeout struct {
+	after time.Duration
+}
+
+func (e errTimeout) Error() string { return fmt.Sprintf("timed out after %s", e.after) }
+
+// timeouts are the endpoints' timeouts. 0 is none.
+type timeouts struct {
+	all        time.Duration
+	byEndpoint map[string]time.Duration
+}
+
+// parseTimeouts parses -timeouts, on top of all.
+func parseTimeouts(all time.Duration, s string) (timeouts, error) {
+	t := timeouts{all, map[string]time.Duration{}}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i < 0 {
+			return timeouts{}, fmt.Errorf("timeout %q isn't a name=duration pair", pair)
+		}
+		name := pair[:i]
+		known := false
+		for _, e := range timeoutEndpoints {
+			known = known || e == name
+		}
+		if !known {
+			return timeouts{}, fmt.Errorf("unknown endpoint %q, want one of %s", name, strings.Join(timeoutEndpoints, ", "))
+		}
+		d, err := time.ParseDuration(pair[i+1:])
+		if err != nil || d < 0 {
+			return timeouts{}, fmt.Errorf("bad timeout for %s: %q", name, pair[i+1:])
+		}
+		t.byEndpoint[name] = d
+	}
+	return t, nil
+}
+
+// endpoint returns the timeoutEndpoint middleware for the named endpoint.
+func (t timeouts) endpoint(name string) endpoint.Middleware {
+	if d, ok := t.byEndpoint[name]; ok {
+		return timeoutEndpoint(d)
+	}
+	return timeoutEndpoint(t.all)
+}
+
+// timeoutEndpoint returns an endpoint.Middleware that gives calls d to
+// answer, failing them with errTimeout after that. A d of 0 lets calls take as
+// long as they like.
+func timeoutEndpoint(d time.Duration) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		if d <= 0 {
+			return next
+		}
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			type result struct {
+				response interface{}
+				err      error
+				panic    interface{}
+			}
+			done := make(chan result, 1)
+			go func() {
+				// A panic belongs to the request, not the whole process.
+				defer func() {
+					if v := recover(); v != nil {
+						done <- result{panic: v}
+					}
+				}()
+				response, err := next(ctx, request)
+				done <- result{response: response, err: err}
+			}()
+			select {
+			case r := <-done:
+				if r.panic != nil {
+					panic(r.panic)
+				}
+				return r.response, r.err
+			case <-ctx.Done():
+				if ctx.Err() == context.DeadlineExceeded {
+					return nil, errTimeout{d}
+				}
+				return nil, ctx.Err()
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	log "github.com/go-kit/kit/log"
+)
+
+// The HTTPS listener's certificate and key are read from -tls.cert and
+// -tls.key again whenever either file changes, checked every -tls.reload,
+// and when the process gets a SIGHUP, see reload.go, so that a certificate can be rotated
+// without a restart. Connections already made keep the certificate they were
+// made with. A pair that can't be read, or doesn't match, is logged, and the
+// old certificate is served until it's fixed.
+//
+// -tls.min.version is the least TLS version connections can use, 1.0 to 1.3,
+// and -tls.ciphers, if it's set, the cipher suites TLS 1.2 and below can,
+// by their Go names, like TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. TLS 1.3's
+// suites can't be chosen.
+
+// certReloader serves a certificate and key from a pair of files, reading
+// them again when they change. It's safe for concurrent use.
+type certReloader struct {
+	certFile, keyFile string
+	logger            log.Logger
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+// newCertReloader returns a certReloader for the files, which has to be able
+// to read them now.
+func newCertReloader(certFile, keyFile string, logger log.Logger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if _, err := r.reload(true); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate is a tls.Config's GetCertificate, serving the certificate
+// last read.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// reload reads the files again if either has changed since they were last
+// read, or if force is set, and reports whether it did.
+func (r *certReloader) reload(force bool) (bool, error) {
+	var modTimes [2]time.Time
+	for i, path := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return false, err
+		}
+		modTimes[i] = fi.ModTime()
+	}
+	r.mu.RLock()
+	unchanged := modTimes == r.modTimes
+	r.mu.RUnlock()
+	if unchanged && !force {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.modTimes = &cert, modTimes
+	return true, nil
+}
+
+// prepareReload implements reloadable, reading the files whether or not
+// they've changed.
+func (r *certReloader) prepareReload() (func() ([]string, error), error) {
+	var modTimes [2]time.Time
+	for i, path := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("TLS certificate: %v", err)
+		}
+		modTimes[i] = fi.ModTime()
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("TLS certificate: %v", err)
+	}
+	return func() ([]string, error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		same := reflect.DeepEqual(cert.Certificate, r.cert.Certificate)
+		r.cert, r.modTimes = &cert, modTimes
+		if same {
+			return nil, nil
+		}
+		return []string{"TLS certificate"}, nil
+	}, nil
+}
+
+// watch reloads the files every interval, if they've changed, until ctx is
+// done.
+func (r *certReloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reloaded, err := r.reload(false)
+		if err != nil {
+			r.logger.Log("msg", "TLS certificate not reloaded", "cert", r.certFile, "err", err)
+			continue
+		}
+		if reloaded {
+			r.logger.Log("msg", "TLS certificate reloaded", "cert", r.certFile)
+		}
+	}
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion parses a TLS version, like 1.2.
+func parseTLSVersion(s string) (uint16, error) {
+	if v, ok := tlsVersions[s]; ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("invalid TLS version %q, want 1.0, 1.1, 1.2 or 1.3", s)
+}
+
+// parseCipherSuites parses a comma separated list of cipher suites, by
+// their Go names. Only the suites Go considers secure are allowed. An empty
+// list is nil, for Go's defaults.
+func parseCipherSuites(s string) ([]uint16, error) {
+	names := splitList(s)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Requests to the HTTP transport are traced with OpenTelemetry. Every request
+// gets a server span, carrying on the trace in its W3C traceparent header if
+// it has one, and the endpoints behind /hello and /goodbye get spans of their
+// own inside it. With -otel.endpoint set, spans are sent to an OTLP collector,
+// e.g. -otel.endpoint http://localhost:4318/v1/traces, and with -zipkin.url set
+// they're sent to Zipkin as well, or instead; see zipkin.go.
+//
+// -trace.propagation picks the headers a trace is carried on in: W3C
+// traceparent and baggage by default, or, for services still on Zipkin, B3,
+// either as the single b3 header or the older X-B3-* headers.
+//
+// The OTLP exporters that come with OpenTelemetry need a newer gRPC than
+// go-kit's gRPC transport builds with, so spans are sent as OTLP JSON over
+// HTTP instead, which collectors take on the same port as protobuf.
+
+// newTracerProvider returns a TracerProvider for the service called service,
+// exporting to the OTLP collector at otlpURL and the Zipkin collector at
+// zipkinURL, skipping either if it's empty. Spans are created either way, so
+// traces still carry on through the service.
+func newTracerProvider(otlpURL, zipkinURL, service string) *sdktrace.TracerProvider {
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	if otlpURL != "" {
+		opts = append(opts, sdktrace.WithBatcher(otlpExporter{otlpURL, client}))
+	}
+	if zipkinURL != "" {
+		opts = append(opts, sdktrace.WithBatcher(zipkinExporter{zipkinURL, client}))
+	}
+	return sdktrace.NewTracerProvider(opts...)
+}
+
+// tracePropagators are the -trace.propagation choices.
+var tracePropagators = map[string]propagation.TextMapPropagator{
+	"tracecontext": propagation.TraceContext{},
+	"baggage":      propagation.Baggage{},
+	"b3":           b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)),
+	"b3multi":      b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)),
+}
+
+// newTracePropagator returns a propagator for the comma separated names, or
+// an error if one of them isn't in tracePropagators.
+func newTracePropagator(names string) (propagation.TextMapPropagator, error) {
+	var props []propagation.TextMapPropagator
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		p, ok := tracePropagators[name]
+		if !ok {
+			var known []string
+			for name := range tracePropagators {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown trace propagation %q, want some of %s", name, strings.Join(known, ", "))
+		}
+		props = append(props, p)
+	}
+	return propagation.NewCompositeTextMapPropagator(props...), nil
+}
+
+// traceToContext is a kithttp.RequestFunc that carries the request's span
+// over into the context endpoints get, which isn't the request's own.
+func traceToContext(ctx context.Context, r *http.Request) context.Context {
+	return trace.ContextWithSpan(ctx, trace.SpanFromContext(r.Context()))
+}
+
+// traceEndpoint returns an endpoint.Middleware that puts each call in a span
+// called name.
+func traceEndpoint(tracer trace.Tracer, name string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			ctx, span := tracer.Start(ctx, name)
+			defer span.End()
+			response, err := next(ctx, request)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return response, err
+		}
+	}
+}
+
+// otlpExporter is a sdktrace.SpanExporter that POSTs spans to an OTLP
+// collector as JSON.
+type otlpExporter struct {
+	url    string
+	client *http.Client
+}
+
+func (e otlpExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	return postSpans(ctx, e.client, e.url, "OTLP", newOTLPTraces(spans))
+}
+
+func (e otlpExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// These are the parts of the OTLP JSON encoding the exporter uses. IDs are
+// hex, and 64 bit numbers are strings.
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+// otlpStatus codes are 0 for unset, 1 for ok and 2 for an error.
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// newOTLPTraces groups spans by the scope that made them. Every span comes
+// from the same TracerProvider, so they share a resource.
+func newOTLPTraces(spans []sdktrace.ReadOnlySpan) otlpTraces {
+	var scopes []otlpScopeSpans
+	index := map[string]int{}
+	for _, s := range spans {
+		scope := s.InstrumentationScope()
+		i, ok := index[scope.Name+" "+scope.Version]
+		if !ok {
+			i = len(scopes)
+			index[scope.Name+" "+scope.Version] = i
+			scopes = append(scopes, otlpScopeSpans{Scope: otlpScope{scope.Name, scope.Version}})
+		}
+		scopes[i].Spans = append(scopes[i].Spans, newOTLPSpan(s))
+	}
+	return otlpTraces{[]otlpResourceSpans{{
+		Resource:   otlpResource{otlpAttributes(spans[0].Resource().Attributes())},
+		ScopeSpans: scopes,
+	}}}
+}
+
+func newOTLPSpan(s sdktrace.ReadOnlySpan) otlpSpan {
+	span := otlpSpan{
+		TraceID:           s.SpanContext().TraceID().String(),
+		SpanID:            s.SpanContext().SpanID().String(),
+		Name:              s.Name(),
+		Kind:              int(s.SpanKind()),
+		StartTimeUnixNano: otlpTime(s.StartTime()),
+		EndTimeUnixNano:   otlpTime(s.EndTime()),
+		Attributes:        otlpAttributes(s.Attributes()),
+		Status:            otlpStatus{Message: s.Status().Description},
+	}
+	if s.Parent().IsValid() {
+		span.ParentSpanID = s.Parent().SpanID().String()
+	}
+	switch s.Status().Code {
+	case codes.Ok:
+		span.Status.Code = 1
+	case codes.Error:
+		span.Status.Code = 2
+	}
+	for _, e := range s.Events() {
+		span.Events = append(span.Events, otlpEvent{otlpTime(e.Time), e.Name, otlpAttributes(e.Attributes)})
+	}
+	return span
+}
+
+// postSpans POSTs v, as JSON, to the collector called what at url.
+func postSpans(ctx context.Context, client *http.Client, url, what string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mediaTypeJSON)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s collector answered %s", what, resp.Status)
+	}
+	return nil
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func otlpAttributes(attrs []attribute.KeyValue) []otlpKeyValue {
+	var kvs []otlpKeyValue
+	for _, kv := range attrs {
+		var v otlpAnyValue
+		switch kv.Value.Type() {
+		case attribute.BOOL:
+			b := kv.Value.AsBool()
+			v.BoolValue = &b
+		case attribute.INT64:
+			n := strconv.FormatInt(kv.Value.AsInt64(), 10)
+			v.IntValue = &n
+		case attribute.FLOAT64:
+			f := kv.Value.AsFloat64()
+			v.DoubleValue = &f
+		default:
+			s := kv.Value.Emit()
+			v.StringValue = &s
+		}
+		kvs = append(kvs, otlpKeyValue{string(kv.Key), v})
+	}
+	return kvs
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/context"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Some channels, like SMS gateways and old terminals, can only show ASCII. A
+// request that sets transliterate gets the greeting back as it is, and spelled
+// in ASCII as well, so Здравствуйте, Жанна also comes back as Zdravstvuyte,
+// Zhanna. The spelling is done by a pipeline of steps, run in the order given
+// to -transliterate.steps:
+//
+//	cyrillic  Cyrillic letters to Latin ones, roughly as in passports
+//	greek     Greek letters to Latin ones
+//	latin     Latin letters that aren't just a letter and a mark, like ß and æ
+//	ascii     strips marks from letters, and replaces anything else that isn't
+//	          ASCII with a question mark
+//
+// Leaving ascii out of the pipeline leaves anything no step knows as it was.
+
+var (
+	cyrillicMapper = newLetterMapper(cyrillicLetters)
+	greekMapper    = newLetterMapper(greekLetters)
+	latinMapper    = newLetterMapper(latinLetters)
+)
+
+// transliterationSteps are the steps a pipeline can be made of. Some
+// transformers keep state, so each transliteration makes its own.
+var transliterationSteps = map[string]func() transform.Transformer{
+	"cyrillic": func() transform.Transformer { return cyrillicMapper },
+	"greek":    func() transform.Transformer { return greekMapper },
+	"latin":    func() transform.Transformer { return latinMapper },
+	"ascii": func() transform.Transformer {
+		return transform.Chain(
+			norm.NFD,
+			runes.Remove(runes.In(unicode.Mn)),
+			runes.Map(func(r rune) rune {
+				if r > unicode.MaxASCII {
+					return '?'
+				}
+				return r
+			}),
+		)
+	},
+}
+
+// transliterator spells text in another script, by running it through steps.
+type transliterator struct {
+	steps []string
+}
+
+// newTransliterator returns a transliterator for the comma separated steps,
+// or an error if one of them isn't in transliterationSteps.
+func newTransliterator(steps string) (transliterator, error) {
+	var t transliterator
+	for _, step := range strings.Split(steps, ",") {
+		if step = strings.TrimSpace(step); step == "" {
+			continue
+		}
+		if _, ok := transliterationSteps[step]; !ok {
+			var names []string
+			for name := range transliterationSteps {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return t, fmt.Errorf("unknown transliteration step %q, want some of %s", step, strings.Join(names, ", "))
+		}
+		t.steps = append(t.steps, step)
+	}
+	return t, nil
+}
+
+// transliterate returns s run through every step.
+func (t transliterator) transliterate(s string) string {
+	steps := make([]transform.Transformer, len(t.steps))
+	for i, step := range t.steps {
+		steps[i] = transliterationSteps[step]()
+	}
+	out, _, err := transform.String(transform.Chain(steps...), s)
+	if err != nil {
+		return s
+	}
+	return out
+}
+
+// letterMapper is a transform.Transformer that replaces letters with
+// strings. It keeps no state, so it can be shared.
+type letterMapper map[rune]string
+
+// newLetterMapper returns a letterMapper for lower case letters, and their
+// upper case forms, which get the replacement with its first letter upper
+// cased.
+func newLetterMapper(lower map[rune]string) letterMapper {
+	m := letterMapper{}
+	for r, s := range lower {
+		m[r] = s
+		if upper := unicode.ToUpper(r); upper != r {
+			first, size := utf8.DecodeRuneInString(s)
+			if size > 0 {
+				s = string(unicode.ToUpper(first)) + s[size:]
+			}
+			m[upper] = s
+		}
+	}
+	return m
+}
+
+func (m letterMapper) Reset() {}
+
+func (m letterMapper) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		if !atEOF && !utf8.FullRune(src[nSrc:]) {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+		r, size := utf8.DecodeRune(src[nSrc:])
+		out := src[nSrc : nSrc+size]
+		if s, ok := m[r]; ok {
+			out = []byte(s)
+		}
+		if nDst+len(out) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], out)
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
+
+var cyrillicLetters = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g", 'ў': "u", 'ђ': "dj", 'ј': "j",
+	'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz",
+}
+
+var greekLetters = map[rune]string{
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i",
+	'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+	'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+	'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+	'ά': "a", 'έ': "e", 'ή': "i", 'ί': "i", 'ό': "o", 'ύ': "y", 'ώ': "o",
+	'ϊ': "i", 'ϋ': "y", 'ΐ': "i", 'ΰ': "y",
+}
+
+var latinLetters = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d",
+	'ł': "l", 'þ': "th", 'ı': "i", 'ħ': "h", 'ŧ': "t",
+}
+
+// transliteratingMiddleware spells greetings in ASCII as well, for requests
+// that ask for it.
+type transliteratingMiddleware struct {
+	t    transliterator
+	next GreetService
+}
+
+func (mw transliteratingMiddleware) Hello(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.transliterate(ctx, s, opts, mw.next.Hello)
+}
+
+func (mw transliteratingMiddleware) Goodbye(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.transliterate(ctx, s, opts, mw.next.Goodbye)
+}
+
+func (mw transliteratingMiddleware) transliterate(ctx context.Context, s string, opts GreetOptions, call greetMethod) (Greeting, error) {
+	greeting, err := call(ctx, s, opts)
+	if err == nil && opts.Transliterate {
+		greeting.Transliterated = mw.t.transliterate(greeting.Text)
+	}
+	return greeting, err
+}
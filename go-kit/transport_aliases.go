@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// Aliases are managed as JSON:
+//
+//	GET    /aliases         every alias
+//	GET    /aliases/{name}  fetch the alias for a name
+//	PUT    /aliases/{name}  give a name an alias
+//	DELETE /aliases/{name}  take it away again
+//
+// e.g. PUT /aliases/Robert with {"alias": "Bob"}. Names without an alias are
+// a 404.
+
+// makeAliasesHandler returns a handler for /aliases and everything under it.
+// Names and aliases longer than maxLen are refused.
+func makeAliasesHandler(az authz, store AliasStore, maxLen int) http.Handler {
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/aliases").Handler(kithttp.NewServer(
+		az.endpoint("aliases.read", makeListAliasesEndpoint(store)),
+		decodeErrors(decodeListAliasesRequest),
+		makeEncodeAliasResponse(http.StatusOK),
+		az.options()...,
+	))
+	r.Methods("GET").Path("/aliases/{name}").Handler(kithttp.NewServer(
+		az.endpoint("aliases.read", makeGetAliasEndpoint(store, maxLen)),
+		decodeErrors(decodeGetAliasRequest),
+		makeEncodeAliasResponse(http.StatusOK),
+		az.options()...,
+	))
+	r.Methods("PUT").Path("/aliases/{name}").Handler(kithttp.NewServer(
+		az.endpoint("aliases.write", makePutAliasEndpoint(store, maxLen)),
+		decodeErrors(decodePutAliasRequest),
+		makeEncodeAliasResponse(http.StatusOK),
+		az.options()...,
+	))
+	r.Methods("DELETE").Path("/aliases/{name}").Handler(kithttp.NewServer(
+		az.endpoint("aliases.write", makeDeleteAliasEndpoint(store, maxLen)),
+		decodeErrors(decodeDeleteAliasRequest),
+		makeEncodeAliasResponse(http.StatusNoContent),
+		az.options()...,
+	))
+	return r
+}
+
+func decodeListAliasesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return listAliasesRequest{}, nil
+}
+
+func decodeGetAliasRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return getAliasRequest{mux.Vars(r)["name"]}, nil
+}
+
+func decodePutAliasRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var a alias
+	if err := decodeJSON(r.Body, &a); err != nil {
+		return nil, err
+	}
+	return putAliasRequest{mux.Vars(r)["name"], a}, nil
+}
+
+func decodeDeleteAliasRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return deleteAliasRequest{mux.Vars(r)["name"]}, nil
+}
+
+// makeEncodeAliasResponse returns an encoder that answers with code, and the
+// body if there is one, unless the endpoint failed.
+func makeEncodeAliasResponse(code int) kithttp.EncodeResponseFunc {
+	return func(_ context.Context, w http.ResponseWriter, response interface{}) error {
+		resp := response.(aliasResponse)
+		if resp.Err != nil {
+			return writeProblem(w, resp.Err)
+		}
+		if resp.Body == nil {
+			w.WriteHeader(code)
+			return nil
+		}
+		w.Header().Set("Content-Type", mediaTypeJSON)
+		w.WriteHeader(code)
+		return json.NewEncoder(w).Encode(resp.Body)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+// This file provides an AMQP (RabbitMQ) transport. Like the NATS transport,
+// amqpSubscriber follows the shape of kithttp.Server: decode the delivery,
+// invoke the endpoint, encode the response, and publish it to the reply
+// exchange. Each delivery is then acked or nacked depending on how far it got.
+// Like NATS messages, deliveries carry no credentials.
+
+import (
+	"encoding/json"
+
+	"github.com/streadway/amqp"
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+)
+
+// amqpDecodeRequestFunc extracts a user-domain request object from an AMQP
+// delivery.
+type amqpDecodeRequestFunc func(context.Context, *amqp.Delivery) (interface{}, error)
+
+// amqpEncodeResponseFunc encodes the passed response object into the message
+// published to the reply exchange.
+type amqpEncodeResponseFunc func(context.Context, interface{}) (amqp.Publishing, error)
+
+type amqpSubscriber struct {
+	ctx      context.Context
+	e        endpoint.Endpoint
+	dec      amqpDecodeRequestFunc
+	enc      amqpEncodeResponseFunc
+	exchange string
+	logger   log.Logger
+}
+
+// ServeDelivery returns a func that handles a single delivery, publishing any
+// response on the passed channel.
+func (s amqpSubscriber) ServeDelivery(ch *amqp.Channel) func(d *amqp.Delivery) {
+	return func(d *amqp.Delivery) {
+		request, err := s.dec(s.ctx, d)
+		if err != nil {
+			// A message we can't decode won't get any better by redelivering
+			// it, so drop it instead of requeueing.
+			s.logger.Log("err", err)
+			d.Nack(false, false)
+			return
+		}
+
+		response, err := s.e(s.ctx, request)
+		if err != nil {
+			s.logger.Log("err", err)
+			d.Nack(false, true)
+			return
+		}
+
+		if d.ReplyTo != "" {
+			msg, err := s.enc(s.ctx, response)
+			if err != nil {
+				s.logger.Log("err", err)
+				d.Nack(false, false)
+				return
+			}
+			msg.CorrelationId = d.CorrelationId
+
+			if err := ch.Publish(s.exchange, d.ReplyTo, false, false, msg); err != nil {
+				s.logger.Log("err", err)
+				d.Nack(false, true)
+				return
+			}
+		}
+
+		d.Ack(false)
+	}
+}
+
+// AMQP messages carry the same JSON payloads as the HTTP transport.
+
+func decodeAMQPHelloRequest(_ context.Context, d *amqp.Delivery) (interface{}, error) {
+	var request helloRequest
+	if err := json.Unmarshal(d.Body, &request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func encodeAMQPResponse(_ context.Context, response interface{}) (amqp.Publishing, error) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		return amqp.Publishing{}, err
+	}
+	return amqp.Publishing{
+		ContentType: "application/json",
+		Body:        body,
+	}, nil
+}
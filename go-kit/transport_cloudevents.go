@@ -0,0 +1,166 @@
+package main
+
+// This file accepts hello requests as CloudEvents (v1.0, HTTP binding) on
+// /events, so the service can take part in the eventing mesh. Both content
+// modes are supported. In structured mode the whole event is the body:
+// curl -X POST -H "Content-Type: application/cloudevents+json" -d '{"specversion": "1.0", "id": "1", "source": "/me", "type": "com.github.naunga.monolith.hello", "data": {"name": "Aaron"}}' http://localhost:8080/events
+// In binary mode the attributes are ce- headers and the body is the data:
+// curl -X POST -H "ce-specversion: 1.0" -H "ce-id: 1" -H "ce-source: /me" -H "ce-type: com.github.naunga.monolith.hello" -H "Content-Type: application/json" -d '{"name": "Aaron"}' http://localhost:8080/events
+// The greeting comes back as a CloudEvent in the same mode as the request.
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+
+	log "github.com/go-kit/kit/log"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+const (
+	mediaTypeCloudEvents = "application/cloudevents+json"
+
+	ceSpecVersion = "1.0"
+	ceSource      = "/greet"
+
+	// ceHelloType is the event type carrying a hello request, and
+	// ceHelloReplyType the one carrying the greeting back.
+	ceHelloType      = "com.github.naunga.monolith.hello"
+	ceHelloReplyType = "com.github.naunga.monolith.hello.reply"
+)
+
+// cloudEvent is the JSON format of a CloudEvent, used in structured mode.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// validate checks the attributes every event must carry, and that the event
+// is one we know how to answer.
+func (e cloudEvent) validate() error {
+	switch {
+	case e.SpecVersion != ceSpecVersion:
+		return fmt.Errorf("unsupported specversion %q", e.SpecVersion)
+	case e.ID == "":
+		return errors.New("missing event id")
+	case e.Source == "":
+		return errors.New("missing event source")
+	case e.Type != ceHelloType:
+		return fmt.Errorf("unsupported event type %q", e.Type)
+	}
+	return nil
+}
+
+// makeCloudEventsHandler returns the handler for /events. Invalid events are
+// rejected as decode errors, which kithttp answers with a 400.
+func makeCloudEventsHandler(svc GreetService, logger log.Logger) http.Handler {
+	return kithttp.NewServer(
+		makeHelloEndpoint(svc),
+		decodeErrors(decodeCloudEventsHelloRequest),
+		encodeCloudEventsHelloResponse,
+		kithttp.ServerBefore(headersToContext),
+		kithttp.ServerErrorLogger(logger),
+	)
+}
+
+func decodeCloudEventsHelloRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	contentType := r.Header.Get("Content-Type")
+	if mediaType(contentType) != mediaTypeCloudEvents {
+		// Binary mode: the attributes are headers and the body is the data.
+		event := cloudEvent{
+			SpecVersion: r.Header.Get("ce-specversion"),
+			ID:          r.Header.Get("ce-id"),
+			Source:      r.Header.Get("ce-source"),
+			Type:        r.Header.Get("ce-type"),
+		}
+		if err := event.validate(); err != nil {
+			return nil, err
+		}
+		c, ok := httpCodecs.lookup(contentType)
+		if !ok {
+			c = jsonCodec
+		}
+		return c.decode(r.Body)
+	}
+
+	var event cloudEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		return nil, err
+	}
+	if err := event.validate(); err != nil {
+		return nil, err
+	}
+	c, ok := httpCodecs.lookup(event.DataContentType)
+	if !ok {
+		c = jsonCodec
+	}
+	if event.DataBase64 != "" {
+		data, err := base64.StdEncoding.DecodeString(event.DataBase64)
+		if err != nil {
+			return nil, err
+		}
+		return c.decode(bytes.NewReader(data))
+	}
+	if len(event.Data) == 0 {
+		return nil, errors.New("missing event data")
+	}
+	return decodeHelloJSON(bytes.NewReader(event.Data))
+}
+
+func encodeCloudEventsHelloResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	id, err := newRandomID()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(newHelloReply(response.(helloResponse)))
+	if err != nil {
+		return err
+	}
+	event := cloudEvent{
+		SpecVersion:     ceSpecVersion,
+		ID:              id,
+		Source:          ceSource,
+		Type:            ceHelloReplyType,
+		DataContentType: mediaTypeJSON,
+		Time:            time.Now().UTC().Format(time.RFC3339Nano),
+		Data:            data,
+	}
+
+	if contentType, _ := ctx.Value(contentTypeKey).(string); contentType == mediaTypeCloudEvents {
+		w.Header().Set("Content-Type", mediaTypeCloudEvents)
+		return json.NewEncoder(w).Encode(event)
+	}
+
+	h := w.Header()
+	h.Set("ce-specversion", event.SpecVersion)
+	h.Set("ce-id", event.ID)
+	h.Set("ce-source", event.Source)
+	h.Set("ce-type", event.Type)
+	h.Set("ce-time", event.Time)
+	h.Set("Content-Type", event.DataContentType)
+	_, err = w.Write(event.Data)
+	return err
+}
+
+// newRandomID returns an ID no one else will have, as 32 hex digits.
+func newRandomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,148 @@
+package main
+
+// GET /greetings/export streams the whole greeting history, oldest first, as
+// CSV if the Accept header asks for text/csv, and as NDJSON otherwise:
+// curl -H 'Accept: text/csv' 'http://localhost:8080/greetings/export?from=2018-06-01T00:00:00Z'
+//
+// from and to, both RFC 3339 times, limit the export to the greetings from
+// from up to, but not including, to. The history is read a page at a time
+// and sent as it's read, so an export of any size only ever holds one page.
+// Like GET /greetings, it needs the history.read permission; see rbac.go.
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/go-kit/kit/log"
+)
+
+const mediaTypeCSV = "text/csv"
+
+// exportPageSize is how many records are read from the history, and sent,
+// at a time.
+const exportPageSize = 1000
+
+// exportColumns are the CSV columns, in order.
+var exportColumns = []string{"id", "method", "name", "greeting", "err", "time", "transport", "addr", "user_agent", "subject"}
+
+type exportHandler struct {
+	store  HistoryStore
+	logger log.Logger
+}
+
+// ServeHTTP implements http.Handler.
+func (h exportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	format, ok := exportFormat(r.Header.Get("Accept"))
+	if !ok {
+		http.Error(w, "can only export text/csv or application/x-ndjson", http.StatusNotAcceptable)
+		return
+	}
+	q := r.URL.Query()
+	from, err := parseExportTime(q.Get("from"))
+	if err != nil {
+		http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseExportTime(q.Get("to"))
+	if err != nil {
+		http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	liftDeadlines(w)
+	out := bufio.NewWriter(w)
+	var write func(greetingRecord) error
+	switch format {
+	case mediaTypeCSV:
+		cw := csv.NewWriter(out)
+		write = func(rec greetingRecord) error {
+			cw.Write(exportRow(rec))
+			cw.Flush()
+			return cw.Error()
+		}
+		cw.Write(exportColumns)
+		w.Header().Set("Content-Disposition", `attachment; filename="greetings.csv"`)
+	default:
+		enc := json.NewEncoder(out)
+		write = func(rec greetingRecord) error { return enc.Encode(rec) }
+		w.Header().Set("Content-Disposition", `attachment; filename="greetings.ndjson"`)
+	}
+	w.Header().Set("Content-Type", format)
+
+	var after uint64
+	for {
+		records, err := h.store.List(after, exportPageSize)
+		if err != nil {
+			// The status has likely gone already, so all we can do is stop.
+			requestLogger(r.Context(), h.logger).Log("err", err)
+			return
+		}
+		for _, rec := range records {
+			// Records are added as they happen, so they're in time order.
+			if !to.IsZero() && !rec.Time.Before(to) {
+				out.Flush()
+				return
+			}
+			if rec.Time.Before(from) {
+				continue
+			}
+			if err := write(rec); err != nil {
+				return
+			}
+		}
+		if err := out.Flush(); err != nil {
+			return
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		if len(records) < exportPageSize || r.Context().Err() != nil {
+			return
+		}
+		after = records[len(records)-1].ID
+	}
+}
+
+// exportFormat picks what to export as from an Accept header.
+func exportFormat(accept string) (string, bool) {
+	if accept == "" {
+		return mediaTypeNDJSON, true
+	}
+	for _, part := range strings.Split(accept, ",") {
+		switch mediaType(part) {
+		case mediaTypeCSV:
+			return mediaTypeCSV, true
+		case mediaTypeNDJSON, "*/*":
+			return mediaTypeNDJSON, true
+		}
+	}
+	return "", false
+}
+
+// parseExportTime parses an RFC 3339 time. An empty one is the zero time.
+func parseExportTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func exportRow(rec greetingRecord) []string {
+	return []string{
+		strconv.FormatUint(rec.ID, 10),
+		rec.Method,
+		rec.Name,
+		rec.Greeting,
+		rec.Err,
+		rec.Time.Format(time.RFC3339Nano),
+		rec.Caller.Transport,
+		rec.Caller.Addr,
+		rec.Caller.UserAgent,
+		rec.Caller.Subject,
+	}
+}
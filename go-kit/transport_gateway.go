@@ -0,0 +1,62 @@
+package main
+
+// This file mounts the gRPC gateway, which is generated from the
+// google.api.http annotations in pb/greet.proto. It translates RESTful JSON
+// requests into gRPC calls, so the proto definition is the single source of
+// truth for both APIs:
+// curl -X POST -d '{"name": "Aaron"}' http://localhost:8080/v1/hello
+// curl http://localhost:8080/v1/hello/Aaron
+//
+// The calls go to a gRPC server of its own, in memory, rather than to the
+// one on -grpc.addr, so they're authenticated once, as HTTP requests, like
+// any other, see main.go, and not again as gRPC calls.
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+
+	"github.com/naunga/monolith/go-kit/pb"
+)
+
+// gatewayBufferSize is the size of the in-memory connection's buffers.
+const gatewayBufferSize = 1 << 20
+
+// makeGatewayHandler returns a handler that proxies to an in-memory gRPC
+// server for svc, which serves until ctx is done.
+func makeGatewayHandler(ctx context.Context, svc GreetService, logger log.Logger) (http.Handler, error) {
+	lis := bufconn.Listen(gatewayBufferSize)
+	server := grpc.NewServer()
+	unchecked := func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	pb.RegisterGreetServer(server, makeGRPCServer(svc, unchecked, nil, logger))
+	go server.Serve(lis)
+	go func() {
+		<-ctx.Done()
+		server.Stop()
+	}()
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+	)
+	if err != nil {
+		server.Stop()
+		return nil, err
+	}
+	mux := runtime.NewServeMux()
+	if err := pb.RegisterGreetHandler(ctx, mux, conn); err != nil {
+		conn.Close()
+		server.Stop()
+		return nil, err
+	}
+	return mux, nil
+}
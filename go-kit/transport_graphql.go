@@ -0,0 +1,74 @@
+package main
+
+// This file provides a GraphQL API at /graphql. GraphQL does its own request
+// parsing and dispatch, so rather than going through an endpoint the resolver
+// calls the GreetService directly. Middlewares wrapped around the service
+// still apply, since it's the same svc the other transports use.
+//
+// A query looks like this:
+// curl -X POST -d '{"query": "{ hello(name: \"Aaron\") }"}' http://localhost:8080/graphql
+//
+// Every greeting is recorded in the greeting history, see history.go, so
+// greet is the same as hello but as a mutation, for clients that want what
+// changes anything to be one:
+// curl -X POST -d '{"query": "mutation { greet(name: \"Aaron\") }"}' http://localhost:8080/graphql
+
+import (
+	"net/http"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+)
+
+const graphqlSchema = `
+	schema {
+		query: Query
+		mutation: Mutation
+	}
+
+	type Query {
+		hello(name: String!, lang: String): String!
+	}
+
+	type Mutation {
+		greet(name: String!, lang: String): String!
+	}
+`
+
+// graphqlResolver takes a token from limiter for each greeting it resolves,
+// since a query can ask for any number of them.
+type graphqlResolver struct {
+	svc     GreetService
+	limiter *rate.Limiter
+}
+
+// graphqlHelloArgs are the arguments of hello and greet.
+type graphqlHelloArgs struct {
+	Name string
+	Lang *string
+}
+
+func (r *graphqlResolver) Hello(ctx context.Context, args graphqlHelloArgs) (string, error) {
+	if err := takeTokens(r.limiter, 1); err != nil {
+		return "", err
+	}
+	var lang string
+	if args.Lang != nil {
+		lang = *args.Lang
+	}
+	greeting, err := r.svc.Hello(ctx, args.Name, GreetOptions{Language: matchLanguage(lang)})
+	return greeting.Text, err
+}
+
+func (r *graphqlResolver) Greet(ctx context.Context, args graphqlHelloArgs) (string, error) {
+	return r.Hello(ctx, args)
+}
+
+// makeGraphQLHandler parses the schema against a resolver for svc, limited by
+// limiter, and returns a handler that serves it.
+func makeGraphQLHandler(svc GreetService, limiter *rate.Limiter) http.Handler {
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{svc, limiter})
+	return &relay.Handler{Schema: schema}
+}
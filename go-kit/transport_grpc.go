@@ -0,0 +1,87 @@
+package main
+
+// This file provides server-side bindings for the gRPC transport. The message
+// types live in the pb package, which is generated from pb/greet.proto. The
+// server listens on -grpc.addr, and with -http.cmux on the HTTP address as
+// well, which tells gRPC connections from the rest by their content-type.
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/naunga/monolith/go-kit/pb"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+)
+
+// makeGRPCServer makes the hello endpoint, behind m, available as a gRPC
+// GreetServer, with the context of each call made by before as well. A token
+// comes in the authorization metadata, as it would in the Authorization
+// header: authorization: Bearer <token>. The server doesn't do TLS, so there
+// are no client certificates.
+func makeGRPCServer(svc GreetService, m endpoint.Middleware, before []grpctransport.ServerRequestFunc, logger log.Logger) pb.GreetServer {
+	before = append([]grpctransport.ServerRequestFunc{kitjwt.GRPCToContext(), grpcCallerToContext}, before...)
+	options := []grpctransport.ServerOption{
+		grpctransport.ServerBefore(before...),
+		grpctransport.ServerErrorLogger(logger),
+	}
+	return &grpcServer{
+		hello: grpctransport.NewServer(
+			m(makeHelloEndpoint(svc)),
+			decodeGRPCHelloRequest,
+			encodeGRPCHelloResponse,
+			options...,
+		),
+	}
+}
+
+type grpcServer struct {
+	hello grpctransport.Handler
+}
+
+func (s *grpcServer) Hello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	_, rep, err := s.hello.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.HelloReply), nil
+}
+
+// grpcCallerToContext is a grpctransport.RequestFunc that records who's
+// calling in the context, as callerToContext does for HTTP.
+func grpcCallerToContext(ctx context.Context, md metadata.MD) context.Context {
+	c := caller{Transport: "grpc"}
+	if p, ok := peer.FromContext(ctx); ok {
+		c.Addr = p.Addr.String()
+	}
+	if ua := md.Get("user-agent"); len(ua) > 0 {
+		c.UserAgent = ua[0]
+	}
+	return context.WithValue(ctx, callerKey, c)
+}
+
+// Just like the HTTP transport, the gRPC transport needs functions to convert
+// between the wire types and our own request and response structs. These
+// play the same role as decodeHelloRequest and encodeHelloResponse.
+
+func decodeGRPCHelloRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	return newHelloRequest(grpcReq.(*pb.HelloRequest)), nil
+}
+
+func encodeGRPCHelloResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(helloResponse)
+	return &pb.HelloReply{Greeting: resp.Greeting, Err: err2str(resp.Err)}, nil
+}
+
+// Errors can't cross the wire as Go values, so we send them as strings.
+
+func err2str(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// GET /healthz answers with the health of the service and its components,
+// see health.go:
+//
+//	{"status": "degraded", "components": {"history": {"status": "ok"}, "nats": {"status": "down", "err": "nats: connection closed"}}}
+//
+// GET /readyz answers the same way, with the service's own readiness as the
+// lifecycle component, and GET /livez just says ok.
+
+// healthHandler serves /healthz, and, with ready set, /readyz.
+type healthHandler struct {
+	checks *healthChecks
+	ready  *readiness
+}
+
+// ServeHTTP implements http.Handler.
+func (h healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	report := h.checks.Run(r.Context())
+	if h.ready != nil {
+		lifecycle := componentHealth{Status: healthOK}
+		if err := h.ready.Check(r.Context()); err != nil {
+			lifecycle = componentHealth{Status: healthDown, Err: err.Error()}
+			report.Status = healthDegraded
+		}
+		report.Components["lifecycle"] = lifecycle
+	}
+	code := http.StatusOK
+	if report.Status != healthOK {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
+
+// livez serves /livez.
+func livez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,46 @@
+package main
+
+// GET /greetings pages through the greeting history, oldest first, e.g.
+// curl 'http://localhost:8080/greetings?limit=10'
+// Each page has a "next" cursor, to pass as ?after= to get the page after it.
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultGreetingsLimit = 50
+	maxGreetingsLimit     = 1000
+)
+
+func decodeListGreetingsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	req := listGreetingsRequest{Limit: defaultGreetingsLimit}
+	q := r.URL.Query()
+	if s := q.Get("after"); s != "" {
+		after, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		req.After = after
+	}
+	if s := q.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, err
+		}
+		if limit < 1 || limit > maxGreetingsLimit {
+			limit = maxGreetingsLimit
+		}
+		req.Limit = limit
+	}
+	return req, nil
+}
+
+func encodeListGreetingsResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	return json.NewEncoder(w).Encode(response)
+}
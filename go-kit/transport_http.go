@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// Go Kit uses the RPC model to communicate. So it expects us to not only create
+// structs for requests and responses for each endpoint, but also functions to
+// decode requests and encode responses.
+//
+// Requests and responses are JSON unless the client asks for something else
+// with its Content-Type or Accept headers; see codecs.go for the encodings on
+// offer. Protobuf uses the same messages as the gRPC transport, and the others
+// use the same field names as JSON, e.g.
+// <helloRequest><name>Aaron</name></helloRequest>.
+//
+// HTML forms and plain GET requests carry the name as a form value instead, so
+// those are read with ParseForm and answered with JSON.
+//
+// Requests that don't set a lang of their own get the language from the
+// Accept-Language header, and each reply says which language it's in with
+// Content-Language.
+//
+// A request the service can't answer with a greeting, for want of a name,
+// say, is answered with a problem, with the status the error calls for; see
+// problem.go.
+
+const mediaTypeForm = "application/x-www-form-urlencoded"
+
+func decodeHelloRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var request helloRequest
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case r.Method == "GET" || r.Method == "HEAD",
+		mediaType(contentType) == mediaTypeForm,
+		contentType == "" && r.ContentLength == 0:
+		// FormValue prefers a name in the body over one in the query string.
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		preserveCase, _ := strconv.ParseBool(r.FormValue("preserve_case"))
+		noAlias, _ := strconv.ParseBool(r.FormValue("no_alias"))
+		transliterate, _ := strconv.ParseBool(r.FormValue("transliterate"))
+		request = helloRequest{
+			Name:          r.FormValue("name"),
+			Lang:          r.FormValue("lang"),
+			TZ:            r.FormValue("tz"),
+			PreserveCase:  preserveCase,
+			UserID:        r.FormValue("user_id"),
+			Formality:     r.FormValue("formality"),
+			Title:         r.FormValue("title"),
+			NoAlias:       noAlias,
+			Transliterate: transliterate,
+		}
+	default:
+		c, ok := httpCodecs.lookup(contentType)
+		if !ok {
+			c = jsonCodec
+		}
+		decoded, err := c.decode(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		request = decoded.(helloRequest)
+	}
+	request.Lang = preferredLanguage(ctx, r, request.Lang)
+	return request, nil
+}
+
+// preferredLanguage returns lang, or the Accept-Language header if lang is
+// empty, or failing that the locale of the request's tenant.
+func preferredLanguage(ctx context.Context, r *http.Request, lang string) string {
+	if lang != "" {
+		return lang
+	}
+	if lang = r.Header.Get("Accept-Language"); lang != "" {
+		return lang
+	}
+	t, _ := ctx.Value(tenantKey).(tenant)
+	return t.Locale
+}
+
+func encodeHelloResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	return writeHelloResponse(ctx, w, response.(helloResponse))
+}
+
+// GET /hello/{name} is a read-only alternative to POSTing a body. The router
+// answers 404 for paths that don't match.
+
+func decodeHelloPathRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return decodeHelloQuery(ctx, r, mux.Vars(r)["name"]), nil
+}
+
+// decodeHelloQuery returns the request to greet name with the options in r's
+// query.
+func decodeHelloQuery(ctx context.Context, r *http.Request, name string) helloRequest {
+	q := r.URL.Query()
+	preserveCase, _ := strconv.ParseBool(q.Get("preserve_case"))
+	noAlias, _ := strconv.ParseBool(q.Get("no_alias"))
+	transliterate, _ := strconv.ParseBool(q.Get("transliterate"))
+	return helloRequest{
+		Name:          name,
+		Lang:          preferredLanguage(ctx, r, q.Get("lang")),
+		TZ:            q.Get("tz"),
+		PreserveCase:  preserveCase,
+		UserID:        q.Get("user_id"),
+		Formality:     q.Get("formality"),
+		Title:         q.Get("title"),
+		NoAlias:       noAlias,
+		Transliterate: transliterate,
+	}
+}
+
+func encodeHelloPathResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	return writeHelloResponse(ctx, w, response.(helloResponse))
+}
+
+// GET /hello/card takes the same query as GET /hello, and answers with the
+// greeting drawn on a PNG, or a problem.
+
+const mediaTypePNG = "image/png"
+
+// makeEncodeCardResponse returns an encoder that draws greetings with r.
+func makeEncodeCardResponse(r CardRenderer) kithttp.EncodeResponseFunc {
+	return func(_ context.Context, w http.ResponseWriter, response interface{}) error {
+		resp := response.(helloResponse)
+		if resp.Err != nil {
+			return writeProblem(w, resp.Err)
+		}
+		card, err := r.Render(resp.Greeting)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", mediaTypePNG)
+		w.Header().Set("Content-Language", resp.Lang.String())
+		return png.Encode(w, card)
+	}
+}
+
+// /goodbye only speaks JSON.
+
+func decodeGoodbyeRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var request goodbyeRequest
+	if err := decodeJSON(r.Body, &request); err != nil {
+		return nil, err
+	}
+	request.Lang = preferredLanguage(ctx, r, request.Lang)
+	return request, nil
+}
+
+func encodeGoodbyeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	if err := response.(goodbyeResponse).err; err != nil {
+		return writeProblem(w, err)
+	}
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	w.Header().Set("Content-Language", response.(goodbyeResponse).Lang.String())
+	return json.NewEncoder(w).Encode(response)
+}
+
+// POST /hello/batch takes a JSON array of names and answers with an array of
+// results, one per name and in the same order, e.g. ["Aaron", ""] gets
+// [{"greeting": "Hello there, Aaron"}, {"err": "no name provided"}]. Its
+// query takes the same options as GET /hello/{name}'s, for every name:
+// POST /hello/batch?formality=formal&tz=Europe/Berlin.
+
+// makeDecodeHelloBatchRequest returns a decoder that rejects batches of more
+// than max names.
+func makeDecodeHelloBatchRequest(max int) kithttp.DecodeRequestFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		var names []string
+		if err := decodeJSON(r.Body, &names); err != nil {
+			return nil, err
+		}
+		if len(names) > max {
+			return nil, fmt.Errorf("batch of %d names is larger than the limit of %d", len(names), max)
+		}
+		return helloBatchRequest{names, decodeHelloQuery(ctx, r, "")}, nil
+	}
+}
+
+func encodeHelloBatchResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(helloBatchResponse)
+	replies := make([]helloReply, len(resp.Results))
+	for i, result := range resp.Results {
+		replies[i] = newHelloReply(result)
+	}
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	w.Header().Set("Content-Language", resp.Lang.String())
+	return json.NewEncoder(w).Encode(replies)
+}
+
+func writeHelloResponse(ctx context.Context, w http.ResponseWriter, resp helloResponse) error {
+	if resp.Err != nil {
+		return writeProblem(w, resp.Err)
+	}
+	c := responseCodec(ctx)
+	w.Header().Set("Content-Type", c.mediaType)
+	w.Header().Set("Content-Language", resp.Lang.String())
+	return c.encode(w, resp)
+}
+
+// encodeEndpointError is a kithttp.ErrorEncoder for the greeting endpoints, and
+// the others behind authz, answering with a problem. Requests that break their
+// rules, or can't be decoded, are a 400, without good credentials a 401, with a
+// WWW-Authenticate, without the permission they need a 403, with too long a
+// body a 413, those turned away by the rate limiter a 429, with a Retry-After,
+// by an open circuit breaker or a full bulkhead a 503, and those that time out
+// a 504. Other errors are a 500.
+func encodeEndpointError(_ context.Context, err error, w http.ResponseWriter) {
+	status, code, err := classifyEndpointError(err)
+	setErrorHeaders(w, err)
+	writeProblemStatus(w, status, code, err)
+}
+
+// classifyEndpointError is classifyError for the errors of a server with
+// decodeErrors, which are a 400 unless classifyError says otherwise. It also
+// returns the error, unwrapped if it's a decodeError.
+func classifyEndpointError(err error) (int, string, error) {
+	if e, ok := err.(decodeError); ok {
+		err = e.err
+		if status, _ := classifyError(err); status == http.StatusInternalServerError {
+			return http.StatusBadRequest, "malformed_request", err
+		}
+	}
+	status, code := classifyError(err)
+	return status, code, err
+}
+
+// setErrorHeaders sets the headers that go with the problem err is answered
+// with.
+func setErrorHeaders(w http.ResponseWriter, err error) {
+	switch e := err.(type) {
+	case errUnauthorized:
+		if e.scheme != "" {
+			w.Header().Set("WWW-Authenticate", e.scheme)
+		}
+	case errRateLimited:
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+	}
+}
+
+// Encoders only get to see the context and the response, so the headers they
+// need for content negotiation are put into the context before decoding.
+
+type httpContextKey int
+
+const (
+	contentTypeKey httpContextKey = iota
+	acceptKey
+)
+
+// callerToContext is a kithttp.RequestFunc that records who's calling, for
+// the greeting history.
+func callerToContext(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, callerKey, caller{
+		Transport: "http",
+		Addr:      r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+	})
+}
+
+// headersToContext is a kithttp.RequestFunc that records the request's
+// Content-Type and Accept headers in the context.
+func headersToContext(ctx context.Context, r *http.Request) context.Context {
+	ctx = context.WithValue(ctx, contentTypeKey, mediaType(r.Header.Get("Content-Type")))
+	return context.WithValue(ctx, acceptKey, r.Header.Get("Accept"))
+}
+
+// responseCodec picks the codec to reply with. An explicit Accept header wins;
+// without one the reply matches the request.
+func responseCodec(ctx context.Context) *httpCodec {
+	accept, _ := ctx.Value(acceptKey).(string)
+	for _, part := range strings.Split(accept, ",") {
+		if c, ok := httpCodecs.lookup(part); ok {
+			return c
+		}
+	}
+	if accept == "" || mediaType(accept) == "*/*" {
+		contentType, _ := ctx.Value(contentTypeKey).(string)
+		if c, ok := httpCodecs.lookup(contentType); ok {
+			return c
+		}
+	}
+	return jsonCodec
+}
+
+// mediaType strips any parameters, such as a charset or quality value, from a
+// Content-Type or Accept header value.
+func mediaType(header string) string {
+	if i := strings.Index(header, ";"); i >= 0 {
+		header = header[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(header))
+}
+
+// decodeError is an error decoding a request, which is the client's fault
+// unless it says otherwise.
+type decodeError struct {
+	err error
+}
+
+func (e decodeError) Error() string { return e.err.Error() }
+
+// StatusCode has kithttp's default ErrorEncoder answer a decodeError with a
+// 400.
+func (e decodeError) StatusCode() int { return http.StatusBadRequest }
+
+// decodeErrors returns dec, with the errors it returns marked as decodeErrors,
+// which the server's errors can't be told apart from otherwise.
+func decodeErrors(dec kithttp.DecodeRequestFunc) kithttp.DecodeRequestFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		request, err := dec(ctx, r)
+		if err != nil {
+			return nil, decodeError{err}
+		}
+		return request, nil
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+// POST /hello/import takes a CSV or NDJSON file of names, as the body with a
+// Content-Type of text/csv or application/x-ndjson, or as the "file" field of
+// a multipart form, the way a browser uploads it:
+//
+//	curl -F file=@names.csv http://localhost:8080/hello/import
+//
+// It answers 202 Accepted with the job, and a Location to follow it at. GET
+// /hello/import/{id} answers with the job as it stands. Rows without a
+// language are greeted in the Accept-Language of the upload.
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+func decodeImportRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var (
+		body   io.Reader = r.Body
+		format           = mediaType(r.Header.Get("Content-Type"))
+	)
+	if format == "multipart/form-data" {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return nil, err
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return importRequest{}, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if part.FormName() == "file" {
+				body, format = part, importFileFormat(part.Header.Get("Content-Type"), part.FileName())
+				break
+			}
+		}
+	}
+
+	lang := preferredLanguage(ctx, r, "")
+	var rows importRows
+	switch format {
+	case mediaTypeCSV:
+		rows = csvImportRows(lang)
+	case mediaTypeNDJSON:
+		rows = ndjsonImportRows(lang)
+	default:
+		return importRequest{}, nil
+	}
+
+	f, err := ioutil.TempFile("", "greet-import-")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return importRequest{f.Name(), rows}, nil
+}
+
+// importFileFormat works out what an uploaded file is, from its Content-Type,
+// or its name if browsers don't know the type.
+func importFileFormat(contentType, filename string) string {
+	if t := mediaType(contentType); t == mediaTypeCSV || t == mediaTypeNDJSON {
+		return t
+	}
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		return mediaTypeCSV
+	case ".ndjson", ".jsonl":
+		return mediaTypeNDJSON
+	}
+	return ""
+}
+
+func decodeGetImportRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return getImportRequest{mux.Vars(r)["id"]}, nil
+}
+
+// makeEncodeImportResponse returns an encoder that answers with code and the
+// job, unless the endpoint failed. A new job also gets a Location.
+func makeEncodeImportResponse(code int) kithttp.EncodeResponseFunc {
+	return func(_ context.Context, w http.ResponseWriter, response interface{}) error {
+		resp := response.(importResponse)
+		if resp.Err != nil {
+			return writeProblem(w, resp.Err)
+		}
+		if code == http.StatusAccepted {
+			w.Header().Set("Location", "/hello/import/"+resp.Job.ID)
+		}
+		w.Header().Set("Content-Type", mediaTypeJSON)
+		w.WriteHeader(code)
+		return json.NewEncoder(w).Encode(resp.Job)
+	}
+}
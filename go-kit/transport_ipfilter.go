@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// The IP filter's rules are managed as JSON:
+//
+//	GET /admin/ipfilter  the rules in force
+//	PUT /admin/ipfilter  replace them
+//
+// e.g. PUT /admin/ipfilter with {"allow": ["10.0.0.0/8"], "deny": []}. A rule
+// that isn't a network is a 400, and changes nothing.
+
+// makeIPFilterHandler returns a handler for /admin/ipfilter.
+func makeIPFilterHandler(az authz, f *ipFilter) http.Handler {
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/admin/ipfilter").Handler(kithttp.NewServer(
+		az.endpoint("ipfilter.read", makeGetIPFilterEndpoint(f)),
+		decodeErrors(decodeGetIPFilterRequest),
+		encodeIPFilterResponse,
+		az.options()...,
+	))
+	r.Methods("PUT").Path("/admin/ipfilter").Handler(kithttp.NewServer(
+		az.endpoint("ipfilter.write", makePutIPFilterEndpoint(f)),
+		decodeErrors(decodePutIPFilterRequest),
+		encodeIPFilterResponse,
+		az.options()...,
+	))
+	return r
+}
+
+func decodeGetIPFilterRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return getIPFilterRequest{}, nil
+}
+
+func decodePutIPFilterRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var rules ipRules
+	if err := decodeJSON(r.Body, &rules); err != nil {
+		return nil, err
+	}
+	return putIPFilterRequest{rules}, nil
+}
+
+func encodeIPFilterResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(ipFilterResponse)
+	if resp.Err != nil {
+		return writeProblem(w, resp.Err)
+	}
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	return json.NewEncoder(w).Encode(resp.Rules)
+}
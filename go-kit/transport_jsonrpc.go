@@ -0,0 +1,204 @@
+package main
+
+// This file provides a JSON-RPC 2.0 transport at /rpc. Each JSON-RPC method is
+// bound to an endpoint along with a function to decode its params and one to
+// turn the endpoint's response into a result.
+//
+// Single calls, batches, and notifications are all supported:
+// curl -X POST -d '{"jsonrpc": "2.0", "method": "hello", "params": {"name": "Aaron"}, "id": 1}' http://localhost:8080/rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+)
+
+// The error codes defined by the JSON-RPC 2.0 specification. Errors returned
+// by the service itself use jsonrpcServerError, from the range the
+// specification reserves for implementations.
+const (
+	jsonrpcParseError     = -32700
+	jsonrpcInvalidRequest = -32600
+	jsonrpcMethodNotFound = -32601
+	jsonrpcInvalidParams  = -32602
+	jsonrpcInternalError  = -32603
+	jsonrpcServerError    = -32000
+)
+
+type jsonrpcRequest struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+type jsonrpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *jsonrpcError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type jsonrpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// jsonrpcDecodeParamsFunc extracts a user-domain request object from the
+// params member of a call.
+type jsonrpcDecodeParamsFunc func(context.Context, json.RawMessage) (interface{}, error)
+
+// jsonrpcEncodeResultFunc converts the endpoint's response into the result
+// member of the reply. Returning an error produces an error reply instead.
+type jsonrpcEncodeResultFunc func(context.Context, interface{}) (interface{}, error)
+
+type jsonrpcMethod struct {
+	e   endpoint.Endpoint
+	dec jsonrpcDecodeParamsFunc
+	enc jsonrpcEncodeResultFunc
+}
+
+type jsonrpcServer struct {
+	methods map[string]jsonrpcMethod
+	logger  log.Logger
+}
+
+// ServeHTTP implements http.Handler.
+func (s jsonrpcServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	var raw json.RawMessage
+	if err := decodeJSON(r.Body, &raw); err != nil {
+		s.reply(w, jsonrpcResponse{Error: &jsonrpcError{jsonrpcParseError, err.Error()}})
+		return
+	}
+
+	// A batch is just an array of calls, answered with an array of replies.
+	// Callers match them up by id.
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(raw, &batch); err != nil {
+			s.reply(w, jsonrpcResponse{Error: &jsonrpcError{jsonrpcParseError, err.Error()}})
+			return
+		}
+		if len(batch) == 0 {
+			s.reply(w, jsonrpcResponse{Error: &jsonrpcError{jsonrpcInvalidRequest, "empty batch"}})
+			return
+		}
+		var replies []jsonrpcResponse
+		for _, call := range batch {
+			if resp, ok := s.call(ctx, call); ok {
+				replies = append(replies, resp)
+			}
+		}
+		if len(replies) == 0 {
+			// A batch made up entirely of notifications gets no reply at all.
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		s.reply(w, replies)
+		return
+	}
+
+	resp, ok := s.call(ctx, raw)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	s.reply(w, resp)
+}
+
+// call runs a single JSON-RPC call. The returned bool is false when the call
+// was a notification, which must not be answered.
+func (s jsonrpcServer) call(ctx context.Context, raw json.RawMessage) (jsonrpcResponse, bool) {
+	var req jsonrpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return jsonrpcResponse{Error: &jsonrpcError{jsonrpcInvalidRequest, err.Error()}}, true
+	}
+	resp := jsonrpcResponse{ID: req.ID}
+	notification := len(req.ID) == 0
+
+	if req.Version != "2.0" || req.Method == "" {
+		resp.Error = &jsonrpcError{jsonrpcInvalidRequest, "invalid request"}
+		return resp, true
+	}
+
+	m, ok := s.methods[req.Method]
+	if !ok {
+		resp.Error = &jsonrpcError{jsonrpcMethodNotFound, "method not found: " + req.Method}
+		return resp, !notification
+	}
+
+	request, err := m.dec(ctx, req.Params)
+	if err != nil {
+		resp.Error = &jsonrpcError{jsonrpcInvalidParams, err.Error()}
+		return resp, !notification
+	}
+
+	response, err := m.e(ctx, request)
+	if err != nil {
+		requestLogger(ctx, s.logger).Log("err", err)
+		resp.Error = &jsonrpcError{jsonrpcInternalError, err.Error()}
+		return resp, !notification
+	}
+
+	result, err := m.enc(ctx, response)
+	if err != nil {
+		resp.Error = &jsonrpcError{jsonrpcServerError, err.Error()}
+		return resp, !notification
+	}
+	resp.Result = result
+	return resp, !notification
+}
+
+func (s jsonrpcServer) reply(w http.ResponseWriter, v interface{}) {
+	switch resp := v.(type) {
+	case jsonrpcResponse:
+		resp.Version = "2.0"
+		v = resp
+	case []jsonrpcResponse:
+		for i := range resp {
+			resp[i].Version = "2.0"
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Log("err", err)
+	}
+}
+
+// The hello method accepts its params either by name, {"name": "Aaron"}, or
+// by position, ["Aaron"].
+
+func decodeJSONRPCHelloParams(_ context.Context, params json.RawMessage) (interface{}, error) {
+	var request helloRequest
+	if err := json.Unmarshal(params, &request); err == nil {
+		return request, nil
+	}
+	var positional []string
+	if err := json.Unmarshal(params, &positional); err != nil || len(positional) != 1 {
+		return nil, errors.New("params must be {\"name\": string} or [string]")
+	}
+	return helloRequest{Name: positional[0]}, nil
+}
+
+func encodeJSONRPCHelloResult(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(helloResponse)
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return struct {
+		Greeting string `json:"greeting"`
+	}{resp.Greeting}, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	log "github.com/go-kit/kit/log"
+)
+
+func TestJSONRPC(t *testing.T) {
+	hello := func(_ context.Context, request interface{}) (interface{}, error) {
+		name := request.(helloRequest).Name
+		if name == "" {
+			return helloResponse{Err: errors.New("no name provided")}, nil
+		}
+		if name == "fail" {
+			return nil, errors.New("failed")
+		}
+		return helloResponse{Greeting: "Hello, " + name}, nil
+	}
+	s := jsonrpcServer{
+		methods: map[string]jsonrpcMethod{
+			"hello": {hello, decodeJSONRPCHelloParams, encodeJSONRPCHelloResult},
+		},
+		logger: log.NewNopLogger(),
+	}
+
+	for name, tc := range map[string]struct {
+		body   string
+		status int
+		want   string
+	}{
+		"by name": {
+			`{"jsonrpc": "2.0", "method": "hello", "params": {"name": "Ada"}, "id": 1}`,
+			http.StatusOK,
+			`{"jsonrpc": "2.0", "result": {"greeting": "Hello, Ada"}, "id": 1}`,
+		},
+		"by position": {
+			`{"jsonrpc": "2.0", "method": "hello", "params": ["Ada"], "id": "a"}`,
+			http.StatusOK,
+			`{"jsonrpc": "2.0", "result": {"greeting": "Hello, Ada"}, "id": "a"}`,
+		},
+		"notification": {
+			`{"jsonrpc": "2.0", "method": "hello", "params": ["Ada"]}`,
+			http.StatusNoContent,
+			``,
+		},
+		"parse error": {
+			`{"jsonrpc": "2.0", "method": `,
+			http.StatusOK,
+			`{"jsonrpc": "2.0", "error": {"code": -32700, "message": "unexpected EOF"}, "id": null}`,
+		},
+		"unknown method": {
+			`{"jsonrpc": "2.0", "method": "goodbye", "id": 1}`,
+			http.StatusOK,
+			`{"jsonrpc": "2.0", "error": {"code": -32601, "message": "method not found: goodbye"}, "id": 1}`,
+		},
+		"bad params": {
+			`{"jsonrpc": "2.0", "method": "hello", "params": [1, 2], "id": 1}`,
+			http.StatusOK,
+			`{"jsonrpc": "2.0", "error": {"code": -32602, "message": "params must be {\"name\": string} or [string]"}, "id": 1}`,
+		},
+		"service error": {
+			`{"jsonrpc": "2.0", "method": "hello", "params": [""], "id": 1}`,
+			http.StatusOK,
+			`{"jsonrpc": "2.0", "error": {"code": -32000, "message": "no name provided"}, "id": 1}`,
+		},
+		"endpoint error": {
+			`{"jsonrpc": "2.0", "method": "hello", "params": ["fail"], "id": 1}`,
+			http.StatusOK,
+			`{"jsonrpc": "2.0", "error": {"code": -32603, "message": "failed"}, "id": 1}`,
+		},
+		"batch": {
+			`[
+				{"jsonrpc": "2.0", "method": "hello", "params": ["Ada"], "id": 1},
+				{"jsonrpc": "2.0", "method": "hello", "params": ["Notified"]},
+				{"jsonrpc": "1.0", "method": "hello", "id": 2},
+				{"jsonrpc": "2.0", "method": "hello", "params": ["Grace"], "id": 3}
+			]`,
+			http.StatusOK,
+			`[
+				{"jsonrpc": "2.0", "result": {"greeting": "Hello, Ada"}, "id": 1},
+				{"jsonrpc": "2.0", "error": {"code": -32600, "message": "invalid request"}, "id": 2},
+				{"jsonrpc": "2.0", "result": {"greeting": "Hello, Grace"}, "id": 3}
+			]`,
+		},
+		"batch of notifications": {
+			`[{"jsonrpc": "2.0", "method": "hello", "params": ["Ada"]}, {"jsonrpc": "2.0", "method": "hello", "params": ["Grace"]}]`,
+			http.StatusNoContent,
+			``,
+		},
+		"empty batch": {
+			`[]`,
+			http.StatusOK,
+			`{"jsonrpc": "2.0", "error": {"code": -32600, "message": "empty batch"}, "id": null}`,
+		},
+	} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("POST", "/rpc", strings.NewReader(tc.body)))
+		if w.Code != tc.status {
+			t.Errorf("%s: status %d, want %d", name, w.Code, tc.status)
+		}
+		if tc.want == "" {
+			if w.Body.Len() != 0 {
+				t.Errorf("%s: replied %s, want nothing", name, w.Body)
+			}
+			continue
+		}
+		var got, want interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if err := json.Unmarshal([]byte(tc.want), &want); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: replied %s, want %s", name, w.Body, tc.want)
+		}
+	}
+}
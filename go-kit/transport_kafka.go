@@ -0,0 +1,97 @@
+package main
+
+// This file provides a Kafka consumer transport. kafkaSubscriber reads hello
+// requests from an input topic as part of a consumer group, runs them through
+// the endpoint, and writes the responses to an output topic.
+//
+// Offsets are only committed once the response has been written, so a crash
+// between the two means the request is processed again rather than lost.
+// That's the at-least-once guarantee, and it means consumers of the output
+// topic may occasionally see a duplicate. Like NATS messages, Kafka's carry
+// no credentials.
+
+import (
+	"encoding/json"
+
+	"github.com/segmentio/kafka-go"
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+)
+
+// kafkaDecodeRequestFunc extracts a user-domain request object from a Kafka
+// message.
+type kafkaDecodeRequestFunc func(context.Context, kafka.Message) (interface{}, error)
+
+// kafkaEncodeResponseFunc encodes the passed response object into the message
+// written to the output topic.
+type kafkaEncodeResponseFunc func(context.Context, interface{}) (kafka.Message, error)
+
+type kafkaSubscriber struct {
+	ctx    context.Context
+	e      endpoint.Endpoint
+	dec    kafkaDecodeRequestFunc
+	enc    kafkaEncodeResponseFunc
+	logger log.Logger
+}
+
+// Serve consumes messages from r until an error occurs that would break the
+// delivery guarantee, writing each response to w.
+func (s kafkaSubscriber) Serve(r *kafka.Reader, w *kafka.Writer) error {
+	for {
+		msg, err := r.FetchMessage(s.ctx)
+		if err != nil {
+			return err
+		}
+
+		request, err := s.dec(s.ctx, msg)
+		if err != nil {
+			// Redelivering a message we can't decode won't help, so log it and
+			// move past it.
+			s.logger.Log("err", err, "partition", msg.Partition, "offset", msg.Offset)
+			if err := r.CommitMessages(s.ctx, msg); err != nil {
+				return err
+			}
+			continue
+		}
+
+		response, err := s.e(s.ctx, request)
+		if err != nil {
+			return err
+		}
+
+		out, err := s.enc(s.ctx, response)
+		if err != nil {
+			return err
+		}
+		// Keep responses on the same key as their request, so they land on a
+		// matching partition and stay in order.
+		out.Key = msg.Key
+
+		if err := w.WriteMessages(s.ctx, out); err != nil {
+			return err
+		}
+		if err := r.CommitMessages(s.ctx, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// Kafka messages carry the same JSON payloads as the HTTP transport.
+
+func decodeKafkaHelloRequest(_ context.Context, msg kafka.Message) (interface{}, error) {
+	var request helloRequest
+	if err := json.Unmarshal(msg.Value, &request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func encodeKafkaResponse(_ context.Context, response interface{}) (kafka.Message, error) {
+	value, err := json.Marshal(response)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return kafka.Message{Value: value}, nil
+}
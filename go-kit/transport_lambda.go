@@ -0,0 +1,140 @@
+package main
+
+// This file lets the service run as an AWS Lambda function behind an API
+// Gateway proxy integration; see main_lambda.go. lambdaServer plays the part
+// kithttp.Server plays for HTTP, but works on API Gateway events instead of
+// http.Requests, so there's no listener to keep running between invocations.
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+)
+
+// lambdaDecodeRequestFunc extracts a user-domain request object from an API
+// Gateway proxy request.
+type lambdaDecodeRequestFunc func(context.Context, events.APIGatewayProxyRequest) (interface{}, error)
+
+// lambdaEncodeResponseFunc encodes the passed response object into an API
+// Gateway proxy response. It also gets the request, for content negotiation.
+type lambdaEncodeResponseFunc func(context.Context, events.APIGatewayProxyRequest, interface{}) (events.APIGatewayProxyResponse, error)
+
+type lambdaServer struct {
+	e      endpoint.Endpoint
+	dec    lambdaDecodeRequestFunc
+	enc    lambdaEncodeResponseFunc
+	logger log.Logger
+}
+
+// Handle is the function passed to lambda.Start. Failures are answered with
+// problems, as the HTTP transport answers them, rather than returned, since
+// API Gateway turns a returned error into a bare 502.
+func (s lambdaServer) Handle(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	request, err := s.dec(ctx, req)
+	if err != nil {
+		s.logger.Log("err", err)
+		if status, _ := classifyError(err); status == http.StatusInternalServerError {
+			return lambdaProblem(http.StatusBadRequest, "malformed_request", err), nil
+		}
+		return lambdaError(err), nil
+	}
+
+	response, err := s.e(ctx, request)
+	if err != nil {
+		s.logger.Log("err", err)
+		return lambdaError(err), nil
+	}
+
+	resp, err := s.enc(ctx, req, response)
+	if err != nil {
+		s.logger.Log("err", err)
+		return lambdaError(err), nil
+	}
+	return resp, nil
+}
+
+// lambdaError answers with err as a problem, with the status and code
+// classifyError gives it, as writeProblem would.
+func lambdaError(err error) events.APIGatewayProxyResponse {
+	status, code := classifyError(err)
+	return lambdaProblem(status, code, err)
+}
+
+func lambdaProblem(status int, code string, err error) events.APIGatewayProxyResponse {
+	b, _ := json.Marshal(newProblem(status, code, err))
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": mediaTypeProblem},
+		Body:       string(b) + "\n",
+	}
+}
+
+// API Gateway requests are decoded the same way as requests to /hello: a name
+// in the path (for a /hello/{name} resource) or the query string, or a body in
+// any of the encodings in codecs.go.
+
+func decodeLambdaHelloRequest(_ context.Context, req events.APIGatewayProxyRequest) (interface{}, error) {
+	if name, ok := req.PathParameters["name"]; ok {
+		return helloRequest{Name: name}, nil
+	}
+	if req.HTTPMethod == "GET" || req.Body == "" {
+		return helloRequest{Name: req.QueryStringParameters["name"]}, nil
+	}
+
+	body := []byte(req.Body)
+	if req.IsBase64Encoded {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(req.Body); err != nil {
+			return nil, err
+		}
+	}
+	c, ok := httpCodecs.lookup(lambdaHeader(req.Headers, "Content-Type"))
+	if !ok {
+		c = jsonCodec
+	}
+	return c.decode(bytes.NewReader(body))
+}
+
+func encodeLambdaHelloResponse(ctx context.Context, req events.APIGatewayProxyRequest, response interface{}) (events.APIGatewayProxyResponse, error) {
+	ctx = context.WithValue(ctx, contentTypeKey, mediaType(lambdaHeader(req.Headers, "Content-Type")))
+	ctx = context.WithValue(ctx, acceptKey, lambdaHeader(req.Headers, "Accept"))
+	c := responseCodec(ctx)
+
+	resp := response.(helloResponse)
+	if resp.Err != nil {
+		return lambdaError(resp.Err), nil
+	}
+	var buf bytes.Buffer
+	if err := c.encode(&buf, resp); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	reply := events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": c.mediaType},
+		Body:       buf.String(),
+	}
+	if c.binary {
+		reply.Body = base64.StdEncoding.EncodeToString(buf.Bytes())
+		reply.IsBase64Encoded = true
+	}
+	return reply, nil
+}
+
+// lambdaHeader looks up a header by name. API Gateway passes headers through
+// with whatever case the client used, so the lookup ignores case.
+func lambdaHeader(headers map[string]string, key string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
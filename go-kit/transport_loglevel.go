@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// The log level is managed as JSON, see loglevel.go:
+//
+//	GET /admin/loglevel  the level in force
+//	PUT /admin/loglevel  change it
+//
+// e.g. PUT /admin/loglevel with {"level": "debug", "revert_after": "15m"}
+// logs at debug for the next quarter of an hour, and is answered with
+// {"level": "debug", "revert_to": "info", "revert_at": "..."}. A level that
+// isn't one is a 400, and changes nothing.
+
+// makeLogLevelHandler returns a handler for /admin/loglevel.
+func makeLogLevelHandler(az authz, c *logLevelControl) http.Handler {
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/admin/loglevel").Handler(kithttp.NewServer(
+		az.endpoint("loglevel.read", makeGetLogLevelEndpoint(c)),
+		decodeErrors(decodeGetLogLevelRequest),
+		encodeLogLevelResponse,
+		az.options()...,
+	))
+	r.Methods("PUT").Path("/admin/loglevel").Handler(kithttp.NewServer(
+		az.endpoint("loglevel.write", makePutLogLevelEndpoint(c)),
+		decodeErrors(decodePutLogLevelRequest),
+		encodeLogLevelResponse,
+		az.options()...,
+	))
+	return r
+}
+
+func decodeGetLogLevelRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return getLogLevelRequest{}, nil
+}
+
+func decodePutLogLevelRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var body struct {
+		Level       string `json:"level"`
+		RevertAfter string `json:"revert_after"`
+	}
+	if err := decodeJSON(r.Body, &body); err != nil {
+		return nil, err
+	}
+	req := putLogLevelRequest{Level: body.Level}
+	if body.RevertAfter != "" {
+		d, err := time.ParseDuration(body.RevertAfter)
+		if err != nil {
+			return nil, validationError{"revert_after", "invalid_duration", "revert_after is not a duration, like 15m"}
+		}
+		req.RevertAfter = d
+	}
+	return req, nil
+}
+
+func encodeLogLevelResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(logLevelResponse)
+	if resp.Err != nil {
+		return writeProblem(w, resp.Err)
+	}
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	return json.NewEncoder(w).Encode(resp.State)
+}
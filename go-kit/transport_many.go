@@ -0,0 +1,160 @@
+package main
+
+// POST /hello/many greets as many names as the client cares to send, and
+// streams a greeting back for each one as it goes, so neither side has to
+// hold the whole list. The body is a JSON array, or newline delimited JSON
+// when the Content-Type is application/x-ndjson. Each item is a name or a
+// full hello request, e.g.
+//
+//	"Aaron"
+//	{"name": "Zoë", "lang": "fr"}
+//
+// The response is always NDJSON, one {"greeting": ...} or {"err": ...} per
+// item, in order. An item that isn't valid JSON ends the stream with an error,
+// since there's no telling where the next one starts.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+)
+
+const mediaTypeNDJSON = "application/x-ndjson"
+
+// manyFlushEvery is how many greetings are buffered before they're sent.
+const manyFlushEvery = 100
+
+type manyServer struct {
+	e      endpoint.Endpoint
+	logger log.Logger
+}
+
+// ServeHTTP implements http.Handler.
+func (s manyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// HTTP/1.x stops reading the request once the response has started,
+	// unless it's told otherwise. HTTP/2 doesn't need telling.
+	http.NewResponseController(w).EnableFullDuplex()
+	liftDeadlines(w)
+
+	ctx := r.Context()
+	logger := requestLogger(ctx, s.logger)
+	lang := r.Header.Get("Accept-Language")
+	items := newManyDecoder(r.Body, mediaType(r.Header.Get("Content-Type")) == mediaTypeNDJSON)
+
+	w.Header().Set("Content-Type", mediaTypeNDJSON)
+	out := bufio.NewWriter(w)
+	enc := json.NewEncoder(out)
+	flush := func() error {
+		if err := out.Flush(); err != nil {
+			return err
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	}
+
+	for n := 1; ; n++ {
+		request, err := items.next(lang)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logger.Log("err", err)
+			enc.Encode(helloReply{Err: err.Error()})
+			break
+		}
+
+		var reply helloReply
+		if response, err := s.e(ctx, request); err != nil {
+			logger.Log("err", err)
+			reply.Err = err.Error()
+		} else {
+			reply = newHelloReply(response.(helloResponse))
+		}
+		if err := enc.Encode(reply); err != nil {
+			// The client has gone away.
+			return
+		}
+		if n%manyFlushEvery == 0 {
+			if err := flush(); err != nil {
+				return
+			}
+		}
+	}
+	flush()
+}
+
+// manyDecoder reads hello requests one at a time from a JSON array or NDJSON.
+type manyDecoder struct {
+	dec     *json.Decoder
+	ndjson  bool
+	started bool
+}
+
+func newManyDecoder(r io.Reader, ndjson bool) *manyDecoder {
+	return &manyDecoder{dec: json.NewDecoder(r), ndjson: ndjson}
+}
+
+// next returns the next request, using lang for a request that doesn't give
+// one, or io.EOF when there are no more.
+func (d *manyDecoder) next(lang string) (helloRequest, error) {
+	if !d.ndjson {
+		if !d.started {
+			d.started = true
+			// An empty body is an empty list.
+			if err := d.expect(json.Delim('[')); err != nil {
+				return helloRequest{}, err
+			}
+		}
+		if !d.dec.More() {
+			if err := d.expect(json.Delim(']')); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return helloRequest{}, err
+			}
+			return helloRequest{}, io.EOF
+		}
+	}
+
+	var raw json.RawMessage
+	if err := d.dec.Decode(&raw); err != nil {
+		return helloRequest{}, err
+	}
+	return parseHelloItem(raw, lang)
+}
+
+// parseHelloItem parses an item that's either a name or a full hello
+// request, using lang for a request that doesn't give one.
+func parseHelloItem(raw []byte, lang string) (helloRequest, error) {
+	var request helloRequest
+	if bytes.HasPrefix(raw, []byte(`"`)) {
+		if err := json.Unmarshal(raw, &request.Name); err != nil {
+			return helloRequest{}, err
+		}
+	} else if err := json.Unmarshal(raw, &request); err != nil {
+		return helloRequest{}, err
+	}
+	if request.Lang == "" {
+		request.Lang = lang
+	}
+	return request, nil
+}
+
+func (d *manyDecoder) expect(delim json.Delim) error {
+	t, err := d.dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != delim {
+		return fmt.Errorf("expected %v, not %v", delim, t)
+	}
+	return nil
+}
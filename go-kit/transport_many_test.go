@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestManyDecoder(t *testing.T) {
+	for name, tc := range map[string]struct {
+		body   string
+		ndjson bool
+		want   []helloRequest
+		err    bool
+	}{
+		"array": {
+			body: `["Ada", {"name": "Zoë", "lang": "fr"}, "Grace"]`,
+			want: []helloRequest{{Name: "Ada", Lang: "en"}, {Name: "Zoë", Lang: "fr"}, {Name: "Grace", Lang: "en"}},
+		},
+		"empty array": {body: `[]`},
+		"empty body":  {body: ``},
+		"ndjson": {
+			body:   "\"Ada\"\n{\"name\": \"Zoë\", \"lang\": \"fr\"}\n",
+			ndjson: true,
+			want:   []helloRequest{{Name: "Ada", Lang: "en"}, {Name: "Zoë", Lang: "fr"}},
+		},
+		"empty ndjson": {ndjson: true},
+		"not an array": {
+			body: `{"name": "Ada"}`,
+			err:  true,
+		},
+		"unterminated array": {
+			body: `["Ada", "Grace"`,
+			want: []helloRequest{{Name: "Ada", Lang: "en"}, {Name: "Grace", Lang: "en"}},
+			err:  true,
+		},
+		"bad item": {
+			body: `["Ada", 42]`,
+			want: []helloRequest{{Name: "Ada", Lang: "en"}},
+			err:  true,
+		},
+		"bad ndjson": {
+			body:   "\"Ada\"\n{\"name\": \n",
+			ndjson: true,
+			want:   []helloRequest{{Name: "Ada", Lang: "en"}},
+			err:    true,
+		},
+	} {
+		d := newManyDecoder(strings.NewReader(tc.body), tc.ndjson)
+		var (
+			got []helloRequest
+			err error
+		)
+		for {
+			var request helloRequest
+			if request, err = d.next("en"); err != nil {
+				break
+			}
+			got = append(got, request)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", name, got, tc.want)
+		}
+		if tc.err && err == io.EOF {
+			t.Errorf("%s: ended cleanly, want an error", name)
+		}
+		if !tc.err && err != io.EOF {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+// This file provides an MQTT transport for devices that can't speak HTTP.
+// MQTT has no notion of a reply address, so the topic carries it instead: a
+// device publishes a hello request to <prefix>/hello/<device-id> and receives
+// the response on <prefix>/reply/<device-id>, or, if the request fails, the
+// problem it would be answered with over HTTP, as over NATS. Like NATS
+// messages, MQTT's carry no credentials.
+
+import (
+	"encoding/json"
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+)
+
+// mqttDecodeRequestFunc extracts a user-domain request object from an MQTT
+// message.
+type mqttDecodeRequestFunc func(context.Context, mqtt.Message) (interface{}, error)
+
+// mqttEncodeResponseFunc encodes the passed response object into the payload
+// published on the reply topic.
+type mqttEncodeResponseFunc func(context.Context, interface{}) ([]byte, error)
+
+// mqttEncodeErrorFunc encodes the error a request failed with into the
+// payload published on the reply topic.
+type mqttEncodeErrorFunc func(context.Context, error) []byte
+
+type mqttSubscriber struct {
+	ctx    context.Context
+	e      endpoint.Endpoint
+	dec    mqttDecodeRequestFunc
+	enc    mqttEncodeResponseFunc
+	errEnc mqttEncodeErrorFunc
+	prefix string
+	qos    byte
+	logger log.Logger
+}
+
+// Topic is the filter to subscribe to, matching requests from every device.
+func (s mqttSubscriber) Topic() string {
+	return s.prefix + "/hello/+"
+}
+
+// ServeMessage implements mqtt.MessageHandler.
+func (s mqttSubscriber) ServeMessage(c mqtt.Client, msg mqtt.Message) {
+	device := msg.Topic()[strings.LastIndex(msg.Topic(), "/")+1:]
+
+	payload, err := s.serve(msg)
+	if err != nil {
+		s.logger.Log("err", err, "device", device)
+		payload = s.errEnc(s.ctx, err)
+	}
+
+	// Don't wait on the publish token here; blocking inside a message
+	// handler stalls the client's incoming messages.
+	c.Publish(s.prefix+"/reply/"+device, s.qos, false, payload)
+}
+
+// serve returns the reply to msg, or why there isn't one. The errors of
+// decoding it are decodeErrors.
+func (s mqttSubscriber) serve(msg mqtt.Message) ([]byte, error) {
+	request, err := s.dec(s.ctx, msg)
+	if err != nil {
+		return nil, decodeError{err}
+	}
+	response, err := s.e(s.ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return s.enc(s.ctx, response)
+}
+
+// OnConnect subscribes to request topics. It's used as the client's connect
+// handler so subscriptions are restored after every reconnect.
+func (s mqttSubscriber) OnConnect(c mqtt.Client) {
+	if token := c.Subscribe(s.Topic(), s.qos, s.ServeMessage); token.Wait() && token.Error() != nil {
+		s.logger.Log("err", token.Error())
+		return
+	}
+	s.logger.Log("msg", "MQTT", "topic", s.Topic())
+}
+
+// MQTT messages carry the same JSON payloads as the HTTP transport.
+
+func decodeMQTTHelloRequest(_ context.Context, msg mqtt.Message) (interface{}, error) {
+	var request helloRequest
+	if err := json.Unmarshal(msg.Payload(), &request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func encodeMQTTResponse(_ context.Context, response interface{}) ([]byte, error) {
+	return json.Marshal(response)
+}
+
+// encodeMQTTError answers with err as a problem.
+func encodeMQTTError(_ context.Context, err error) []byte {
+	status, code, err := classifyEndpointError(err)
+	b, _ := json.Marshal(newProblem(status, code, err))
+	return b
+}
@@ -0,0 +1,98 @@
+package main
+
+// This file provides a NATS request/reply transport. Go Kit doesn't ship a
+// NATS transport, so natsSubscriber plays the part kithttp.Server plays for
+// HTTP: it decodes the message, invokes the endpoint, and encodes the
+// response, which is then published on the message's reply subject. A
+// request that fails is answered with the problem the HTTP transport would
+// answer it with, see problem.go.
+//
+// NATS messages carry no credentials, so the transport can't be used when
+// greeting needs them, see main.go.
+
+import (
+	"encoding/json"
+
+	"github.com/nats-io/go-nats"
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+)
+
+// natsDecodeRequestFunc extracts a user-domain request object from a NATS
+// message.
+type natsDecodeRequestFunc func(context.Context, *nats.Msg) (interface{}, error)
+
+// natsEncodeResponseFunc encodes the passed response object into the payload
+// published on the reply subject.
+type natsEncodeResponseFunc func(context.Context, interface{}) ([]byte, error)
+
+// natsEncodeErrorFunc encodes the error a request failed with into the
+// payload published on the reply subject.
+type natsEncodeErrorFunc func(context.Context, error) []byte
+
+type natsSubscriber struct {
+	ctx    context.Context
+	e      endpoint.Endpoint
+	dec    natsDecodeRequestFunc
+	enc    natsEncodeResponseFunc
+	errEnc natsEncodeErrorFunc
+	logger log.Logger
+}
+
+// ServeMsg returns a nats.MsgHandler that answers each request on the passed
+// connection.
+func (s natsSubscriber) ServeMsg(nc *nats.Conn) func(msg *nats.Msg) {
+	return func(msg *nats.Msg) {
+		if msg.Reply == "" {
+			// Nobody is waiting for an answer, so there's nothing to do.
+			return
+		}
+
+		payload, err := s.serve(msg)
+		if err != nil {
+			s.logger.Log("err", err)
+			payload = s.errEnc(s.ctx, err)
+		}
+
+		if err := nc.Publish(msg.Reply, payload); err != nil {
+			s.logger.Log("err", err)
+		}
+	}
+}
+
+// serve returns the reply to msg, or why there isn't one. The errors of
+// decoding it are decodeErrors.
+func (s natsSubscriber) serve(msg *nats.Msg) ([]byte, error) {
+	request, err := s.dec(s.ctx, msg)
+	if err != nil {
+		return nil, decodeError{err}
+	}
+	response, err := s.e(s.ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return s.enc(s.ctx, response)
+}
+
+// NATS messages carry the same JSON payloads as the HTTP transport.
+
+func decodeNATSHelloRequest(_ context.Context, msg *nats.Msg) (interface{}, error) {
+	var request helloRequest
+	if err := json.Unmarshal(msg.Data, &request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func encodeNATSResponse(_ context.Context, response interface{}) ([]byte, error) {
+	return json.Marshal(response)
+}
+
+// encodeNATSError answers with err as a problem.
+func encodeNATSError(_ context.Context, err error) []byte {
+	status, code, err := classifyEndpointError(err)
+	b, _ := json.Marshal(newProblem(status, code, err))
+	return b
+}
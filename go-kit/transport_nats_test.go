@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/nats-io/go-nats"
+	"golang.org/x/net/context"
+
+	log "github.com/go-kit/kit/log"
+)
+
+func TestNATSErrors(t *testing.T) {
+	hello := func(_ context.Context, request interface{}) (interface{}, error) {
+		switch name := request.(helloRequest).Name; name {
+		case "":
+			return nil, errNoName
+		case "fail":
+			return nil, errors.New("failed")
+		default:
+			return helloResponse{Greeting: "Hello, " + name}, nil
+		}
+	}
+	s := natsSubscriber{
+		ctx:    context.Background(),
+		e:      hello,
+		dec:    decodeNATSHelloRequest,
+		enc:    encodeNATSResponse,
+		errEnc: encodeNATSError,
+		logger: log.NewNopLogger(),
+	}
+	for name, tc := range map[string]struct {
+		data string
+		want problem
+	}{
+		"malformed": {`{"name": `, problem{Status: 400, Code: "malformed_request"}},
+		"no name":   {`{}`, problem{Status: 400, Code: "name_required", Detail: errNoName.Error()}},
+		"failed":    {`{"name": "fail"}`, problem{Status: 500, Code: "internal_server_error", Detail: internalDetail}},
+	} {
+		_, err := s.serve(&nats.Msg{Data: []byte(tc.data)})
+		if err == nil {
+			t.Errorf("%s: served", name)
+			continue
+		}
+		var got problem
+		if err := json.Unmarshal(s.errEnc(s.ctx, err), &got); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if tc.want.Detail == "" {
+			got.Detail = ""
+		}
+		got.Title = ""
+		if got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", name, got, tc.want)
+		}
+	}
+}
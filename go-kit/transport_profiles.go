@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// Profiles are managed as JSON over a small REST API:
+//
+//	POST   /profiles       create a profile, 409 if the user already has one
+//	GET    /profiles/{id}  fetch a profile
+//	PUT    /profiles/{id}  create or replace a profile
+//	DELETE /profiles/{id}  delete a profile
+//
+// e.g. {"user_id": "42", "preferred_name": "Aaron", "pronouns": "he/him",
+// "locale": "fr"}. Unknown profiles are a 404.
+
+// makeProfilesHandler returns a handler for /profiles and everything under it.
+// Preferred names longer than maxLen are refused.
+func makeProfilesHandler(az authz, store ProfileStore, maxLen int) http.Handler {
+	r := mux.NewRouter()
+	r.Methods("POST").Path("/profiles").Handler(kithttp.NewServer(
+		az.endpoint("profiles.write", makePostProfileEndpoint(store, maxLen)),
+		decodeErrors(decodePostProfileRequest),
+		makeEncodeProfileResponse(http.StatusCreated),
+		az.options()...,
+	))
+	r.Methods("GET").Path("/profiles/{id}").Handler(kithttp.NewServer(
+		az.endpoint("profiles.read", makeGetProfileEndpoint(store)),
+		decodeErrors(decodeGetProfileRequest),
+		makeEncodeProfileResponse(http.StatusOK),
+		az.options()...,
+	))
+	r.Methods("PUT").Path("/profiles/{id}").Handler(kithttp.NewServer(
+		az.endpoint("profiles.write", makePutProfileEndpoint(store, maxLen)),
+		decodeErrors(decodePutProfileRequest),
+		makeEncodeProfileResponse(http.StatusOK),
+		az.options()...,
+	))
+	r.Methods("DELETE").Path("/profiles/{id}").Handler(kithttp.NewServer(
+		az.endpoint("profiles.write", makeDeleteProfileEndpoint(store)),
+		decodeErrors(decodeDeleteProfileRequest),
+		makeEncodeProfileResponse(http.StatusNoContent),
+		az.options()...,
+	))
+	return r
+}
+
+func decodePostProfileRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var p profile
+	if err := decodeJSON(r.Body, &p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func decodeGetProfileRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return getProfileRequest{mux.Vars(r)["id"]}, nil
+}
+
+func decodePutProfileRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var p profile
+	if err := decodeJSON(r.Body, &p); err != nil {
+		return nil, err
+	}
+	return putProfileRequest{mux.Vars(r)["id"], p}, nil
+}
+
+func decodeDeleteProfileRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return deleteProfileRequest{mux.Vars(r)["id"]}, nil
+}
+
+// makeEncodeProfileResponse returns an encoder that answers with code, and the
+// profile if there is one, unless the endpoint failed.
+func makeEncodeProfileResponse(code int) kithttp.EncodeResponseFunc {
+	return func(_ context.Context, w http.ResponseWriter, response interface{}) error {
+		resp := response.(profileResponse)
+		if resp.Err != nil {
+			return writeProblem(w, resp.Err)
+		}
+		if resp.Profile == nil {
+			w.WriteHeader(code)
+			return nil
+		}
+		w.Header().Set("Content-Type", mediaTypeJSON)
+		w.WriteHeader(code)
+		return json.NewEncoder(w).Encode(resp.Profile)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// Scheduled greetings are managed as JSON:
+//
+//	POST   /greetings/schedule       schedule a greeting
+//	GET    /greetings/schedule/{id}  see how it's getting on
+//	DELETE /greetings/schedule/{id}  cancel it, 409 if it's already been sent
+//
+// e.g. {"name": "Aaron", "lang": "fr", "at": "2018-06-01T09:00:00+02:00"}.
+// Every answer is the scheduled greeting, with its id and status.
+
+// makeScheduleHandler returns a handler for /greetings/schedule and
+// everything under it.
+func makeScheduleHandler(az authz, s *greetScheduler) http.Handler {
+	r := mux.NewRouter()
+	r.Methods("POST").Path("/greetings/schedule").Handler(kithttp.NewServer(
+		az.endpoint("schedule.write", makeScheduleGreetingEndpoint(s)),
+		decodeErrors(decodeScheduleGreetingRequest),
+		makeEncodeScheduleResponse(http.StatusCreated),
+		az.options()...,
+	))
+	r.Methods("GET").Path("/greetings/schedule/{id}").Handler(kithttp.NewServer(
+		az.endpoint("schedule.read", makeGetScheduledGreetingEndpoint(s)),
+		decodeErrors(decodeGetScheduledGreetingRequest),
+		makeEncodeScheduleResponse(http.StatusOK),
+		az.options()...,
+	))
+	r.Methods("DELETE").Path("/greetings/schedule/{id}").Handler(kithttp.NewServer(
+		az.endpoint("schedule.write", makeCancelScheduledGreetingEndpoint(s)),
+		decodeErrors(decodeCancelScheduledGreetingRequest),
+		makeEncodeScheduleResponse(http.StatusOK),
+		az.options()...,
+	))
+	return r
+}
+
+func decodeScheduleGreetingRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var request scheduleGreetingRequest
+	if err := decodeJSON(r.Body, &request); err != nil {
+		return nil, err
+	}
+	request.Lang = preferredLanguage(ctx, r, request.Lang)
+	return request, nil
+}
+
+func decodeGetScheduledGreetingRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return getScheduledGreetingRequest{mux.Vars(r)["id"]}, nil
+}
+
+func decodeCancelScheduledGreetingRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return cancelScheduledGreetingRequest{mux.Vars(r)["id"]}, nil
+}
+
+// makeEncodeScheduleResponse returns an encoder that answers with code and the
+// scheduled greeting, unless the endpoint failed.
+func makeEncodeScheduleResponse(code int) kithttp.EncodeResponseFunc {
+	return func(_ context.Context, w http.ResponseWriter, response interface{}) error {
+		resp := response.(scheduleResponse)
+		if resp.Err != nil {
+			return writeProblem(w, resp.Err)
+		}
+		w.Header().Set("Content-Type", mediaTypeJSON)
+		w.WriteHeader(code)
+		return json.NewEncoder(w).Encode(resp.Scheduled)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+// This file provides a Server-Sent Events stream of greetings at
+// /hello/stream. Every call to Hello, on any transport, shows up as an event:
+// curl -N http://localhost:8080/hello/stream
+//
+// Each event carries an id, so a client that reconnects with a Last-Event-ID
+// header is sent the events it missed, as long as they're still retained by
+// the broker; one that connects without it only gets what happens from then
+// on. IDs from before a restart are told apart, see events.go. The stream shows who's being greeted as it happens, so it
+// needs the history.read permission, like GET /greetings; see rbac.go.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/go-kit/kit/log"
+)
+
+var errStreamingUnsupported = errors.New("streaming unsupported")
+
+type sseHandler struct {
+	broker    *greetingBroker
+	heartbeat time.Duration
+	logger    log.Logger
+}
+
+// ServeHTTP implements http.Handler.
+func (h sseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeProblem(w, errStreamingUnsupported)
+		return
+	}
+
+	missed, events, err := h.broker.Subscribe(r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		writeProblem(w, err)
+		return
+	}
+	defer h.broker.Unsubscribe(events)
+	liftDeadlines(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, e := range missed {
+		if err := writeSSEEvent(w, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	// Heartbeats are SSE comments, which clients ignore, but they stop idle
+	// connections from being closed by proxies along the way.
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e := <-events:
+			if err := writeSSEEvent(w, e); err != nil {
+				requestLogger(r.Context(), h.logger).Log("err", err)
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeSSEEvent(w http.ResponseWriter, e greetingEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: greeting\ndata: %s\n\n", e.ID, data)
+	return err
+}
@@ -0,0 +1,21 @@
+package main
+
+// GET /stats summarizes what the service has been up to since it started, e.g.
+// {"since": "...", "total": 3, "errors": 1, "methods": {"hello": 3},
+// "languages": {"en": 2}, "unique_names": 2}
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"golang.org/x/net/context"
+)
+
+func decodeStatsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return statsRequest{}, nil
+}
+
+func encodeStatsResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	return json.NewEncoder(w).Encode(response)
+}
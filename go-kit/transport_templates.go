@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// The service's templates are managed as JSON:
+//
+//	GET    /admin/templates                          the templates in use
+//	POST   /admin/templates                          add a template, 409 if there's one
+//	POST   /admin/templates/preview                  render a template without storing it
+//	GET    /admin/templates/{method}/{lang}          fetch a template
+//	PUT    /admin/templates/{method}/{lang}          add a new version of a template
+//	DELETE /admin/templates/{method}/{lang}          delete a template
+//	GET    /admin/templates/{method}/{lang}/versions every version of a template
+//	POST   /admin/templates/{method}/{lang}/rollback go back to an earlier version
+//
+// e.g. {"method": "hello", "lang": "en", "template": "Hi, {{.Name}}"} to add
+// one, {"template": [{"text": "Hi, {{.Name}}", "weight": 3}]} to change it,
+// and {"version": 1} to roll back. A preview is
+// {"method": "hello", "lang": "en", "name": "Aaron", "template": ...}, and
+// previews the stored template if there's no template; the answer has every
+// variant rendered. A template that doesn't compile is a 400.
+
+// makeTemplatesHandler returns a handler for /admin/templates and everything
+// under it.
+func makeTemplatesHandler(az authz, store *templateStore) http.Handler {
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/admin/templates").Handler(kithttp.NewServer(
+		az.endpoint("templates.read", makeListTemplatesEndpoint(store)),
+		decodeErrors(decodeListTemplatesRequest),
+		makeEncodeTemplateResponse(http.StatusOK),
+		az.options()...,
+	))
+	r.Methods("POST").Path("/admin/templates").Handler(kithttp.NewServer(
+		az.endpoint("templates.write", makeCreateTemplateEndpoint(store)),
+		decodeErrors(decodeCreateTemplateRequest),
+		makeEncodeTemplateResponse(http.StatusCreated),
+		az.options()...,
+	))
+	r.Methods("POST").Path("/admin/templates/preview").Handler(kithttp.NewServer(
+		az.endpoint("templates.read", makePreviewTemplateEndpoint(store)),
+		decodeErrors(decodePreviewTemplateRequest),
+		makeEncodeTemplateResponse(http.StatusOK),
+		az.options()...,
+	))
+	r.Methods("GET").Path("/admin/templates/{method}/{lang}").Handler(kithttp.NewServer(
+		az.endpoint("templates.read", makeGetTemplateEndpoint(store)),
+		decodeErrors(decodeTemplateKeyRequest),
+		makeEncodeTemplateResponse(http.StatusOK),
+		az.options()...,
+	))
+	r.Methods("PUT").Path("/admin/templates/{method}/{lang}").Handler(kithttp.NewServer(
+		az.endpoint("templates.write", makePutTemplateEndpoint(store)),
+		decodeErrors(decodePutTemplateRequest),
+		makeEncodeTemplateResponse(http.StatusOK),
+		az.options()...,
+	))
+	r.Methods("DELETE").Path("/admin/templates/{method}/{lang}").Handler(kithttp.NewServer(
+		az.endpoint("templates.write", makeDeleteTemplateEndpoint(store)),
+		decodeErrors(decodeTemplateKeyRequest),
+		makeEncodeTemplateResponse(http.StatusNoContent),
+		az.options()...,
+	))
+	r.Methods("GET").Path("/admin/templates/{method}/{lang}/versions").Handler(kithttp.NewServer(
+		az.endpoint("templates.read", makeTemplateVersionsEndpoint(store)),
+		decodeErrors(decodeTemplateKeyRequest),
+		makeEncodeTemplateResponse(http.StatusOK),
+		az.options()...,
+	))
+	r.Methods("POST").Path("/admin/templates/{method}/{lang}/rollback").Handler(kithttp.NewServer(
+		az.endpoint("templates.write", makeRollbackTemplateEndpoint(store)),
+		decodeErrors(decodeRollbackTemplateRequest),
+		makeEncodeTemplateResponse(http.StatusOK),
+		az.options()...,
+	))
+	return r
+}
+
+func decodeListTemplatesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return listTemplatesRequest{}, nil
+}
+
+func decodeCreateTemplateRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request templateRequest
+	if err := decodeJSON(r.Body, &request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodePreviewTemplateRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request previewTemplateRequest
+	if err := decodeJSON(r.Body, &request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeTemplateKeyRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	return templateKeyRequest{vars["method"], vars["lang"]}, nil
+}
+
+// The method and language in the path win over any in a PUT body.
+func decodePutTemplateRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request templateRequest
+	if err := decodeJSON(r.Body, &request); err != nil {
+		return nil, err
+	}
+	vars := mux.Vars(r)
+	request.Method, request.Lang = vars["method"], vars["lang"]
+	return request, nil
+}
+
+func decodeRollbackTemplateRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request rollbackTemplateRequest
+	if err := decodeJSON(r.Body, &request); err != nil {
+		return nil, err
+	}
+	vars := mux.Vars(r)
+	request.Method, request.Lang = vars["method"], vars["lang"]
+	return request, nil
+}
+
+// makeEncodeTemplateResponse returns an encoder that answers with code, and
+// the body if there is one, unless the endpoint failed.
+func makeEncodeTemplateResponse(code int) kithttp.EncodeResponseFunc {
+	return func(_ context.Context, w http.ResponseWriter, response interface{}) error {
+		resp := response.(templateResponse)
+		if resp.Err != nil {
+			return writeProblem(w, resp.Err)
+		}
+		if resp.Body == nil {
+			w.WriteHeader(code)
+			return nil
+		}
+		w.Header().Set("Content-Type", mediaTypeJSON)
+		w.WriteHeader(code)
+		return json.NewEncoder(w).Encode(resp.Body)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// Tenants are managed as JSON, the same way as profiles:
+//
+//	POST   /tenants       create a tenant, 409 if there's one with the ID
+//	GET    /tenants/{id}  fetch a tenant
+//	PUT    /tenants/{id}  create or replace a tenant
+//	DELETE /tenants/{id}  delete a tenant
+//
+// e.g. {"id": "acme", "api_keys": ["s3cret"], "locale": "de", "rate_limit": 10,
+// "templates": {"hello": {"de": "Willkommen bei ACME, {{.Name}}"}}}. A
+// template that doesn't compile is a 400.
+
+// makeTenantsHandler returns a handler for /tenants and everything under it.
+// A deleted tenant's limiter goes from limiters.
+func makeTenantsHandler(az authz, store TenantStore, limiters *tenantLimiters) http.Handler {
+	r := mux.NewRouter()
+	r.Methods("POST").Path("/tenants").Handler(kithttp.NewServer(
+		az.endpoint("tenants.write", makePostTenantEndpoint(store)),
+		decodeErrors(decodePostTenantRequest),
+		makeEncodeTenantResponse(http.StatusCreated),
+		az.options()...,
+	))
+	r.Methods("GET").Path("/tenants/{id}").Handler(kithttp.NewServer(
+		az.endpoint("tenants.read", makeGetTenantEndpoint(store)),
+		decodeErrors(decodeGetTenantRequest),
+		makeEncodeTenantResponse(http.StatusOK),
+		az.options()...,
+	))
+	r.Methods("PUT").Path("/tenants/{id}").Handler(kithttp.NewServer(
+		az.endpoint("tenants.write", makePutTenantEndpoint(store)),
+		decodeErrors(decodePutTenantRequest),
+		makeEncodeTenantResponse(http.StatusOK),
+		az.options()...,
+	))
+	r.Methods("DELETE").Path("/tenants/{id}").Handler(kithttp.NewServer(
+		az.endpoint("tenants.write", makeDeleteTenantEndpoint(store, limiters)),
+		decodeErrors(decodeDeleteTenantRequest),
+		makeEncodeTenantResponse(http.StatusNoContent),
+		az.options()...,
+	))
+	return r
+}
+
+func decodePostTenantRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var t tenant
+	if err := decodeJSON(r.Body, &t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func decodeGetTenantRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return getTenantRequest{mux.Vars(r)["id"]}, nil
+}
+
+func decodePutTenantRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var t tenant
+	if err := decodeJSON(r.Body, &t); err != nil {
+		return nil, err
+	}
+	return putTenantRequest{mux.Vars(r)["id"], t}, nil
+}
+
+func decodeDeleteTenantRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return deleteTenantRequest{mux.Vars(r)["id"]}, nil
+}
+
+// makeEncodeTenantResponse returns an encoder that answers with code, and the
+// tenant if there is one, unless the endpoint failed.
+func makeEncodeTenantResponse(code int) kithttp.EncodeResponseFunc {
+	return func(_ context.Context, w http.ResponseWriter, response interface{}) error {
+		resp := response.(tenantResponse)
+		if resp.Err != nil {
+			return writeProblem(w, resp.Err)
+		}
+		if resp.Tenant == nil {
+			w.WriteHeader(code)
+			return nil
+		}
+		w.Header().Set("Content-Type", mediaTypeJSON)
+		w.WriteHeader(code)
+		return json.NewEncoder(w).Encode(resp.Tenant)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+// This file provides server-side bindings for the Thrift transport. The
+// generated code lives in thrift/gen-go/greet and comes from thrift/greet.thrift.
+//
+// Go Kit doesn't have a transport/thrift package yet, so instead of a Server
+// type we implement the generated GreetService interface ourselves and call
+// the endpoint directly.
+//
+// Thrift calls carry no credentials, so with -jwt.jwks, -oidc.issuer or
+// -apikeys.required set every one of them is refused as unauthorized.
+
+import (
+	"net"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+
+	thriftgreet "github.com/naunga/monolith/go-kit/thrift/gen-go/greet"
+)
+
+// makeThriftHandler makes the hello endpoint, behind m, available as a Thrift
+// service.
+func makeThriftHandler(svc GreetService, m endpoint.Middleware) thriftgreet.GreetService {
+	return &thriftServer{
+		hello: m(makeHelloEndpoint(svc)),
+	}
+}
+
+type thriftServer struct {
+	hello endpoint.Endpoint
+}
+
+func (s *thriftServer) Hello(ctx context.Context, name string) (*thriftgreet.HelloReply, error) {
+	ctx = context.WithValue(ctx, callerKey, caller{Transport: "thrift"})
+	request := helloRequest{Name: name}
+	response, err := s.hello(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(helloResponse)
+	return &thriftgreet.HelloReply{Greeting: resp.Greeting, Err: err2str(resp.Err)}, nil
+}
+
+// listenerTransport is a thrift.TServerTransport accepting connections from a
+// listener, which Thrift's own TServerSocket can't be given, so the Thrift
+// server can serve on one that was passed to the process, see listen.go.
+type listenerTransport struct {
+	ln net.Listener
+}
+
+func (t listenerTransport) Listen() error {
+	return nil
+}
+
+func (t listenerTransport) Accept() (thrift.TTransport, error) {
+	conn, err := t.ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return thrift.NewTSocketFromConnTimeout(conn, 0), nil
+}
+
+func (t listenerTransport) Close() error {
+	return t.ln.Close()
+}
+
+func (t listenerTransport) Interrupt() error {
+	return t.ln.Close()
+}
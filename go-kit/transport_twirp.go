@@ -0,0 +1,185 @@
+package main
+
+// This file serves GreetService over the Twirp protocol. Twirp is protobuf
+// (or JSON) over plain HTTP POSTs, one route per method, so a kithttp.Server
+// with the right codecs is all it takes. Clients generate their own stubs from
+// pb/greet.proto with protoc-gen-twirp in whatever language they use:
+// curl -X POST -H "Content-Type: application/json" -d '{"name": "Aaron"}' http://localhost:8080/twirp/pb.Greet/Hello
+//
+// Errors, the service's as well as the transport's, are answered as Twirp
+// errors, with the Twirp code that fits and its HTTP status:
+//
+//	HTTP/1.1 400 Bad Request
+//	Content-Type: application/json
+//
+//	{"code": "invalid_argument", "msg": "no name provided"}
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"github.com/naunga/monolith/go-kit/pb"
+
+	log "github.com/go-kit/kit/log"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// twirpPrefix is where Twirp clients expect to find the Greet service.
+const twirpPrefix = "/twirp/pb.Greet/"
+
+// twirpError is the error model Twirp clients understand. Code is one of the
+// error codes from the Twirp specification, and Meta says more, such as the
+// argument an invalid_argument is about.
+type twirpError struct {
+	Code string            `json:"code"`
+	Msg  string            `json:"msg"`
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+func (e twirpError) Error() string {
+	return e.Code + ": " + e.Msg
+}
+
+// makeTwirpHandler returns a handler serving every Greet method under
+// twirpPrefix.
+func makeTwirpHandler(svc GreetService, logger log.Logger) http.Handler {
+	options := []kithttp.ServerOption{
+		kithttp.ServerBefore(headersToContext),
+		kithttp.ServerErrorLogger(logger),
+		kithttp.ServerErrorEncoder(encodeTwirpError),
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(twirpPrefix+"Hello", kithttp.NewServer(
+		makeHelloEndpoint(svc),
+		decodeErrors(decodeTwirpHelloRequest),
+		encodeTwirpHelloResponse,
+		options...,
+	))
+	mux.HandleFunc(twirpPrefix, func(w http.ResponseWriter, r *http.Request) {
+		writeTwirpError(w, twirpError{Code: "bad_route", Msg: "no handler for path " + r.URL.Path})
+	})
+	return mux
+}
+
+func decodeTwirpHelloRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	if r.Method != "POST" {
+		return nil, twirpError{Code: "bad_route", Msg: "unsupported method " + r.Method}
+	}
+
+	var req pb.HelloRequest
+	switch mediaType(r.Header.Get("Content-Type")) {
+	case "application/protobuf":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, twirpError{Code: "malformed", Msg: err.Error()}
+		}
+		if err := proto.Unmarshal(body, &req); err != nil {
+			return nil, twirpError{Code: "malformed", Msg: err.Error()}
+		}
+	case "application/json":
+		if err := jsonpb.Unmarshal(r.Body, &req); err != nil {
+			return nil, twirpError{Code: "malformed", Msg: err.Error()}
+		}
+	default:
+		return nil, twirpError{Code: "bad_route", Msg: "unexpected Content-Type " + r.Header.Get("Content-Type")}
+	}
+
+	return newHelloRequest(&req), nil
+}
+
+func encodeTwirpHelloResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(helloResponse)
+	if resp.Err != nil {
+		writeTwirpError(w, newTwirpError(resp.Err))
+		return nil
+	}
+	reply := &pb.HelloReply{Greeting: resp.Greeting}
+
+	// Replies are sent in the same encoding as the request.
+	contentType, _ := ctx.Value(contentTypeKey).(string)
+	w.Header().Set("Content-Type", contentType)
+	if contentType == "application/protobuf" {
+		b, err := proto.Marshal(reply)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	m := jsonpb.Marshaler{OrigName: true}
+	return m.Marshal(w, reply)
+}
+
+func encodeTwirpError(_ context.Context, err error, w http.ResponseWriter) {
+	if e, ok := err.(decodeError); ok {
+		err = e.err
+	}
+	writeTwirpError(w, newTwirpError(err))
+}
+
+// twirpCodes are the Twirp codes of the statuses classifyError gives errors.
+var twirpCodes = map[int]string{
+	http.StatusBadRequest:            "invalid_argument",
+	http.StatusUnauthorized:          "unauthenticated",
+	http.StatusForbidden:             "permission_denied",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "already_exists",
+	http.StatusRequestEntityTooLarge: "out_of_range",
+	http.StatusTooManyRequests:       "resource_exhausted",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusGatewayTimeout:        "deadline_exceeded",
+}
+
+// twirpStatuses are the HTTP statuses of the Twirp codes, from the Twirp
+// specification.
+var twirpStatuses = map[string]int{
+	"canceled":            http.StatusRequestTimeout,
+	"invalid_argument":    http.StatusBadRequest,
+	"malformed":           http.StatusBadRequest,
+	"deadline_exceeded":   http.StatusRequestTimeout,
+	"not_found":           http.StatusNotFound,
+	"bad_route":           http.StatusNotFound,
+	"already_exists":      http.StatusConflict,
+	"permission_denied":   http.StatusForbidden,
+	"unauthenticated":     http.StatusUnauthorized,
+	"resource_exhausted":  http.StatusTooManyRequests,
+	"failed_precondition": http.StatusPreconditionFailed,
+	"aborted":             http.StatusConflict,
+	"out_of_range":        http.StatusBadRequest,
+	"unimplemented":       http.StatusNotImplemented,
+	"unavailable":         http.StatusServiceUnavailable,
+}
+
+// newTwirpError returns err as a Twirp error, with the code that fits the
+// status classifyError gives it, or internal.
+func newTwirpError(err error) twirpError {
+	if te, ok := err.(twirpError); ok {
+		return te
+	}
+	status, _ := classifyError(err)
+	code, ok := twirpCodes[status]
+	if !ok {
+		code = "internal"
+	}
+	te := twirpError{Code: code, Msg: err.Error()}
+	if e, ok := err.(validationError); ok && e.Field != "" {
+		te.Meta = map[string]string{"argument": e.Field}
+	}
+	return te
+}
+
+func writeTwirpError(w http.ResponseWriter, e twirpError) {
+	status, ok := twirpStatuses[e.Code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	log "github.com/go-kit/kit/log"
+)
+
+func TestTwirpErrors(t *testing.T) {
+	h := makeTwirpHandler(greetService{}, log.NewNopLogger())
+	for name, tc := range map[string]struct {
+		method, path, contentType, body string
+		status                          int
+		want                            twirpError
+	}{
+		"no name": {
+			"POST", twirpPrefix + "Hello", "application/json", `{}`,
+			http.StatusBadRequest, twirpError{Code: "invalid_argument", Msg: errNoName.Error()},
+		},
+		"malformed": {
+			"POST", twirpPrefix + "Hello", "application/json", `{"name": `,
+			http.StatusBadRequest, twirpError{Code: "malformed"},
+		},
+		"wrong method": {
+			"GET", twirpPrefix + "Hello", "application/json", ``,
+			http.StatusNotFound, twirpError{Code: "bad_route", Msg: "unsupported method GET"},
+		},
+		"wrong content type": {
+			"POST", twirpPrefix + "Hello", "text/plain", `Ada`,
+			http.StatusNotFound, twirpError{Code: "bad_route", Msg: "unexpected Content-Type text/plain"},
+		},
+		"unknown method": {
+			"POST", twirpPrefix + "Goodbye", "application/json", `{}`,
+			http.StatusNotFound, twirpError{Code: "bad_route", Msg: "no handler for path " + twirpPrefix + "Goodbye"},
+		},
+	} {
+		r := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		r.Header.Set("Content-Type", tc.contentType)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.status {
+			t.Errorf("%s: status %d, want %d", name, w.Code, tc.status)
+		}
+		var got twirpError
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if tc.want.Msg == "" {
+			got.Msg = ""
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+// This file provides a WebSocket transport. A client opens /hello/ws and can
+// then send any number of JSON hello requests over the socket; each one is
+// answered with a JSON hello response on the same socket. A message can be no
+// longer than an HTTP request's body, -http.body.max; a longer one closes the
+// connection.
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/context"
+
+	"github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+)
+
+// wsDecodeRequestFunc extracts a user-domain request object from a single
+// WebSocket message.
+type wsDecodeRequestFunc func(context.Context, io.Reader) (interface{}, error)
+
+// wsEncodeResponseFunc writes the passed response object to the socket.
+type wsEncodeResponseFunc func(context.Context, *websocket.Conn, interface{}) error
+
+type wsServer struct {
+	e        endpoint.Endpoint
+	dec      wsDecodeRequestFunc
+	enc      wsEncodeResponseFunc
+	upgrader websocket.Upgrader
+	// readLimit is the most bytes a message can have, or 0 for no limit.
+	readLimit int64
+	logger    log.Logger
+}
+
+// wsError is sent back over the socket when a message can't be answered, so
+// one bad message doesn't cost the client its connection.
+type wsError struct {
+	Err string `json:"err"`
+}
+
+// ServeHTTP implements http.Handler, upgrading the connection and serving
+// requests on it until the client goes away.
+func (s wsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := requestLogger(ctx, s.logger)
+	liftDeadlines(w)
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an HTTP error to the client.
+		logger.Log("err", err)
+		return
+	}
+	defer conn.Close()
+	if s.readLimit > 0 {
+		conn.SetReadLimit(s.readLimit)
+	}
+
+	for {
+		_, msg, err := conn.NextReader()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.Log("err", err)
+			}
+			return
+		}
+
+		request, err := s.dec(ctx, msg)
+		if err != nil {
+			logger.Log("err", err)
+			if err := conn.WriteJSON(wsError{err.Error()}); err != nil {
+				return
+			}
+			continue
+		}
+
+		response, err := s.e(ctx, request)
+		if err != nil {
+			logger.Log("err", err)
+			if err := conn.WriteJSON(wsError{err.Error()}); err != nil {
+				return
+			}
+			continue
+		}
+
+		if err := s.enc(ctx, conn, response); err != nil {
+			logger.Log("err", err)
+			return
+		}
+	}
+}
+
+// Each message holds the same JSON the HTTP transport expects in a request
+// body, so we can decode it the same way.
+
+func decodeWSHelloRequest(_ context.Context, msg io.Reader) (interface{}, error) {
+	return decodeHelloJSON(msg)
+}
+
+func encodeWSResponse(_ context.Context, conn *websocket.Conn, response interface{}) error {
+	return conn.WriteJSON(response)
+}
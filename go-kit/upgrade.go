@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A SIGUSR2 upgrades the service in place: it starts the binary it was
+// started from again, new by now, with the same arguments and environment,
+// and passes it the sockets it's listening on, the way systemd passes them,
+// see listen.go, so the new process serves on them without binding anything
+// and nothing that connects in between is refused. Once the new process is
+// ready, the old one shuts down as it would on a SIGTERM, answering the
+// requests it's already got, but leaves it registered, see register.go,
+// since the new process has registered itself in its place. If the new
+// process doesn't get ready within -upgrade.timeout, or exits, the old one
+// goes on as it was.
+//
+//	cp greet /usr/local/bin/greet && kill -USR2 $(pidof greet)
+//
+// Something that supervises the service by its process ID has to be told
+// it's changed.
+
+// upgradeParentEnv says what process an upgrade's listeners were passed by,
+// instead of LISTEN_PID, which can't be known before the process is started.
+const upgradeParentEnv = "LISTEN_PARENT_PID"
+
+// upgradeParentName is the name of the pipe the process being upgraded is
+// told the new one is ready over.
+const upgradeParentName = "upgrade"
+
+// errUpgraded is what the old process shuts down with once it's been
+// upgraded.
+var errUpgraded = errors.New("upgraded")
+
+// upgrade starts the process again, passing it the listeners, and waits up to
+// timeout for it to be ready.
+func (l *inheritedListeners) upgrade(timeout time.Duration) (*os.Process, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	names := make([]string, 0, len(l.listening))
+	for name := range l.listening {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, name := range names {
+		ln, ok := l.listening[name].(interface {
+			File() (*os.File, error)
+		})
+		if !ok {
+			l.mu.Unlock()
+			return nil, fmt.Errorf("can't pass on the %s listener", name)
+		}
+		f, err := ln.File()
+		if err != nil {
+			l.mu.Unlock()
+			return nil, fmt.Errorf("%s listener: %v", name, err)
+		}
+		files = append(files, f)
+	}
+	l.mu.Unlock()
+
+	ready, notify, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer ready.Close()
+	files = append(files, notify)
+	names = append(names, upgradeParentName)
+
+	env := append(os.Environ(),
+		upgradeParentEnv+"="+strconv.Itoa(os.Getpid()),
+		"LISTEN_FDS="+strconv.Itoa(len(files)),
+		"LISTEN_FDNAMES="+strings.Join(names, ":"),
+	)
+	p, err := os.StartProcess(path, os.Args, &os.ProcAttr{
+		Env:   env,
+		Files: append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, files...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Only the new process has the pipe open to write to now, so reading
+	// it ends if it exits.
+	notify.Close()
+	files = files[:len(files)-1]
+
+	ready.SetReadDeadline(time.Now().Add(timeout))
+	if _, err := ready.Read(make([]byte, 1)); err != nil {
+		p.Kill()
+		go p.Wait()
+		return nil, fmt.Errorf("new process not ready: %v", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.upgraded = true
+	for _, ln := range l.listening {
+		// The new process is listening on the socket now, so closing the
+		// old one's listener mustn't remove it.
+		if ln, ok := ln.(*net.UnixListener); ok {
+			ln.SetUnlinkOnClose(false)
+		}
+	}
+	return p, nil
+}
+
+// ready tells the process being upgraded, if this is an upgrade, that it's
+// ready.
+func (l *inheritedListeners) ready() error {
+	if l.parent == nil {
+		return nil
+	}
+	defer l.parent.Close()
+	_, err := l.parent.Write([]byte{1})
+	return err
+}
+
+// handedOff says whether the process has been upgraded.
+func (l *inheritedListeners) handedOff() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.upgraded
+}
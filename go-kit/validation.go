@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/net/context"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Names are cleaned up and checked before they're greeted: surrounding
+// whitespace is trimmed, runs of whitespace inside are collapsed to a single
+// space, and the result is NFC normalized, so that the same name always looks
+// the same. Names that are too long, or have anything other than letters,
+// marks, spaces and a little punctuation in them, are rejected.
+
+// defaultNameMaxLen is the longest name we greet, unless told otherwise.
+const defaultNameMaxLen = 100
+
+// maxTitleLen is the longest title a name can be given.
+const maxTitleLen = 20
+
+// validationError describes a request we won't serve. HTTP transports answer
+// it with a 400 problem, with Reason as its code; see problem.go.
+type validationError struct {
+	Field   string `json:"field"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (e validationError) Error() string {
+	return e.Message
+}
+
+// canonicalName returns the canonical form of name, or a validationError if
+// it's no good. An empty name is left for the service to complain about.
+func canonicalName(name string, maxLen int) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", validationError{"name", "invalid_utf8", "name is not valid UTF-8"}
+	}
+	name = norm.NFC.String(strings.Join(strings.Fields(name), " "))
+	if n := utf8.RuneCountInString(name); n > maxLen {
+		return "", validationError{"name", "too_long", fmt.Sprintf("name is %d characters long, the limit is %d", n, maxLen)}
+	}
+	for _, r := range name {
+		if !allowedNameRune(r) {
+			return "", validationError{"name", "invalid_character", fmt.Sprintf("name may not contain %q", r)}
+		}
+	}
+	return name, nil
+}
+
+// withField returns err as a complaint about field instead of the name, if
+// it's one of canonicalName's, for checking other things the way names are
+// checked.
+func withField(err error, field string) error {
+	if verr, ok := err.(validationError); ok && verr.Field == "name" {
+		verr.Field = field
+		verr.Message = field + strings.TrimPrefix(verr.Message, "name")
+		return verr
+	}
+	return err
+}
+
+func allowedNameRune(r rune) bool {
+	switch {
+	case unicode.IsLetter(r), unicode.IsMark(r):
+		return true
+	case r == ' ', r == '-', r == '.', r == '\'', r == '’':
+		return true
+	}
+	return false
+}
+
+// validatingMiddleware canonicalizes names, and titles, before passing them
+// on, and rejects the ones canonicalName won't accept.
+type validatingMiddleware struct {
+	maxLen int
+	next   GreetService
+}
+
+func (mw validatingMiddleware) Hello(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.validate(ctx, s, opts, mw.next.Hello)
+}
+
+func (mw validatingMiddleware) Goodbye(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.validate(ctx, s, opts, mw.next.Goodbye)
+}
+
+func (mw validatingMiddleware) validate(ctx context.Context, s string, opts GreetOptions, call greetMethod) (Greeting, error) {
+	s, err := canonicalName(s, mw.maxLen)
+	if err != nil {
+		return Greeting{}, err
+	}
+	if opts.Title, err = canonicalName(opts.Title, maxTitleLen); err != nil {
+		return Greeting{}, withField(err, "title")
+	}
+	return call(ctx, s, opts)
+}
+
+// Requests can also declare rules for their fields, in validate struct tags
+// (see github.com/go-playground/validator), which validateRequest checks
+// before the endpoint sees them. A tz tag checks a time zone the way
+// parseLocation reads it. The first field that breaks a rule is answered with
+// a validationError, under its JSON name.
+
+var requestValidator = newRequestValidator()
+
+func newRequestValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "" || name == "-" {
+			return f.Name
+		}
+		return name
+	})
+	v.RegisterValidation("tz", func(fl validator.FieldLevel) bool {
+		_, err := parseLocation(fl.Field().String())
+		return err == nil
+	})
+	return v
+}
+
+// validateRequest is an endpoint.Middleware that fails calls whose request
+// breaks the rules in its struct tags with a validationError.
+func validateRequest(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if err := checkRequest(request); err != nil {
+			return nil, err
+		}
+		return next(ctx, request)
+	}
+}
+
+// checkRequest checks request against its struct tags. Requests that aren't
+// structs have no rules.
+func checkRequest(request interface{}) error {
+	if reflect.Indirect(reflect.ValueOf(request)).Kind() != reflect.Struct {
+		return nil
+	}
+	err := requestValidator.Struct(request)
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok || len(errs) == 0 {
+		return err
+	}
+	return ruleError(errs[0])
+}
+
+// ruleError describes the rule a field broke, the way validationErrors
+// describe everything else.
+func ruleError(fe validator.FieldError) validationError {
+	field := fe.Field()
+	switch fe.Tag() {
+	case "required":
+		return validationError{field, "required", field + " is required"}
+	case "max":
+		return validationError{field, "too_long", fmt.Sprintf("%s is longer than the limit of %s", field, fe.Param())}
+	case "oneof":
+		return validationError{field, "invalid_" + field, fmt.Sprintf("%s must be one of %s, not %q", field, strings.Join(strings.Fields(fe.Param()), ", "), fe.Value())}
+	case "tz":
+		return validationError{field, "invalid_" + field, fmt.Sprintf("%s is not a time zone or UTC offset", field)}
+	}
+	return validationError{field, "invalid_" + field, fmt.Sprintf("%s breaks the %s rule", field, fe.Tag())}
+}
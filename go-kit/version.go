@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// What's deployed is set when the service is built,
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+//
+// and, for whatever isn't, taken from what the go command stamps the binary
+// with. It's logged at startup, and GET /version answers with it:
+//
+//	{"version": "1.4.0", "commit": "1b2c3d4...", "build_date": "2018-06-01T12:00:00Z", "go": "go1.22.1"}
+
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+// buildInfo is what's deployed.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	Go        string `json:"go"`
+}
+
+// readBuildInfo returns what's deployed.
+func readBuildInfo() buildInfo {
+	info := buildInfo{Version: version, Commit: commit, BuildDate: buildDate, Go: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
+
+// keyvals returns info as keyvals to log.
+func (info buildInfo) keyvals() []interface{} {
+	return []interface{}{"version", info.Version, "commit", info.Commit, "build_date", info.BuildDate, "go", info.Go}
+}
+
+// versionHandler serves /version.
+type versionHandler struct {
+	info buildInfo
+}
+
+// ServeHTTP implements http.Handler.
+func (h versionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	json.NewEncoder(w).Encode(h.info)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	log "github.com/go-kit/kit/log"
+)
+
+// With -webhook.urls set, every successful greeting is POSTed as JSON to each
+// of the URLs, e.g.
+//
+//	{"id": "...", "type": "hello", "name": "Aaron", "greeting": "Hello there, Aaron", "lang": "en", "time": "..."}
+//
+// Deliveries happen in the background, so a slow receiver doesn't slow the
+// service down. A delivery that fails, or gets a 5xx or 429 back, is retried
+// with a backoff; any other answer is final. With -webhook.secret set, each
+// request has an X-Webhook-Signature header of "sha256=" and the hex HMAC-SHA256
+// of the body, keyed by the secret, so receivers can tell it came from us.
+
+const (
+	// webhookQueue is how many events can wait for delivery before new ones
+	// are dropped.
+	webhookQueue = 1000
+
+	// webhookWorkers is how many deliveries are made at once.
+	webhookWorkers = 4
+
+	// webhookBackoff is the wait before the first retry. It doubles for each
+	// retry after that.
+	webhookBackoff = time.Second
+)
+
+// webhookEvent is what's sent to the webhooks.
+type webhookEvent struct {
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	Name     string    `json:"name"`
+	Greeting string    `json:"greeting"`
+	Lang     string    `json:"lang"`
+	Time     time.Time `json:"time"`
+}
+
+// webhookSender delivers events to a set of webhook URLs.
+type webhookSender struct {
+	urls    []string
+	secret  []byte
+	client  *http.Client
+	retries int
+	logger  log.Logger
+	queue   chan webhookEvent
+}
+
+// newWebhookSender starts delivering events sent with Send.
+func newWebhookSender(urls []string, secret string, timeout time.Duration, retries int, logger log.Logger) *webhookSender {
+	s := &webhookSender{
+		urls:    urls,
+		secret:  []byte(secret),
+		client:  &http.Client{Timeout: timeout},
+		retries: retries,
+		logger:  logger,
+		queue:   make(chan webhookEvent, webhookQueue),
+	}
+	for i := 0; i < webhookWorkers; i++ {
+		go s.work()
+	}
+	return s
+}
+
+// Send queues e for delivery, or drops it if the queue is full.
+func (s *webhookSender) Send(e webhookEvent) {
+	select {
+	case s.queue <- e:
+	default:
+		s.logger.Log("msg", "webhook queue full, dropping event", "id", e.ID)
+	}
+}
+
+func (s *webhookSender) work() {
+	for e := range s.queue {
+		body, err := json.Marshal(e)
+		if err != nil {
+			s.logger.Log("err", err)
+			continue
+		}
+		for _, url := range s.urls {
+			if err := s.deliver(url, e.ID, body); err != nil {
+				s.logger.Log("msg", "webhook delivery failed", "url", url, "id", e.ID, "err", err)
+			}
+		}
+	}
+}
+
+// deliver POSTs body to url, retrying as many times as it's allowed to.
+func (s *webhookSender) deliver(url, id string, body []byte) error {
+	backoff := webhookBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		if retry, err = s.post(url, id, body); !retry || attempt == s.retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post makes a single delivery, and says whether it's worth trying again.
+func (s *webhookSender) post(url, id string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", mediaTypeJSON)
+	req.Header.Set("X-Webhook-ID", id)
+	if len(s.secret) > 0 {
+		req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(s.secret, body))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("webhook answered %s", resp.Status)
+	case resp.StatusCode >= 300:
+		return false, fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return false, nil
+}
+
+// signWebhook returns the hex HMAC-SHA256 of body, keyed by secret.
+func signWebhook(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseWebhookURLs splits a comma separated list of URLs.
+func parseWebhookURLs(s string) []string {
+	var urls []string
+	for _, url := range strings.Split(s, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// webhookMiddleware sends every successful greeting to the webhooks.
+type webhookMiddleware struct {
+	hooks *webhookSender
+	next  GreetService
+}
+
+func (mw webhookMiddleware) Hello(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.notify(ctx, "hello", s, opts, mw.next.Hello)
+}
+
+func (mw webhookMiddleware) Goodbye(ctx context.Context, s string, opts GreetOptions) (Greeting, error) {
+	return mw.notify(ctx, "goodbye", s, opts, mw.next.Goodbye)
+}
+
+func (mw webhookMiddleware) notify(ctx context.Context, method, s string, opts GreetOptions, call greetMethod) (Greeting, error) {
+	g, err := call(ctx, s, opts)
+	if err != nil {
+		return g, err
+	}
+	id, ierr := newRandomID()
+	if ierr != nil {
+		mw.hooks.logger.Log("err", ierr)
+		return g, nil
+	}
+	mw.hooks.Send(webhookEvent{
+		ID:       id,
+		Type:     method,
+		Name:     s,
+		Greeting: g.Text,
+		Lang:     g.Language.String(),
+		Time:     time.Now(),
+	})
+	return g, nil
+}
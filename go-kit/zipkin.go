@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+)
+
+// With -zipkin.url set, spans are reported to a Zipkin collector as well as,
+// or instead of, OTLP, e.g. -zipkin.url http://localhost:9411/api/v2/spans.
+// Pair it with -trace.propagation b3 to carry on traces from services that
+// only send B3 headers.
+//
+// Like OTLP, Zipkin's own reporters need a newer gRPC than go-kit's gRPC
+// transport builds with, so spans are sent in Zipkin's v2 JSON over HTTP.
+
+// zipkinExporter is a sdktrace.SpanExporter that POSTs spans to a Zipkin
+// collector.
+type zipkinExporter struct {
+	url    string
+	client *http.Client
+}
+
+func (e zipkinExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	zspans := make([]zipkinSpan, len(spans))
+	for i, s := range spans {
+		zspans[i] = newZipkinSpan(s)
+	}
+	return postSpans(ctx, e.client, e.url, "Zipkin", zspans)
+}
+
+func (e zipkinExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// zipkinSpan is a span in Zipkin's v2 JSON. Times are in microseconds.
+type zipkinSpan struct {
+	TraceID       string             `json:"traceId"`
+	ID            string             `json:"id"`
+	ParentID      string             `json:"parentId,omitempty"`
+	Name          string             `json:"name"`
+	Kind          string             `json:"kind,omitempty"`
+	Timestamp     int64              `json:"timestamp"`
+	Duration      int64              `json:"duration"`
+	LocalEndpoint zipkinEndpoint     `json:"localEndpoint"`
+	Tags          map[string]string  `json:"tags,omitempty"`
+	Annotations   []zipkinAnnotation `json:"annotations,omitempty"`
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type zipkinAnnotation struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// zipkinKinds are the Zipkin kinds of span kinds. Internal spans have none.
+var zipkinKinds = map[trace.SpanKind]string{
+	trace.SpanKindServer:   "SERVER",
+	trace.SpanKindClient:   "CLIENT",
+	trace.SpanKindProducer: "PRODUCER",
+	trace.SpanKindConsumer: "CONSUMER",
+}
+
+func newZipkinSpan(s sdktrace.ReadOnlySpan) zipkinSpan {
+	span := zipkinSpan{
+		TraceID:   s.SpanContext().TraceID().String(),
+		ID:        s.SpanContext().SpanID().String(),
+		Name:      s.Name(),
+		Kind:      zipkinKinds[s.SpanKind()],
+		Timestamp: s.StartTime().UnixNano() / 1e3,
+		Duration:  s.EndTime().Sub(s.StartTime()).Nanoseconds() / 1e3,
+		Tags:      map[string]string{},
+	}
+	if s.Parent().IsValid() {
+		span.ParentID = s.Parent().SpanID().String()
+	}
+	for _, kv := range s.Resource().Attributes() {
+		if kv.Key == "service.name" {
+			span.LocalEndpoint.ServiceName = kv.Value.Emit()
+		}
+	}
+	for _, kv := range s.Attributes() {
+		span.Tags[string(kv.Key)] = kv.Value.Emit()
+	}
+	if s.Status().Code == codes.Error {
+		// Zipkin marks a failed span by it having an error tag.
+		span.Tags["error"] = s.Status().Description
+	}
+	for _, e := range s.Events() {
+		value := e.Name
+		for _, kv := range e.Attributes {
+			if kv.Key == attribute.Key("exception.message") {
+				value += ": " + kv.Value.Emit()
+			}
+		}
+		span.Annotations = append(span.Annotations, zipkinAnnotation{e.Time.UnixNano() / 1e3, value})
+	}
+	return span
+}